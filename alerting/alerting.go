@@ -84,7 +84,8 @@ func (a Alerting) Scheduler(ctx context.Context) func() error {
 					continue
 				}
 				if !errors.Is(err, repository.ErrRecordNotFound) {
-					if err := a.alertNotifications(ctx, alert); err != nil {
+					// Another alerting process claimed the alert first
+					if err := a.alertNotifications(ctx, alert); err != nil && !errors.Is(err, repository.ErrRecordNotFound) {
 						log.Error("failed to create alert notifications", zap.Error(err))
 						continue
 					}
@@ -136,6 +137,10 @@ func (a Alerting) Scheduler(ctx context.Context) func() error {
 						AlertID:      strconv.Itoa(int(alert.ID)),
 						EventGroupID: strconv.Itoa(int(alert.EventGroupID)),
 						ProjectID:    strconv.Itoa(int(alert.ProjectID)),
+						Exceptions:   ev.Exceptions,
+						Release:      ev.Release,
+						Environment:  ev.Environment,
+						Tags:         ev.Tags,
 					},
 				}); err != nil {
 					log.Error("failed to emit alerting event", zap.Error(err))
@@ -2,38 +2,102 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
 	"net/url"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sethvargo/go-envconfig"
 	"go.uber.org/zap"
 	"gorm.io/driver/postgres"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 
+	"github.com/georgepsarakis/periscope/migrations"
 	"github.com/georgepsarakis/periscope/repository"
 	"github.com/georgepsarakis/periscope/repository/rdbms"
 )
 
 type Configuration struct {
-	Port              int           `env:"PORT,default=8000"`
-	Host              string        `env:"HOST,default=localhost"`
-	AllowedOrigins    []string      `env:"ALLOWED_ORIGINS,default=http://localhost"`
-	RequestTimeout    time.Duration `env:"REQUEST_TIMEOUT,default=30s"`
-	PostgresHost      string        `env:"POSTGRES_HOST,default=localhost"`
-	PostgresPort      int           `env:"POSTGRES_PORT,default=5432"`
-	PostgresUser      string        `env:"POSTGRES_USER,default=pguser"`
-	PostgresPassword  string        `env:"POSTGRES_PASSWORD"`
-	PostgresDatabase  string        `env:"POSTGRES_DATABASE,default=periscope"`
-	PostgresEnabled   bool          `env:"POSTGRES_ENABLED,default=false"`
-	SqlitePath        string        `env:"SQLITE_PATH,default=tmp/periscope.db"`
-	Debug             bool          `env:"DEBUG,default=false"`
-	ApiSecretKeyAdmin string        `env:"API_SECRET_KEY_ADMIN"`
+	Port                       int           `env:"PORT,default=8000"`
+	Host                       string        `env:"HOST,default=localhost"`
+	AllowedOrigins             []string      `env:"ALLOWED_ORIGINS,default=http://localhost"`
+	RequestTimeout             time.Duration `env:"REQUEST_TIMEOUT,default=30s"`
+	PostgresHost               string        `env:"POSTGRES_HOST,default=localhost"`
+	PostgresPort               int           `env:"POSTGRES_PORT,default=5432"`
+	PostgresUser               string        `env:"POSTGRES_USER,default=pguser"`
+	PostgresPassword           string        `env:"POSTGRES_PASSWORD"`
+	PostgresDatabase           string        `env:"POSTGRES_DATABASE,default=periscope"`
+	PostgresEnabled            bool          `env:"POSTGRES_ENABLED,default=false"`
+	PostgresSSLMode            string        `env:"POSTGRES_SSLMODE,default=prefer"`
+	PostgresMaxOpenConns       int           `env:"POSTGRES_MAX_OPEN_CONNS,default=20"`
+	PostgresMaxIdleConns       int           `env:"POSTGRES_MAX_IDLE_CONNS,default=10"`
+	PostgresConnMaxLifetime    time.Duration `env:"POSTGRES_CONN_MAX_LIFETIME,default=30m"`
+	PostgresConnMaxIdleTime    time.Duration `env:"POSTGRES_CONN_MAX_IDLE_TIME,default=5m"`
+	PostgresStatementTimeout   time.Duration `env:"POSTGRES_STATEMENT_TIMEOUT,default=30s"`
+	PostgresMigrateOnStartup   bool          `env:"POSTGRES_MIGRATE_ON_STARTUP,default=true"`
+	SqlitePath                 string        `env:"SQLITE_PATH,default=tmp/periscope.db"`
+	SqliteJournalMode          string        `env:"SQLITE_JOURNAL_MODE,default=WAL"`
+	SqliteSynchronous          string        `env:"SQLITE_SYNCHRONOUS,default=NORMAL"`
+	SqliteBusyTimeout          time.Duration `env:"SQLITE_BUSY_TIMEOUT,default=5s"`
+	SqliteReadConnections      int           `env:"SQLITE_READ_CONNECTIONS,default=4"`
+	Debug                      bool          `env:"DEBUG,default=false"`
+	ApiSecretKeyAdmin          string        `env:"API_SECRET_KEY_ADMIN"`
+	MaxRequestBodySize         int64         `env:"MAX_REQUEST_BODY_SIZE,default=20971520"`
+	EventMaxFutureSkew         time.Duration `env:"EVENT_MAX_FUTURE_SKEW,default=1m"`
+	EventMaxAge                time.Duration `env:"EVENT_MAX_AGE,default=720h"`
+	EventDedupWindow           time.Duration `env:"EVENT_DEDUPLICATION_WINDOW,default=5m"`
+	QueueDriver                string        `env:"INGESTION_QUEUE_DRIVER,default=memory"`
+	QueueLease                 time.Duration `env:"INGESTION_QUEUE_LEASE_DURATION,default=1m"`
+	QueuePollInterval          time.Duration `env:"INGESTION_QUEUE_POLL_INTERVAL,default=500ms"`
+	Roles                      []string      `env:"PERISCOPE_ROLES,default=ingest,worker,alerting"`
+	MaxPendingEvents           int           `env:"INGESTION_MAX_PENDING_EVENTS,default=100000"`
+	MaxPendingEventsPerProject int           `env:"INGESTION_MAX_PENDING_EVENTS_PER_PROJECT,default=10000"`
+	Consumers                  int           `env:"INGESTION_CONSUMERS,default=0"`
+	BackpressureRetryAfter     time.Duration `env:"INGESTION_BACKPRESSURE_RETRY_AFTER,default=10s"`
+	UsageFlushInterval         time.Duration `env:"PROJECT_USAGE_FLUSH_INTERVAL,default=10s"`
+	SamplingKeepFirst          int           `env:"EVENT_SAMPLING_KEEP_FIRST,default=0"`
+	SamplingRate               int           `env:"EVENT_SAMPLING_RATE,default=1"`
+	SamplingMaxPerHour         int           `env:"EVENT_SAMPLING_MAX_PER_HOUR,default=0"`
+	FlushInterval              time.Duration `env:"PERSISTENCE_FLUSH_INTERVAL,default=1s"`
+	FlushMaxEvents             int           `env:"PERSISTENCE_FLUSH_MAX_EVENTS,default=1000"`
+	FlushMaxGroupEvents        int           `env:"PERSISTENCE_FLUSH_MAX_GROUP_EVENTS,default=100"`
+	FlushTimeout               time.Duration `env:"PERSISTENCE_FLUSH_TIMEOUT,default=5s"`
+	FlushDrainTimeout          time.Duration `env:"PERSISTENCE_DRAIN_TIMEOUT,default=30s"`
+	RetryMaxAttempts           int           `env:"PERSISTENCE_RETRY_MAX_ATTEMPTS,default=5"`
+	RetryBackoff               time.Duration `env:"PERSISTENCE_RETRY_BACKOFF,default=1s"`
+	RetryMaxBackoff            time.Duration `env:"PERSISTENCE_RETRY_MAX_BACKOFF,default=30s"`
+	RetentionEventDays         int           `env:"RETENTION_EVENT_DAYS,default=0"`
+	RetentionResolvedGroupDays int           `env:"RETENTION_RESOLVED_GROUP_DAYS,default=0"`
+	RetentionPurgeInterval     time.Duration `env:"RETENTION_PURGE_INTERVAL,default=1h"`
+	RetentionPurgeBatchSize    int           `env:"RETENTION_PURGE_BATCH_SIZE,default=1000"`
+	RetentionPurgeTimeout      time.Duration `env:"RETENTION_PURGE_TIMEOUT,default=10m"`
 }
 
+// Process roles, each one can run in a separate process to be scaled independently.
+const (
+	// RoleIngest accepts events on the ingestion endpoints and publishes them to the ingestion queue.
+	RoleIngest = "ingest"
+	// RoleWorker consumes the ingestion queue, groups and persists the events.
+	RoleWorker = "worker"
+	// RoleAlerting delivers the notifications of triggered alerts.
+	RoleAlerting = "alerting"
+)
+
+var ErrInvalidRole = errors.New("invalid process role")
+
+var (
+	// ErrSchemaBehind is returned on startup when the database schema lacks migrations of this release.
+	ErrSchemaBehind = errors.New("database schema is behind")
+	// ErrMigrationsUnsupported is returned by the migration commands for SQLite, whose schema is migrated
+	// automatically on startup.
+	ErrMigrationsUnsupported = errors.New("migrations require Postgres, the SQLite schema is migrated on startup")
+)
+
 type App struct {
 	cfg                Configuration
 	Logger             *zap.Logger
@@ -57,53 +121,190 @@ func (a App) HTTPAllowedOrigins() []string {
 	return a.cfg.AllowedOrigins
 }
 
+func (a App) HTTPMaxRequestBodySize() int64 {
+	return a.cfg.MaxRequestBodySize
+}
+
+// EventMaxFutureSkew is how far ahead of the receive time an event timestamp is accepted.
+func (a App) EventMaxFutureSkew() time.Duration {
+	return a.cfg.EventMaxFutureSkew
+}
+
+// EventMaxAge is how far behind the receive time an event timestamp is accepted.
+func (a App) EventMaxAge() time.Duration {
+	return a.cfg.EventMaxAge
+}
+
+// EventDeduplicationWindow is how long ingested event IDs are remembered to discard retried submissions.
+func (a App) EventDeduplicationWindow() time.Duration {
+	return a.cfg.EventDedupWindow
+}
+
+// IngestionQueueDriver selects the transport of ingested events, either memory or database.
+func (a App) IngestionQueueDriver() string {
+	return a.cfg.QueueDriver
+}
+
+// IngestionQueueLeaseDuration is how long a consumed message of the database queue is locked before it is
+// delivered again, unless acknowledged. Leases are extended while the message is being processed.
+func (a App) IngestionQueueLeaseDuration() time.Duration {
+	return a.cfg.QueueLease
+}
+
+func (a App) IngestionQueuePollInterval() time.Duration {
+	return a.cfg.QueuePollInterval
+}
+
+func (a App) IngestionMaxPendingEvents() int {
+	return a.cfg.MaxPendingEvents
+}
+
+func (a App) IngestionMaxPendingEventsPerProject() int {
+	return a.cfg.MaxPendingEventsPerProject
+}
+
+// IngestionConsumers is the number of aggregator workers, zero uses one worker per CPU.
+func (a App) IngestionConsumers() int {
+	return a.cfg.Consumers
+}
+
+func (a App) IngestionBackpressureRetryAfter() time.Duration {
+	return a.cfg.BackpressureRetryAfter
+}
+
+func (a App) ProjectUsageFlushInterval() time.Duration {
+	return a.cfg.UsageFlushInterval
+}
+
+// EventSampling returns the policy that limits the events stored for each group.
+func (a App) EventSampling() repository.EventSampling {
+	return repository.EventSampling{
+		KeepFirst:  a.cfg.SamplingKeepFirst,
+		Rate:       a.cfg.SamplingRate,
+		MaxPerHour: a.cfg.SamplingMaxPerHour,
+	}
+}
+
+// PersistenceFlushInterval is the maximum time aggregated events wait before they are persisted.
+func (a App) PersistenceFlushInterval() time.Duration {
+	return a.cfg.FlushInterval
+}
+
+// PersistenceFlushMaxEvents is the number of aggregated events that triggers a flush before the interval elapses.
+func (a App) PersistenceFlushMaxEvents() int {
+	return a.cfg.FlushMaxEvents
+}
+
+// PersistenceFlushMaxGroupEvents is the number of aggregated events of a single group that triggers a flush.
+func (a App) PersistenceFlushMaxGroupEvents() int {
+	return a.cfg.FlushMaxGroupEvents
+}
+
+func (a App) PersistenceFlushTimeout() time.Duration {
+	return a.cfg.FlushTimeout
+}
+
+// PersistenceDrainTimeout bounds the final flush of aggregated events on shutdown.
+func (a App) PersistenceDrainTimeout() time.Duration {
+	return a.cfg.FlushDrainTimeout
+}
+
+// PersistenceRetryMaxAttempts is the number of attempts to persist an event before it is dead-lettered.
+func (a App) PersistenceRetryMaxAttempts() int {
+	return a.cfg.RetryMaxAttempts
+}
+
+// PersistenceRetryBackoff is the delay before retrying a failed batch, doubled after each attempt.
+func (a App) PersistenceRetryBackoff() time.Duration {
+	return a.cfg.RetryBackoff
+}
+
+func (a App) PersistenceRetryMaxBackoff() time.Duration {
+	return a.cfg.RetryMaxBackoff
+}
+
+// RetentionEventDays is the number of days events are kept, unless the project overrides it. Zero keeps
+// them forever.
+func (a App) RetentionEventDays() int {
+	return a.cfg.RetentionEventDays
+}
+
+// RetentionResolvedGroupDays is the number of days resolved groups are kept, unless the project overrides it.
+func (a App) RetentionResolvedGroupDays() int {
+	return a.cfg.RetentionResolvedGroupDays
+}
+
+func (a App) RetentionPurgeInterval() time.Duration {
+	return a.cfg.RetentionPurgeInterval
+}
+
+// RetentionPurgeBatchSize is the maximum number of rows deleted by each statement of the purge.
+func (a App) RetentionPurgeBatchSize() int {
+	return a.cfg.RetentionPurgeBatchSize
+}
+
+func (a App) RetentionPurgeTimeout() time.Duration {
+	return a.cfg.RetentionPurgeTimeout
+}
+
+// HasRole reports whether the process runs the given role.
+func (a App) HasRole(role string) bool {
+	return slices.Contains(a.cfg.Roles, role)
+}
+
+func (a App) Roles() []string {
+	return a.cfg.Roles
+}
+
 func (a App) DebugEnabled() bool {
 	return a.cfg.Debug
 }
 
 func New() (App, func() error, error) {
 	app := App{}
-	cfg := Configuration{}
-	envconfig.MustProcess(context.Background(), &cfg)
+	cfg, err := loadConfiguration()
+	if err != nil {
+		return app, nil, err
+	}
 	app.cfg = cfg
 
 	appLogger, _ := zap.NewProduction()
 	app.Logger = appLogger
 
-	var dbLogger logger.Interface
-	if app.cfg.Debug {
-		dbLogger = logger.Default.LogMode(logger.Silent)
-	} else {
-		dbLogger = logger.Discard
-	}
-	gormCfg := gorm.Config{
-		Logger: dbLogger,
-	}
-
 	var database *gorm.DB
+	closeDB := func() error { return nil }
 	if app.cfg.PostgresEnabled {
-		dsn := url.URL{
-			Scheme: "postgres",
-			Host:   net.JoinHostPort(app.cfg.PostgresHost, strconv.Itoa(app.cfg.PostgresPort)),
-			Path:   app.cfg.PostgresDatabase,
-			User:   url.UserPassword(app.cfg.PostgresUser, app.cfg.PostgresPassword),
-		}
-		app.cfg.PostgresPassword = ""
-		db, err := gorm.Open(postgres.New(postgres.Config{DSN: dsn.String()}), &gormCfg)
+		db, err := openPostgres(&app.cfg)
 		if err != nil {
 			return app, nil, err
 		}
 		app.PostgresConnection = db
 		database = db
+		if app.cfg.PostgresMigrateOnStartup {
+			if err := migrate(database, app.Logger); err != nil {
+				return app, nil, err
+			}
+		} else if err := checkSchema(database); err != nil {
+			return app, nil, err
+		}
 	} else {
-		db, err := gorm.Open(sqlite.Open(cfg.SqlitePath), &gormCfg)
+		db, closeSQLite, err := openSQLite(cfg)
 		if err != nil {
 			panic("failed to connect database")
 		}
 		database = db
+		closeDB = closeSQLite
 	}
+	app.Repository = repository.New(database, app.Logger)
 	if !app.cfg.PostgresEnabled {
-		app.Repository = repository.New(database)
+		if err := deduplicateEvents(database); err != nil {
+			panic(err)
+		}
+		if err := mergeDuplicateEventGroups(database); err != nil {
+			panic(err)
+		}
+		m := database.Migrator()
+		backfillStoredCounts := m.HasTable(&rdbms.EventGroup{}) && !m.HasColumn(&rdbms.EventGroup{}, "StoredCount")
 		if err := database.AutoMigrate(
 			&rdbms.EventGroup{},
 			&rdbms.Event{},
@@ -114,12 +315,205 @@ func New() (App, func() error, error) {
 			&rdbms.ProjectAlertDestination{},
 			&rdbms.ProjectIngestionAPIKey{},
 			&rdbms.AlertDestinationNotificationWebhookConfiguration{},
+			&rdbms.ProjectFingerprintRule{},
+			&rdbms.EventPayload{},
+			&rdbms.QueueMessage{},
+			&rdbms.ProjectLimit{},
+			&rdbms.ProjectUsage{},
+			&rdbms.ProjectInboundFilter{},
+			&rdbms.DeadLetterEvent{},
+			&rdbms.ProjectRetention{},
 		); err != nil {
 			panic(err)
 		}
+		if backfillStoredCounts {
+			if err := database.Exec(`UPDATE event_groups SET stored_count = (
+				SELECT COUNT(*) FROM events WHERE events.event_group_id = event_groups.id
+			)`).Error; err != nil {
+				panic(err)
+			}
+		}
 	}
 
 	return app, func() error {
-		return app.Logger.Sync()
+		return errors.Join(closeDB(), app.Logger.Sync())
 	}, nil
 }
+
+// NewMigrator connects to the Postgres database and returns the migrator of the embedded migrations,
+// without applying them.
+func NewMigrator() (*migrations.Migrator, func() error, error) {
+	cfg, err := loadConfiguration()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !cfg.PostgresEnabled {
+		return nil, nil, ErrMigrationsUnsupported
+	}
+	db, err := openPostgres(&cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	all, err := migrations.Embedded()
+	if err != nil {
+		return nil, nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, nil, err
+	}
+	return migrations.NewMigrator(db, all), sqlDB.Close, nil
+}
+
+func loadConfiguration() (Configuration, error) {
+	cfg := Configuration{}
+	envconfig.MustProcess(context.Background(), &cfg)
+	for i, role := range cfg.Roles {
+		cfg.Roles[i] = strings.TrimSpace(role)
+		switch cfg.Roles[i] {
+		case RoleIngest, RoleWorker, RoleAlerting:
+		default:
+			return cfg, fmt.Errorf("%w: %q", ErrInvalidRole, role)
+		}
+	}
+	return cfg, nil
+}
+
+func gormConfig(cfg Configuration) *gorm.Config {
+	var dbLogger logger.Interface
+	if cfg.Debug {
+		dbLogger = logger.Default.LogMode(logger.Silent)
+	} else {
+		dbLogger = logger.Discard
+	}
+	return &gorm.Config{
+		Logger: dbLogger,
+	}
+}
+
+// openPostgres connects to the Postgres database and clears the password from the configuration.
+func openPostgres(cfg *Configuration) (*gorm.DB, error) {
+	dsn := url.URL{
+		Scheme: "postgres",
+		Host:   net.JoinHostPort(cfg.PostgresHost, strconv.Itoa(cfg.PostgresPort)),
+		Path:   cfg.PostgresDatabase,
+		User:   url.UserPassword(cfg.PostgresUser, cfg.PostgresPassword),
+		RawQuery: url.Values{
+			"sslmode": {cfg.PostgresSSLMode},
+			// Unknown parameters are sent to the server as session settings
+			"statement_timeout": {strconv.FormatInt(cfg.PostgresStatementTimeout.Milliseconds(), 10)},
+		}.Encode(),
+	}
+	cfg.PostgresPassword = ""
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: dsn.String()}), gormConfig(*cfg))
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(cfg.PostgresMaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.PostgresMaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.PostgresConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.PostgresConnMaxIdleTime)
+	return db, nil
+}
+
+// migrate applies the embedded migrations that are missing from the Postgres database.
+func migrate(db *gorm.DB, log *zap.Logger) error {
+	all, err := migrations.Embedded()
+	if err != nil {
+		return err
+	}
+	applied, err := migrations.NewMigrator(db, all).Up(context.Background(), "")
+	for _, m := range applied {
+		log.Info("applied database migration", zap.String("version", m.Version), zap.String("description", m.Description))
+	}
+	if err != nil {
+		return fmt.Errorf("database migration failed: %w", err)
+	}
+	return nil
+}
+
+// checkSchema fails when migrations of this release are not applied to the Postgres database.
+func checkSchema(db *gorm.DB) error {
+	all, err := migrations.Embedded()
+	if err != nil {
+		return err
+	}
+	pending, err := migrations.NewMigrator(db, all).Pending(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %d pending migrations, starting with %s, run `periscope migrate up`",
+			ErrSchemaBehind, len(pending), pending[0].Version)
+	}
+	return nil
+}
+
+// deduplicateEvents removes events stored more than once, before the unique index on the project and
+// event ID is created by the SQLite schema migration.
+func deduplicateEvents(db *gorm.DB) error {
+	m := db.Migrator()
+	if !m.HasTable(&rdbms.Event{}) || m.HasIndex(&rdbms.Event{}, "uq_events_project_id_event_id") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		const duplicates = `SELECT id FROM events WHERE id NOT IN (
+			SELECT MIN(id) FROM events GROUP BY project_id, event_id
+		)`
+		if err := tx.Exec(`UPDATE event_groups SET total_count = total_count - (
+			SELECT COUNT(*) FROM events WHERE events.event_group_id = event_groups.id AND events.id IN (` + duplicates + `)
+		)`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`DELETE FROM events WHERE id IN (` + duplicates + `)`).Error
+	})
+}
+
+// mergeDuplicateEventGroups merges event groups created more than once for the same aggregation key into
+// the oldest one, before the unique index on the aggregation key is created.
+func mergeDuplicateEventGroups(db *gorm.DB) error {
+	m := db.Migrator()
+	if !m.HasTable(&rdbms.EventGroup{}) || m.HasIndex(&rdbms.EventGroup{}, "uq_event_groups_project_id_aggregation_key") {
+		return nil
+	}
+	// The stored count is backfilled after the migration on databases that do not have it yet
+	storedCount := ""
+	if m.HasColumn(&rdbms.EventGroup{}, "StoredCount") {
+		storedCount = `stored_count = stored_count + (SELECT SUM(e.stored_count) FROM event_groups e
+			JOIN event_group_duplicates d ON d.id = e.id WHERE d.keep_id = event_groups.id),`
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			`CREATE TEMPORARY TABLE event_group_duplicates AS
+			SELECT g.id, (
+				SELECT MIN(k.id) FROM event_groups k
+				WHERE k.project_id = g.project_id AND k.aggregation_key = g.aggregation_key
+			) AS keep_id FROM event_groups g`,
+			`DELETE FROM event_group_duplicates WHERE id = keep_id`,
+			`UPDATE event_groups SET
+				total_count = total_count + (SELECT SUM(e.total_count) FROM event_groups e
+					JOIN event_group_duplicates d ON d.id = e.id WHERE d.keep_id = event_groups.id),
+				` + storedCount + `
+				event_received_at = MAX(event_received_at, (SELECT MAX(e.event_received_at) FROM event_groups e
+					JOIN event_group_duplicates d ON d.id = e.id WHERE d.keep_id = event_groups.id))
+			WHERE id IN (SELECT keep_id FROM event_group_duplicates)`,
+			`UPDATE events SET event_group_id = (SELECT keep_id FROM event_group_duplicates WHERE id = events.event_group_id)
+			WHERE event_group_id IN (SELECT id FROM event_group_duplicates)`,
+			`UPDATE alerts SET event_group_id = (SELECT keep_id FROM event_group_duplicates WHERE id = alerts.event_group_id)
+			WHERE event_group_id IN (SELECT id FROM event_group_duplicates)`,
+			`DELETE FROM event_groups WHERE id IN (SELECT id FROM event_group_duplicates)`,
+			`DROP TABLE event_group_duplicates`,
+			`DROP INDEX IF EXISTS idx_proj_aggr_key`,
+		}
+		for _, s := range statements {
+			if err := tx.Exec(s).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
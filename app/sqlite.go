@@ -0,0 +1,111 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// sqliteConnPool sends the statements that write to the database to a single connection, so that the
+// writers of the process queue for it instead of failing with "database is locked" once the busy timeout
+// expires. Transactions always run on the writer connection, while plain queries run on a pool of reader
+// connections, which do not block writers in WAL mode.
+type sqliteConnPool struct {
+	writer *sql.DB
+	reader *sql.DB
+}
+
+func (p sqliteConnPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.route(query).PrepareContext(ctx, query)
+}
+
+func (p sqliteConnPool) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return p.writer.ExecContext(ctx, query, args...)
+}
+
+func (p sqliteConnPool) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return p.route(query).QueryContext(ctx, query, args...)
+}
+
+func (p sqliteConnPool) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return p.route(query).QueryRowContext(ctx, query, args...)
+}
+
+func (p sqliteConnPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return p.writer.BeginTx(ctx, opts)
+}
+
+// GetDBConn returns the writer connection, which is also used by the schema migrations.
+func (p sqliteConnPool) GetDBConn() (*sql.DB, error) {
+	return p.writer, nil
+}
+
+// route selects the reader pool for queries that only read, e.g. not for INSERT ... RETURNING.
+func (p sqliteConnPool) route(query string) *sql.DB {
+	query = strings.TrimSpace(query)
+	if len(query) >= 6 && strings.EqualFold(query[:6], "SELECT") {
+		return p.reader
+	}
+	return p.writer
+}
+
+// openSQLite opens the database with one writer connection and a pool of reader connections. The returned
+// function closes both.
+func openSQLite(cfg Configuration) (*gorm.DB, func() error, error) {
+	path := cfg.SqlitePath
+	writerParams := url.Values{
+		"_busy_timeout": {strconv.FormatInt(cfg.SqliteBusyTimeout.Milliseconds(), 10)},
+		"_synchronous":  {cfg.SqliteSynchronous},
+		"_journal_mode": {cfg.SqliteJournalMode},
+		// Take the write lock when the transaction starts, waiting for writers of other processes
+		"_txlock": {"immediate"},
+	}
+	writer, err := sql.Open("sqlite3", sqliteDSN(path, writerParams))
+	if err != nil {
+		return nil, nil, err
+	}
+	writer.SetMaxOpenConns(1)
+	// The journal mode is persisted in the database file by the first connection
+	if err := writer.Ping(); err != nil {
+		return nil, nil, errors.Join(err, writer.Close())
+	}
+	// Each connection of an in-memory database opens a separate database, so the reader is the writer and
+	// reads are serialized behind writes on its single connection
+	reader := writer
+	closeDB := writer.Close
+	if path != ":memory:" && !strings.Contains(path, "mode=memory") {
+		reader, err = sql.Open("sqlite3", sqliteDSN(path, url.Values{
+			"_busy_timeout": writerParams["_busy_timeout"],
+			"_query_only":   {"true"},
+		}))
+		if err != nil {
+			return nil, nil, errors.Join(err, writer.Close())
+		}
+		reader.SetMaxOpenConns(cfg.SqliteReadConnections)
+		reader.SetMaxIdleConns(cfg.SqliteReadConnections)
+		closeDB = func() error {
+			return errors.Join(reader.Close(), writer.Close())
+		}
+	}
+	db, err := gorm.Open(sqlite.New(sqlite.Config{
+		Conn: sqliteConnPool{writer: writer, reader: reader},
+	}), gormConfig(cfg))
+	if err != nil {
+		return nil, nil, errors.Join(err, closeDB())
+	}
+	return db, closeDB, nil
+}
+
+func sqliteDSN(path string, params url.Values) string {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + params.Encode()
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newSQLiteConfiguration(path string) Configuration {
+	return Configuration{
+		SqlitePath:            path,
+		SqliteJournalMode:     "WAL",
+		SqliteSynchronous:     "NORMAL",
+		SqliteBusyTimeout:     5 * time.Second,
+		SqliteReadConnections: 4,
+	}
+}
+
+func TestOpenSQLite(t *testing.T) {
+	db, closeDB, err := openSQLite(newSQLiteConfiguration(filepath.Join(t.TempDir(), "periscope.db")))
+	require.NoError(t, err)
+
+	var journalMode string
+	require.NoError(t, db.Raw("PRAGMA journal_mode").Scan(&journalMode).Error)
+	assert.Equal(t, "wal", journalMode)
+	var synchronous int
+	require.NoError(t, db.Raw("PRAGMA synchronous").Scan(&synchronous).Error)
+	assert.Equal(t, 1, synchronous)
+
+	require.NoError(t, db.Exec("CREATE TABLE counters (id INTEGER PRIMARY KEY, value INTEGER NOT NULL)").Error)
+	require.NoError(t, db.Exec("INSERT INTO counters (id, value) VALUES (1, 0)").Error)
+
+	// Writers queue for the writer connection, while readers keep reading
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- db.Transaction(func(tx *gorm.DB) error {
+				var value int
+				if err := tx.Raw("SELECT value FROM counters WHERE id = 1").Scan(&value).Error; err != nil {
+					return err
+				}
+				return tx.Exec("UPDATE counters SET value = ? WHERE id = 1", value+1).Error
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			var value int
+			errs <- db.Raw("SELECT value FROM counters WHERE id = 1").Scan(&value).Error
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	var value int
+	require.NoError(t, db.Raw("SELECT value FROM counters WHERE id = 1").Scan(&value).Error)
+	assert.Equal(t, 50, value)
+
+	// Queries that write are sent to the writer connection
+	var id int
+	require.NoError(t, db.Raw("INSERT INTO counters (value) VALUES (1) RETURNING id").Scan(&id).Error)
+	assert.Equal(t, 2, id)
+
+	// Both the reader and the writer connections are closed
+	require.NoError(t, closeDB())
+	assert.Error(t, db.Raw("SELECT value FROM counters WHERE id = 1").Scan(&value).Error)
+	assert.Error(t, db.Exec("UPDATE counters SET value = 0").Error)
+}
+
+func TestOpenSQLite_InMemory(t *testing.T) {
+	db, closeDB, err := openSQLite(newSQLiteConfiguration(":memory:"))
+	require.NoError(t, err)
+	require.NoError(t, db.Exec("CREATE TABLE counters (id INTEGER PRIMARY KEY)").Error)
+	var count int64
+	require.NoError(t, db.Table("counters").Count(&count).Error)
+	assert.Zero(t, count)
+	require.NoError(t, closeDB())
+}
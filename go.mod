@@ -5,6 +5,7 @@ go 1.23.2
 require (
 	ariga.io/atlas-provider-gorm v0.5.3
 	github.com/ThreeDotsLabs/watermill v1.4.7
+	github.com/andybalholm/brotli v1.1.1
 	github.com/coocood/freecache v1.2.4
 	github.com/georgepsarakis/chi-api-key-auth v0.0.0-20250406134028-b14571076870
 	github.com/georgepsarakis/go-httpclient v0.0.2
@@ -12,8 +13,11 @@ require (
 	github.com/go-chi/chi/v5 v5.2.2
 	github.com/go-chi/cors v1.2.2
 	github.com/go-playground/validator/v10 v10.27.0
+	github.com/google/uuid v1.6.0
 	github.com/sethvargo/go-envconfig v1.3.0
+	github.com/slack-go/slack v0.17.3
 	github.com/stretchr/testify v1.10.0
+	github.com/urfave/cli/v3 v3.4.1
 	go.uber.org/zap v1.27.0
 	golang.org/x/sync v0.15.0
 	gorm.io/driver/postgres v1.6.0
@@ -31,7 +35,6 @@ require (
 	github.com/go-sql-driver/mysql v1.7.0 // indirect
 	github.com/golang-sql/civil v0.0.0-20220223132316-b832511892a9 // indirect
 	github.com/golang-sql/sqlexp v0.1.0 // indirect
-	github.com/google/uuid v1.6.0 // indirect
 	github.com/gorilla/websocket v1.5.3 // indirect
 	github.com/jackc/pgpassfile v1.0.0 // indirect
 	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
@@ -46,8 +49,6 @@ require (
 	github.com/oklog/ulid v1.3.1 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/slack-go/slack v0.17.3 // indirect
-	github.com/urfave/cli/v3 v3.4.1 // indirect
 	go.uber.org/multierr v1.10.0 // indirect
 	golang.org/x/crypto v0.33.0 // indirect
 	golang.org/x/net v0.34.0 // indirect
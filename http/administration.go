@@ -2,8 +2,11 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
@@ -11,8 +14,10 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/georgepsarakis/periscope/app"
+	"github.com/georgepsarakis/periscope/ingestion"
 	"github.com/georgepsarakis/periscope/newcontext"
 	"github.com/georgepsarakis/periscope/repository"
+	"github.com/georgepsarakis/periscope/retention"
 )
 
 type ProjectHandler struct {
@@ -28,7 +33,8 @@ func NewProjectHandler(application app.App) ProjectHandler {
 }
 
 type ProjectCreateRequest struct {
-	Name string `json:"name" validate:"required"`
+	Name                   string `json:"name" validate:"required"`
+	RequireIngestionSecret bool   `json:"require_ingestion_secret"`
 }
 
 func (h ProjectHandler) Read(w http.ResponseWriter, r *http.Request) {
@@ -54,14 +60,7 @@ func (h ProjectHandler) Read(w http.ResponseWriter, r *http.Request) {
 	}
 	b, _ := json.Marshal(
 		ProjectReadResponse{
-			Project: Project{
-				ID:               prj.ID,
-				Name:             prj.Name,
-				PublicID:         prj.PublicID,
-				IngestionAPIKeys: []string{prj.ProjectIngestionAPIKeys[0].Key},
-				CreatedAt:        prj.CreatedAt,
-				UpdatedAt:        prj.UpdatedAt,
-			},
+			Project: newProject(prj),
 		})
 	if _, writeErr := w.Write(b); writeErr != nil {
 		l := newcontext.LoggerFromContext(ctx)
@@ -95,21 +94,14 @@ func (h ProjectHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	prj, err := h.application.Repository.ProjectCreate(ctx, req.Name)
+	prj, err := h.application.Repository.ProjectCreate(ctx, req.Name, req.RequireIngestionSecret)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 	b, _ := json.Marshal(
 		ProjectCreateResponse{
-			Project: Project{
-				ID:               prj.ID,
-				Name:             prj.Name,
-				PublicID:         prj.PublicID,
-				IngestionAPIKeys: []string{prj.ProjectIngestionAPIKeys[0].Key},
-				CreatedAt:        prj.CreatedAt,
-				UpdatedAt:        prj.UpdatedAt,
-			},
+			Project: newProject(prj),
 		})
 	if _, writeErr := w.Write(b); writeErr != nil {
 		l := newcontext.LoggerFromContext(ctx)
@@ -122,6 +114,22 @@ func (h ProjectHandler) Create(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 }
 
+func newProject(prj repository.Project) Project {
+	p := Project{
+		ID:                     prj.ID,
+		Name:                   prj.Name,
+		PublicID:               prj.PublicID,
+		RequireIngestionSecret: prj.RequireIngestionSecret,
+		IngestionAPIKeys:       []string{prj.ProjectIngestionAPIKeys[0].Key},
+		CreatedAt:              prj.CreatedAt,
+		UpdatedAt:              prj.UpdatedAt,
+	}
+	if prj.RequireIngestionSecret {
+		p.IngestionAPISecrets = []string{prj.ProjectIngestionAPIKeys[0].Secret}
+	}
+	return p
+}
+
 type ProjectCreateResponse struct {
 	Project Project `json:"project"`
 }
@@ -179,6 +187,65 @@ type AlertListResponse struct {
 	Alerts []repository.Alert `json:"alerts"`
 }
 
+type ProjectEventHandler struct {
+	application app.App
+}
+
+func NewProjectEventHandler(application app.App) ProjectEventHandler {
+	return ProjectEventHandler{application: application}
+}
+
+type EventReadResponse struct {
+	Event repository.Event `json:"event"`
+}
+
+// Read returns a single event of the project, including the payload exactly as it was ingested.
+func (h ProjectEventHandler) Read(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := newcontext.LoggerFromContext(ctx)
+	projectID, err := strconv.Atoi(chi.URLParam(r, "project_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// Event IDs are stored normalized, while SDKs report them as UUIDs
+	eventID := chi.URLParam(r, "event_id")
+	if eventID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	eventID, err = ingestion.NormalizeEventID(eventID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		if _, writeErr := w.Write(NewJSONError("invalid event ID", ErrorCodeValidationFailed)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	ev, err := h.application.Repository.EventFindByProjectAndEventID(ctx, uint(projectID), eventID)
+	if err != nil {
+		if errors.Is(err, repository.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		err := NewZapError(err, zap.Int("project_id", projectID), zap.String("event_id", eventID))
+		if _, writeErr := w.Write(NewServerError(ctx, err)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	b, err := json.Marshal(EventReadResponse{Event: ev})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		logger.Error("writing response body failed", zap.Error(err))
+	}
+}
+
 type AlertDestinationHandler struct {
 	application app.App
 	validate    *validator.Validate
@@ -250,3 +317,840 @@ func (h AlertDestinationHandler) Create(w http.ResponseWriter, r *http.Request)
 		return
 	}
 }
+
+type FingerprintRuleHandler struct {
+	application app.App
+	validate    *validator.Validate
+}
+
+func NewFingerprintRuleHandler(application app.App) FingerprintRuleHandler {
+	return FingerprintRuleHandler{
+		application: application,
+		validate:    validator.New(validator.WithRequiredStructEnabled()),
+	}
+}
+
+type FingerprintRuleCreateRequest struct {
+	Priority      int               `json:"priority"`
+	ExceptionType string            `json:"exception_type"`
+	Message       string            `json:"message"`
+	Module        string            `json:"module"`
+	Function      string            `json:"function"`
+	Level         string            `json:"level"`
+	Tags          map[string]string `json:"tags"`
+	Fingerprint   []string          `json:"fingerprint" validate:"required,min=1,dive,required"`
+}
+
+func (req FingerprintRuleCreateRequest) hasMatchers() bool {
+	return req.ExceptionType != "" || req.Message != "" || req.Module != "" ||
+		req.Function != "" || req.Level != "" || len(req.Tags) > 0
+}
+
+type FingerprintRuleListResponse struct {
+	Rules []repository.FingerprintRule `json:"rules"`
+}
+
+func (h FingerprintRuleHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	paramProjectID := chi.URLParam(r, "project_id")
+	projectID, err := strconv.Atoi(paramProjectID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rules, err := h.application.Repository.FingerprintRulesByProjectID(ctx, uint(projectID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	b, err := json.Marshal(FingerprintRuleListResponse{Rules: rules})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		l := newcontext.LoggerFromContext(ctx)
+		l.Error("writing response body failed",
+			zap.Error(err),
+			zap.String("project_id", paramProjectID))
+	}
+}
+
+// Create adds a fingerprint rule to the project. The request model is FingerprintRuleCreateRequest.
+func (h FingerprintRuleHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := newcontext.LoggerFromContext(ctx)
+	projectID, err := strconv.Atoi(chi.URLParam(r, "project_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	req := FingerprintRuleCreateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		if _, writeErr := w.Write(NewJSONError("json decoding failed", ErrorCodeJSONDecodingFailed)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	validationErr := h.validate.Struct(req)
+	if validationErr == nil && !req.hasMatchers() {
+		validationErr = errors.New("at least one matcher is required")
+	}
+	if validationErr == nil && req.Message != "" {
+		if _, err := regexp.Compile(req.Message); err != nil {
+			validationErr = err
+		}
+	}
+	if validationErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		if _, writeErr := w.Write(NewJSONError("validation failed", ErrorCodeValidationFailed)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	rule, err := h.application.Repository.FingerprintRuleCreate(ctx, repository.FingerprintRule{
+		ProjectID:     uint(projectID),
+		Priority:      req.Priority,
+		ExceptionType: req.ExceptionType,
+		Message:       req.Message,
+		Module:        req.Module,
+		Function:      req.Function,
+		Level:         req.Level,
+		Tags:          req.Tags,
+		Fingerprint:   req.Fingerprint,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		if _, writeErr := w.Write(NewServerError(ctx, err)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	b, _ := json.Marshal(rule)
+	if _, err := w.Write(b); err != nil {
+		logger.Error("writing response body failed", zap.Error(err))
+	}
+}
+
+func (h FingerprintRuleHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectID, err := strconv.Atoi(chi.URLParam(r, "project_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := h.application.Repository.FingerprintRuleDelete(ctx, uint(projectID), uint(id)); err != nil {
+		if errors.Is(err, repository.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		if _, writeErr := w.Write(NewServerError(ctx, err)); writeErr != nil {
+			newcontext.LoggerFromContext(ctx).Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type IngestionStatsHandler struct {
+	application app.App
+	aggr        *ingestion.Aggregator
+}
+
+func NewIngestionStatsHandler(application app.App, aggr *ingestion.Aggregator) IngestionStatsHandler {
+	return IngestionStatsHandler{application: application, aggr: aggr}
+}
+
+type IngestionStatsResponse struct {
+	Stats ingestion.Stats `json:"stats"`
+}
+
+// Read returns the number of pending events and the limits above which events are rejected.
+func (h IngestionStatsHandler) Read(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := newcontext.LoggerFromContext(ctx)
+	stats, err := h.aggr.Stats(ctx)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		if _, writeErr := w.Write(NewServerError(ctx, err)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	b, err := json.Marshal(IngestionStatsResponse{Stats: stats})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		logger.Error("writing response body failed", zap.Error(err))
+	}
+}
+
+type ProjectLimitsHandler struct {
+	application app.App
+	validate    *validator.Validate
+}
+
+func NewProjectLimitsHandler(application app.App) ProjectLimitsHandler {
+	return ProjectLimitsHandler{
+		application: application,
+		validate:    validator.New(validator.WithRequiredStructEnabled()),
+	}
+}
+
+// ProjectLimitsUpdateRequest replaces the ingestion limits of a project, zero values disable a limit. The events
+// per minute limit applies to each ingesting process separately.
+type ProjectLimitsUpdateRequest struct {
+	EventsPerMinute int `json:"events_per_minute" validate:"gte=0"`
+	DailyQuota      int `json:"daily_quota" validate:"gte=0"`
+	MonthlyQuota    int `json:"monthly_quota" validate:"gte=0"`
+}
+
+type ProjectLimitsResponse struct {
+	Limits repository.ProjectLimits `json:"limits"`
+}
+
+type ProjectUsageResponse struct {
+	Usage []repository.ProjectUsage `json:"usage"`
+}
+
+// maxUsageDays bounds the period of the project usage report.
+const maxUsageDays = 366
+
+func (h ProjectLimitsHandler) Read(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := newcontext.LoggerFromContext(ctx)
+	projectID, err := strconv.Atoi(chi.URLParam(r, "project_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limits, err := h.application.Repository.ProjectLimitsFindByProjectID(ctx, uint(projectID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		if _, writeErr := w.Write(NewServerError(ctx, err)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	b, _ := json.Marshal(ProjectLimitsResponse{Limits: limits})
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		logger.Error("writing response body failed", zap.Error(err))
+	}
+}
+
+// Update replaces the ingestion limits of the project. The request model is ProjectLimitsUpdateRequest.
+func (h ProjectLimitsHandler) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := newcontext.LoggerFromContext(ctx)
+	projectID, err := strconv.Atoi(chi.URLParam(r, "project_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	req := ProjectLimitsUpdateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		if _, writeErr := w.Write(NewJSONError("json decoding failed", ErrorCodeJSONDecodingFailed)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		if _, writeErr := w.Write(NewJSONError("validation failed", ErrorCodeValidationFailed)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	limits, err := h.application.Repository.ProjectLimitsUpdate(ctx, repository.ProjectLimits{
+		ProjectID:       uint(projectID),
+		EventsPerMinute: req.EventsPerMinute,
+		DailyQuota:      req.DailyQuota,
+		MonthlyQuota:    req.MonthlyQuota,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		if _, writeErr := w.Write(NewServerError(ctx, err)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	b, _ := json.Marshal(ProjectLimitsResponse{Limits: limits})
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		logger.Error("writing response body failed", zap.Error(err))
+	}
+}
+
+// Usage returns the daily counts of accepted and rejected events of the project, for the number of days
+// given by the "days" query parameter.
+func (h ProjectLimitsHandler) Usage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := newcontext.LoggerFromContext(ctx)
+	projectID, err := strconv.Atoi(chi.URLParam(r, "project_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	days := 30
+	if v := r.URL.Query().Get("days"); v != "" {
+		days, err = strconv.Atoi(v)
+		if err != nil || days < 1 || days > maxUsageDays {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	since := repository.UTCNow().Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+	usage, err := h.application.Repository.ProjectUsageList(ctx, uint(projectID), since)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		if _, writeErr := w.Write(NewServerError(ctx, err)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	b, _ := json.Marshal(ProjectUsageResponse{Usage: usage})
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		logger.Error("writing response body failed", zap.Error(err))
+	}
+}
+
+type InboundFilterHandler struct {
+	application app.App
+	validate    *validator.Validate
+}
+
+func NewInboundFilterHandler(application app.App) InboundFilterHandler {
+	return InboundFilterHandler{
+		application: application,
+		validate:    validator.New(validator.WithRequiredStructEnabled()),
+	}
+}
+
+// InboundFilterCreateRequest adds a filter of the given type, see ingestion.InboundFilterTypes.
+type InboundFilterCreateRequest struct {
+	Type    string `json:"type" validate:"required"`
+	Pattern string `json:"pattern"`
+}
+
+type InboundFilterListResponse struct {
+	Filters []repository.InboundFilter `json:"filters"`
+}
+
+func (h InboundFilterHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := newcontext.LoggerFromContext(ctx)
+	projectID, err := strconv.Atoi(chi.URLParam(r, "project_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	filters, err := h.application.Repository.InboundFiltersList(ctx, uint(projectID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		if _, writeErr := w.Write(NewServerError(ctx, err)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	b, _ := json.Marshal(InboundFilterListResponse{Filters: filters})
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		logger.Error("writing response body failed", zap.Error(err))
+	}
+}
+
+// Create adds an inbound filter to the project. The request model is InboundFilterCreateRequest.
+func (h InboundFilterHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := newcontext.LoggerFromContext(ctx)
+	projectID, err := strconv.Atoi(chi.URLParam(r, "project_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	req := InboundFilterCreateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		if _, writeErr := w.Write(NewJSONError("json decoding failed", ErrorCodeJSONDecodingFailed)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	filter := repository.InboundFilter{
+		ProjectID: uint(projectID),
+		Type:      req.Type,
+		Pattern:   req.Pattern,
+	}
+	validationErr := h.validate.Struct(req)
+	if validationErr == nil {
+		validationErr = ingestion.ValidateInboundFilter(filter)
+	}
+	if validationErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		if _, writeErr := w.Write(NewJSONError("validation failed", ErrorCodeValidationFailed)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	filter, err = h.application.Repository.InboundFilterCreate(ctx, filter)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		if _, writeErr := w.Write(NewServerError(ctx, err)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	b, _ := json.Marshal(filter)
+	if _, err := w.Write(b); err != nil {
+		logger.Error("writing response body failed", zap.Error(err))
+	}
+}
+
+func (h InboundFilterHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectID, err := strconv.Atoi(chi.URLParam(r, "project_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := h.application.Repository.InboundFilterDelete(ctx, uint(projectID), uint(id)); err != nil {
+		if errors.Is(err, repository.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		if _, writeErr := w.Write(NewServerError(ctx, err)); writeErr != nil {
+			newcontext.LoggerFromContext(ctx).Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type DeadLetterHandler struct {
+	application app.App
+	aggr        *ingestion.Aggregator
+}
+
+func NewDeadLetterHandler(application app.App, aggr *ingestion.Aggregator) DeadLetterHandler {
+	return DeadLetterHandler{application: application, aggr: aggr}
+}
+
+const (
+	defaultDeadLetterListLimit = 100
+	maxDeadLetterListLimit     = 1000
+)
+
+type DeadLetterListResponse struct {
+	DeadLetters []repository.DeadLetterEvent `json:"dead_letters"`
+}
+
+type DeadLetterPurgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+// List returns the most recent dead letters of the project, the limit query parameter defaults to 100.
+func (h DeadLetterHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := newcontext.LoggerFromContext(ctx)
+	projectID, err := strconv.Atoi(chi.URLParam(r, "project_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit := defaultDeadLetterListLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxDeadLetterListLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	deadLetters, err := h.application.Repository.DeadLetterEventsList(ctx, uint(projectID), limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		if _, writeErr := w.Write(NewServerError(ctx, err)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	b, _ := json.Marshal(DeadLetterListResponse{DeadLetters: deadLetters})
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		logger.Error("writing response body failed", zap.Error(err))
+	}
+}
+
+// Read returns a dead letter including the payload of the event.
+func (h DeadLetterHandler) Read(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := newcontext.LoggerFromContext(ctx)
+	deadLetter, ok := h.find(w, r)
+	if !ok {
+		return
+	}
+	b, _ := json.Marshal(deadLetter)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		logger.Error("writing response body failed", zap.Error(err))
+	}
+}
+
+// Replay publishes the event of a dead letter to the ingestion queue again and deletes the dead letter.
+// The event is dead-lettered again if it fails once more.
+func (h DeadLetterHandler) Replay(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := newcontext.LoggerFromContext(ctx)
+	deadLetter, ok := h.find(w, r)
+	if !ok {
+		return
+	}
+	// The in-memory queue is only consumed by the worker of the same process, otherwise the replayed event
+	// would be dropped along with its dead letter
+	if h.application.IngestionQueueDriver() != ingestion.QueueDriverDatabase && !h.application.HasRole(app.RoleWorker) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if _, err := w.Write(NewJSONError("replaying requires the database ingestion queue or the worker role",
+			ErrorCodeDeadLetterReplayUnavailable)); err != nil {
+			logger.Error("writing response body failed", zap.Error(err))
+		}
+		return
+	}
+	if err := h.aggr.Replay(ctx, []byte(deadLetter.Payload)); err != nil {
+		switch {
+		case errors.Is(err, ingestion.ErrInvalidDeadLetter):
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			if _, writeErr := w.Write(NewJSONError(err.Error(), ErrorCodeDeadLetterNotReplayable)); writeErr != nil {
+				logger.Error("writing response body failed", zap.Error(writeErr))
+			}
+		case errors.Is(err, ingestion.ErrBackpressure):
+			w.Header().Set("Retry-After", strconv.Itoa(max(int(h.application.IngestionBackpressureRetryAfter().Seconds()), 1)))
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			if _, writeErr := w.Write(NewServerError(ctx, err)); writeErr != nil {
+				logger.Error("writing response body failed", zap.Error(writeErr))
+			}
+		}
+		return
+	}
+	if err := h.application.Repository.DeadLetterEventDelete(ctx, deadLetter.ProjectID, deadLetter.ID); err != nil &&
+		!errors.Is(err, repository.ErrRecordNotFound) {
+		// The event is already published, a failure to delete the dead letter only leaves a stale entry
+		logger.Error("failed to delete replayed dead letter", zap.Uint("id", deadLetter.ID), zap.Error(err))
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h DeadLetterHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectID, err := strconv.Atoi(chi.URLParam(r, "project_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := h.application.Repository.DeadLetterEventDelete(ctx, uint(projectID), uint(id)); err != nil {
+		if errors.Is(err, repository.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		if _, writeErr := w.Write(NewServerError(ctx, err)); writeErr != nil {
+			newcontext.LoggerFromContext(ctx).Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Purge deletes all dead letters of the project.
+func (h DeadLetterHandler) Purge(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := newcontext.LoggerFromContext(ctx)
+	projectID, err := strconv.Atoi(chi.URLParam(r, "project_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	purged, err := h.application.Repository.DeadLetterEventsPurge(ctx, uint(projectID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		if _, writeErr := w.Write(NewServerError(ctx, err)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	b, _ := json.Marshal(DeadLetterPurgeResponse{Purged: purged})
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		logger.Error("writing response body failed", zap.Error(err))
+	}
+}
+
+// find reads the dead letter of the request, writing the error response when it cannot be found.
+func (h DeadLetterHandler) find(w http.ResponseWriter, r *http.Request) (repository.DeadLetterEvent, bool) {
+	ctx := r.Context()
+	projectID, err := strconv.Atoi(chi.URLParam(r, "project_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return repository.DeadLetterEvent{}, false
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return repository.DeadLetterEvent{}, false
+	}
+	deadLetter, err := h.application.Repository.DeadLetterEventFindByID(ctx, uint(projectID), uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return repository.DeadLetterEvent{}, false
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		if _, writeErr := w.Write(NewServerError(ctx, err)); writeErr != nil {
+			newcontext.LoggerFromContext(ctx).Error("writing response body failed", zap.Error(writeErr))
+		}
+		return repository.DeadLetterEvent{}, false
+	}
+	return deadLetter, true
+}
+
+type EventGroupHandler struct {
+	application app.App
+	validate    *validator.Validate
+}
+
+func NewEventGroupHandler(application app.App) EventGroupHandler {
+	return EventGroupHandler{
+		application: application,
+		validate:    validator.New(validator.WithRequiredStructEnabled()),
+	}
+}
+
+// EventGroupUpdateRequest resolves or reopens an event group.
+type EventGroupUpdateRequest struct {
+	Resolved *bool `json:"resolved" validate:"required"`
+}
+
+type EventGroupResponse struct {
+	EventGroup repository.EventGroup `json:"event_group"`
+}
+
+func (h EventGroupHandler) Read(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectID, err := strconv.Atoi(chi.URLParam(r, "project_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	group, err := h.application.Repository.EventGroupFindByID(ctx, uint(projectID), uint(id))
+	h.respond(w, r, group, err)
+}
+
+// Update resolves the event group, or reopens it. Resolved groups are reopened when they receive new
+// events, otherwise they are deleted once the retention of resolved groups elapses.
+// The request model is EventGroupUpdateRequest.
+func (h EventGroupHandler) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := newcontext.LoggerFromContext(ctx)
+	projectID, err := strconv.Atoi(chi.URLParam(r, "project_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	req := EventGroupUpdateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		if _, writeErr := w.Write(NewJSONError("json decoding failed", ErrorCodeJSONDecodingFailed)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		if _, writeErr := w.Write(NewJSONError("validation failed", ErrorCodeValidationFailed)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	group, err := h.application.Repository.EventGroupUpdateResolved(ctx, uint(projectID), uint(id), *req.Resolved)
+	h.respond(w, r, group, err)
+}
+
+func (h EventGroupHandler) respond(w http.ResponseWriter, r *http.Request, group repository.EventGroup, err error) {
+	ctx := r.Context()
+	logger := newcontext.LoggerFromContext(ctx)
+	if err != nil {
+		if errors.Is(err, repository.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		if _, writeErr := w.Write(NewServerError(ctx, err)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	b, _ := json.Marshal(EventGroupResponse{EventGroup: group})
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		logger.Error("writing response body failed", zap.Error(err))
+	}
+}
+
+type RetentionHandler struct {
+	application app.App
+	retention   *retention.Retention
+	validate    *validator.Validate
+}
+
+func NewRetentionHandler(application app.App, r *retention.Retention) RetentionHandler {
+	return RetentionHandler{
+		application: application,
+		retention:   r,
+		validate:    validator.New(validator.WithRequiredStructEnabled()),
+	}
+}
+
+// ProjectRetentionUpdateRequest replaces the retention overrides of a project. Null values apply the
+// global default and zero keeps the data forever.
+type ProjectRetentionUpdateRequest struct {
+	EventDays         *int `json:"event_days" validate:"omitnil,gte=0"`
+	ResolvedGroupDays *int `json:"resolved_group_days" validate:"omitnil,gte=0"`
+}
+
+// EffectiveRetention is the retention applied to a project, after the global defaults.
+type EffectiveRetention struct {
+	EventDays         int `json:"event_days"`
+	ResolvedGroupDays int `json:"resolved_group_days"`
+}
+
+type ProjectRetentionResponse struct {
+	Retention repository.ProjectRetention `json:"retention"`
+	Effective EffectiveRetention          `json:"effective"`
+}
+
+type RetentionReportResponse struct {
+	LastPurge *retention.Report `json:"last_purge"`
+}
+
+func (h RetentionHandler) Read(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := newcontext.LoggerFromContext(ctx)
+	projectID, err := strconv.Atoi(chi.URLParam(r, "project_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	projectRetention, err := h.application.Repository.ProjectRetentionFindByProjectID(ctx, uint(projectID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		if _, writeErr := w.Write(NewServerError(ctx, err)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	h.respond(w, r, projectRetention)
+}
+
+// Update replaces the retention overrides of the project. The request model is ProjectRetentionUpdateRequest.
+func (h RetentionHandler) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := newcontext.LoggerFromContext(ctx)
+	projectID, err := strconv.Atoi(chi.URLParam(r, "project_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	req := ProjectRetentionUpdateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		if _, writeErr := w.Write(NewJSONError("json decoding failed", ErrorCodeJSONDecodingFailed)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		if _, writeErr := w.Write(NewJSONError("validation failed", ErrorCodeValidationFailed)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	projectRetention, err := h.application.Repository.ProjectRetentionUpdate(ctx, repository.ProjectRetention{
+		ProjectID:         uint(projectID),
+		EventDays:         req.EventDays,
+		ResolvedGroupDays: req.ResolvedGroupDays,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		if _, writeErr := w.Write(NewServerError(ctx, err)); writeErr != nil {
+			logger.Error("writing response body failed", zap.Error(writeErr))
+		}
+		return
+	}
+	h.respond(w, r, projectRetention)
+}
+
+// Report returns the rows deleted by the most recent purge of the process, which is null when the
+// process does not run the worker role or has not purged yet.
+func (h RetentionHandler) Report(w http.ResponseWriter, r *http.Request) {
+	logger := newcontext.LoggerFromContext(r.Context())
+	resp := RetentionReportResponse{}
+	if report, ok := h.retention.LastReport(); ok {
+		resp.LastPurge = &report
+	}
+	b, _ := json.Marshal(resp)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		logger.Error("writing response body failed", zap.Error(err))
+	}
+}
+
+func (h RetentionHandler) respond(w http.ResponseWriter, r *http.Request, projectRetention repository.ProjectRetention) {
+	logger := newcontext.LoggerFromContext(r.Context())
+	eventDays, resolvedGroupDays := h.retention.Policy(projectRetention)
+	b, _ := json.Marshal(ProjectRetentionResponse{
+		Retention: projectRetention,
+		Effective: EffectiveRetention{EventDays: eventDays, ResolvedGroupDays: resolvedGroupDays},
+	})
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		logger.Error("writing response body failed", zap.Error(err))
+	}
+}
@@ -0,0 +1,113 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const sentryAuthScheme = "sentry"
+
+// Protocol versions accepted in the sentry_version authentication parameter.
+const (
+	minSentryProtocolVersion = 5
+	maxSentryProtocolVersion = 7
+)
+
+var ErrMissingSentryAuth = errors.New("missing authorization information")
+var ErrInvalidSentryAuth = errors.New("bad sentry authentication")
+
+// SentryAuth holds the credentials and client information sent by Sentry SDKs,
+// either in the X-Sentry-Auth header or in the query string.
+type SentryAuth struct {
+	Version int
+	Key     string
+	Secret  string
+	Client  string
+}
+
+// ClientName returns the SDK name from the sentry_client parameter, e.g. "sentry.go" for "sentry.go/0.34.0".
+func (a SentryAuth) ClientName() string {
+	name, _, _ := strings.Cut(a.Client, "/")
+	return name
+}
+
+// ClientVersion returns the SDK version from the sentry_client parameter, e.g. "0.34.0" for "sentry.go/0.34.0".
+func (a SentryAuth) ClientVersion() string {
+	_, version, _ := strings.Cut(a.Client, "/")
+	return version
+}
+
+// ParseSentryAuth extracts the authentication parameters of an ingestion request. The X-Sentry-Auth header
+// takes precedence, followed by an Authorization header with the Sentry scheme and the query string.
+func ParseSentryAuth(r *http.Request) (SentryAuth, error) {
+	if h := strings.TrimSpace(r.Header.Get("X-Sentry-Auth")); h != "" {
+		return parseSentryAuthHeader(h)
+	}
+	if h := strings.TrimSpace(r.Header.Get("Authorization")); h != "" {
+		scheme, _, _ := strings.Cut(h, " ")
+		if strings.EqualFold(scheme, sentryAuthScheme) {
+			return parseSentryAuthHeader(h)
+		}
+	}
+	q := r.URL.Query()
+	if q.Get("sentry_key") == "" {
+		return SentryAuth{}, ErrMissingSentryAuth
+	}
+	params := make(map[string]string)
+	for _, name := range []string{"sentry_key", "sentry_secret", "sentry_version", "sentry_client"} {
+		params[name] = q.Get(name)
+	}
+	return newSentryAuth(params)
+}
+
+// ParseSentryAuthDSN extracts the public key and secret from a DSN, as sent in the envelope header by tunnels.
+func ParseSentryAuthDSN(dsn string) (SentryAuth, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.User.Username() == "" {
+		return SentryAuth{}, fmt.Errorf("%w: invalid dsn", ErrInvalidSentryAuth)
+	}
+	secret, _ := u.User.Password()
+	return SentryAuth{Key: u.User.Username(), Secret: secret}, nil
+}
+
+func parseSentryAuthHeader(header string) (SentryAuth, error) {
+	scheme, rest, found := strings.Cut(header, " ")
+	if found && strings.EqualFold(scheme, sentryAuthScheme) {
+		header = rest
+	}
+	params := make(map[string]string)
+	for _, part := range strings.Split(header, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		params[strings.TrimSpace(name)] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return newSentryAuth(params)
+}
+
+func newSentryAuth(params map[string]string) (SentryAuth, error) {
+	auth := SentryAuth{
+		Key:    params["sentry_key"],
+		Secret: params["sentry_secret"],
+		Client: params["sentry_client"],
+	}
+	if auth.Key == "" {
+		return SentryAuth{}, fmt.Errorf("%w: missing sentry_key", ErrInvalidSentryAuth)
+	}
+	if v := params["sentry_version"]; v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			return SentryAuth{}, fmt.Errorf("%w: invalid sentry_version %q", ErrInvalidSentryAuth, v)
+		}
+		if version < minSentryProtocolVersion || version > maxSentryProtocolVersion {
+			return SentryAuth{}, fmt.Errorf("%w: unsupported protocol version %d", ErrInvalidSentryAuth, version)
+		}
+		auth.Version = version
+	}
+	return auth, nil
+}
@@ -0,0 +1,137 @@
+package http
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+var ErrUnsupportedContentEncoding = errors.New("unsupported content encoding")
+var ErrInvalidRequestEncoding = errors.New("invalid request body encoding")
+
+type decompressedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (b decompressedBody) Close() error {
+	var errs []error
+	for _, c := range b.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// decodingReader wraps decompression errors so that handlers can tell them apart from server errors.
+type decodingReader struct {
+	reader io.Reader
+}
+
+func (r decodingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		var maxBytesErr *http.MaxBytesError
+		if !errors.As(err, &maxBytesErr) {
+			err = fmt.Errorf("%w: %w", ErrInvalidRequestEncoding, err)
+		}
+	}
+	return n, err
+}
+
+// DecompressRequestBody transparently decompresses request bodies sent with a gzip, deflate or br Content-Encoding.
+// Both the compressed and the decompressed body are limited to maxBodySize bytes, reads beyond the limit
+// return an *http.MaxBytesError.
+func DecompressRequestBody(maxBodySize int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+			raw := http.MaxBytesReader(w, r.Body, maxBodySize)
+			if encoding == "" || encoding == "identity" {
+				r.Body = raw
+				next.ServeHTTP(w, r)
+				return
+			}
+			decompressor, err := newDecompressor(encoding, raw)
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				switch {
+				case errors.Is(err, ErrUnsupportedContentEncoding):
+					w.WriteHeader(http.StatusUnsupportedMediaType)
+				case errors.As(err, &maxBytesErr):
+					w.WriteHeader(http.StatusRequestEntityTooLarge)
+				default:
+					w.WriteHeader(http.StatusBadRequest)
+				}
+				_, _ = w.Write(NewJSONError(err.Error(), ErrorCodeInvalidContentEncoding))
+				return
+			}
+			closers := []io.Closer{raw}
+			if c, ok := decompressor.(io.Closer); ok {
+				closers = append(closers, c)
+			}
+			r.Body = decompressedBody{
+				Reader:  http.MaxBytesReader(w, io.NopCloser(decodingReader{reader: decompressor}), maxBodySize),
+				closers: closers,
+			}
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func newDecompressor(encoding string, body io.Reader) (io.Reader, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidRequestEncoding, err)
+		}
+		return zr, nil
+	case "deflate":
+		// RFC 9110 defines deflate as zlib-wrapped, however some clients send raw deflate streams.
+		br := bufio.NewReader(body)
+		header, err := br.Peek(2)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidRequestEncoding, err)
+		}
+		if isZlibHeader(header) {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidRequestEncoding, err)
+			}
+			return zr, nil
+		}
+		return flate.NewReader(br), nil
+	case "br":
+		return brotli.NewReader(body), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedContentEncoding, encoding)
+	}
+}
+
+func isZlibHeader(b []byte) bool {
+	return b[0]&0x0f == 8 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
+
+// requestBodyStatusCode maps errors that occurred while reading the request body to a response status code.
+func requestBodyStatusCode(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrInvalidRequestEncoding):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
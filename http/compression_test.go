@@ -0,0 +1,134 @@
+package http
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compress(t *testing.T, encoding string, payload []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		require.NoError(t, err)
+		w = fw
+	case "br":
+		w = brotli.NewWriter(&buf)
+	default:
+		return payload
+	}
+	_, err := w.Write(payload)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestDecompressRequestBody(t *testing.T) {
+	payload := []byte(strings.Repeat(`{"message":"hello"}`, 10))
+	tests := []struct {
+		name           string
+		contentEnc     string
+		body           []byte
+		maxBodySize    int64
+		wantStatusCode int
+		wantBody       []byte
+	}{
+		{
+			name:           "identity",
+			body:           payload,
+			maxBodySize:    1024,
+			wantStatusCode: http.StatusOK,
+			wantBody:       payload,
+		},
+		{
+			name:           "gzip",
+			contentEnc:     "gzip",
+			body:           compress(t, "gzip", payload),
+			maxBodySize:    1024,
+			wantStatusCode: http.StatusOK,
+			wantBody:       payload,
+		},
+		{
+			name:           "zlib deflate",
+			contentEnc:     "deflate",
+			body:           compress(t, "deflate", payload),
+			maxBodySize:    1024,
+			wantStatusCode: http.StatusOK,
+			wantBody:       payload,
+		},
+		{
+			name:           "raw deflate",
+			contentEnc:     "deflate",
+			body:           compress(t, "raw-deflate", payload),
+			maxBodySize:    1024,
+			wantStatusCode: http.StatusOK,
+			wantBody:       payload,
+		},
+		{
+			name:           "brotli",
+			contentEnc:     "br",
+			body:           compress(t, "br", payload),
+			maxBodySize:    1024,
+			wantStatusCode: http.StatusOK,
+			wantBody:       payload,
+		},
+		{
+			name:           "unsupported encoding",
+			contentEnc:     "compress",
+			body:           payload,
+			maxBodySize:    1024,
+			wantStatusCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:           "corrupt gzip stream",
+			contentEnc:     "gzip",
+			body:           payload,
+			maxBodySize:    1024,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "decompressed size exceeds limit",
+			contentEnc:     "gzip",
+			body:           compress(t, "gzip", bytes.Repeat([]byte("a"), 1<<20)),
+			maxBodySize:    4096,
+			wantStatusCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := DecompressRequestBody(tt.maxBodySize)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, err := io.ReadAll(r.Body)
+				if err != nil {
+					w.WriteHeader(requestBodyStatusCode(err))
+					return
+				}
+				assert.Equal(t, tt.wantBody, b)
+				w.WriteHeader(http.StatusOK)
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/api/1/envelope", bytes.NewReader(tt.body))
+			if tt.contentEnc != "" {
+				req.Header.Set("Content-Encoding", tt.contentEnc)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantStatusCode, rec.Code)
+		})
+	}
+}
@@ -13,6 +13,9 @@ import (
 const ErrorCodeServerError = 500
 const ErrorCodeJSONDecodingFailed = 1001
 const ErrorCodeValidationFailed = 1002
+const ErrorCodeInvalidContentEncoding = 1003
+const ErrorCodeDeadLetterNotReplayable = 1004
+const ErrorCodeDeadLetterReplayUnavailable = 1005
 
 type Error struct {
 	Message string `json:"message"`
@@ -27,6 +30,19 @@ func NewJSONError(message string, code int) []byte {
 	return b
 }
 
+// SentryError is the error response body format understood by Sentry SDKs.
+type SentryError struct {
+	Detail string `json:"detail"`
+}
+
+func NewSentryJSONError(detail string) []byte {
+	b, err := json.Marshal(SentryError{Detail: detail})
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
 func NewServerError(ctx context.Context, err error) []byte {
 	logger := newcontext.LoggerFromContext(ctx)
 	logCtx := []zap.Field{zap.Error(err)}
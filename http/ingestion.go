@@ -1,77 +1,336 @@
 package http
 
 import (
-	"bufio"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 
 	"github.com/georgepsarakis/periscope/app"
 	"github.com/georgepsarakis/periscope/ingestion"
+	"github.com/georgepsarakis/periscope/repository"
 )
 
 type EventHandler struct {
-	app  app.App
-	aggr *ingestion.Aggregator
+	app     app.App
+	aggr    *ingestion.Aggregator
+	quotas  *ingestion.Quotas
+	filters *ingestion.InboundFilters
 }
 
-func NewEventHandler(app app.App, aggr *ingestion.Aggregator) EventHandler {
-	return EventHandler{app: app, aggr: aggr}
+func NewEventHandler(app app.App, aggr *ingestion.Aggregator, quotas *ingestion.Quotas, filters *ingestion.InboundFilters) EventHandler {
+	return EventHandler{app: app, aggr: aggr, quotas: quotas, filters: filters}
+}
+
+type EnvelopeResponse struct {
+	ID       string                    `json:"id,omitempty"`
+	Rejected []ingestion.ItemRejection `json:"rejected_items,omitempty"`
 }
 
 func (h EventHandler) IngestionHandler() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
+		receivedAt := time.Now().UTC()
 		logger := h.app.Logger
-		var ev Event
 		defer r.Body.Close() //nolint:errcheck
-		scanner := bufio.NewReader(r.Body)
-		// Skip two lines
-		for range 2 {
-			if _, _, err := scanner.ReadLine(); err != nil {
-				logger.Error("unable to scan lines", zap.Error(err))
+		envelope, err := ingestion.NewEnvelopeReader(r.Body)
+		if err != nil {
+			if errors.Is(err, ingestion.ErrInvalidEnvelope) {
+				w.WriteHeader(http.StatusBadRequest)
+			} else {
+				w.WriteHeader(requestBodyStatusCode(err))
 			}
+			logger.Error("invalid envelope", zap.Error(err))
+			return
 		}
-		if err := json.NewDecoder(scanner).Decode(&ev); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			logger.Error(err.Error())
+		project, auth, ok := h.authorize(w, r, envelope.Header().DSN)
+		if !ok {
 			return
 		}
-		projectID := chi.URLParam(r, "project_id")
 
-		project, err := h.app.Repository.ProjectFindByPublicID(ctx, projectID)
+		resp := EnvelopeResponse{}
+		if headerEventID := envelope.Header().EventID; headerEventID != "" {
+			resp.ID, _ = ingestion.NormalizeEventID(headerEventID)
+		}
+		// Events are published once the whole envelope is accepted, since SDKs retry rejected envelopes
+		// and published events would be stored twice.
+		var messages []ingestion.ProjectEventMessage
+		dispatcher := ingestion.NewEnvelopeDispatcher()
+		dispatcher.Handle(ingestion.EnvelopeItemTypeEvent, func(header ingestion.EnvelopeHeader, item ingestion.EnvelopeItem) error {
+			var ev Event
+			if err := json.Unmarshal(item.Payload, &ev); err != nil {
+				return fmt.Errorf("%w: %w", ingestion.ErrInvalidEnvelopeItem, err)
+			}
+			if ev.EventId == "" {
+				ev.EventId = header.EventID
+			}
+			eventID, err := ingestion.NormalizeEventID(ev.EventId)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ingestion.ErrInvalidEnvelopeItem, err)
+			}
+			ev.EventId = eventID
+			if resp.ID == "" {
+				resp.ID = ev.EventId
+			}
+			messages = append(messages, ingestion.ProjectEventMessage{
+				ProjectID:  project.ID,
+				Event:      ingestion.Event(ev),
+				Payload:    item.Payload,
+				Client:     ingestion.ClientInfo{Name: auth.ClientName(), Version: auth.ClientVersion()},
+				ReceivedAt: receivedAt,
+			})
+			return nil
+		})
+		report, err := dispatcher.Dispatch(envelope)
+		if err == nil {
+			for _, msg := range messages {
+				if err = h.publish(r.Context(), msg); err != nil {
+					break
+				}
+			}
+		}
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			logger.Error("invalid project ID", zap.Error(err))
+			if errors.Is(err, ingestion.ErrInvalidEnvelope) {
+				w.WriteHeader(http.StatusBadRequest)
+				logger.Error("invalid envelope", zap.Error(err))
+				return
+			}
+			if isTooManyRequests(err) {
+				h.writeTooManyRequests(w, err)
+				return
+			}
+			w.WriteHeader(requestBodyStatusCode(err))
+			logger.Error("failed to process envelope", zap.Error(err))
 			return
 		}
+		for _, rejection := range report.Rejected {
+			logger.Warn("envelope item rejected",
+				zap.Uint("project_id", project.ID),
+				zap.Int("index", rejection.Index),
+				zap.String("type", rejection.Type),
+				zap.String("reason", rejection.Reason))
+		}
+		resp.Rejected = report.Rejected
+
+		h.writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+type StoreResponse struct {
+	ID string `json:"id"`
+}
 
-		authHeader := strings.TrimSpace(r.Header.Get("X-Sentry-Auth"))
-		if authHeader == "" {
-			w.WriteHeader(http.StatusUnauthorized)
+// StoreHandler accepts single JSON events on the legacy store endpoint, used by older SDKs that do not
+// support envelopes.
+func (h EventHandler) StoreHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		receivedAt := time.Now().UTC()
+		logger := h.app.Logger
+		defer r.Body.Close() //nolint:errcheck
+		project, auth, ok := h.authorize(w, r, "")
+		if !ok {
 			return
 		}
-		// TODO: properly parse auth header
-		parts := strings.Split(authHeader, "sentry_key=")
-		if len(parts) < 2 {
-			w.WriteHeader(http.StatusUnauthorized)
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(requestBodyStatusCode(err))
+			logger.Error("failed to read request body", zap.Error(err))
 			return
 		}
-		if !project.HasAccess(parts[1]) {
-			w.WriteHeader(http.StatusForbidden)
+		payload, err := decodeStorePayload(body, h.app.HTTPMaxRequestBodySize())
+		if err != nil {
+			w.WriteHeader(requestBodyStatusCode(err))
+			logger.Error("failed to decode store payload", zap.Error(err))
 			return
 		}
-
-		publishedEvent := ingestion.Event(ev)
-		if err := h.aggr.Publish(project.ID, publishedEvent); err != nil {
+		var ev Event
+		if err := json.Unmarshal(payload, &ev); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			logger.Error("invalid event payload", zap.Error(err))
+			return
+		}
+		ev.EventId, err = ingestion.NormalizeEventID(ev.EventId)
+		if err != nil {
+			h.writeSentryError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		msg := ingestion.ProjectEventMessage{
+			ProjectID:  project.ID,
+			Event:      ingestion.Event(ev),
+			Payload:    payload,
+			Client:     ingestion.ClientInfo{Name: auth.ClientName(), Version: auth.ClientVersion()},
+			ReceivedAt: receivedAt,
+		}
+		err = h.publish(r.Context(), msg)
+		if isTooManyRequests(err) {
+			h.writeTooManyRequests(w, err)
+			return
+		}
+		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			logger.Error("failed to publish event", zap.Error(err))
 			return
 		}
+		h.writeJSON(w, http.StatusOK, StoreResponse{ID: ev.EventId})
+	}
+}
+
+// decodeStorePayload handles the legacy raven encoding, where the JSON event is zlib-compressed and base64-encoded.
+func decodeStorePayload(body []byte, maxSize int64) ([]byte, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] == '{' {
+		return body, nil
+	}
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(len(body)))
+	n, err := base64.StdEncoding.Decode(decoded, body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRequestEncoding, err)
+	}
+	decoded = decoded[:n]
+	if len(decoded) < 2 || !isZlibHeader(decoded) {
+		return decoded, nil
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(decoded))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRequestEncoding, err)
+	}
+	defer zr.Close() //nolint:errcheck
+	payload, err := io.ReadAll(io.LimitReader(zr, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRequestEncoding, err)
+	}
+	if int64(len(payload)) > maxSize {
+		return nil, &http.MaxBytesError{Limit: maxSize}
+	}
+	return payload, nil
+}
+
+// authorize resolves the project from the URL and verifies the ingestion credentials of the request.
+// Envelopes forwarded by tunnels carry no credentials in the request, in which case the DSN from the
+// envelope header is used. When false is returned, the response has already been written.
+func (h EventHandler) authorize(w http.ResponseWriter, r *http.Request, envelopeDSN string) (repository.Project, SentryAuth, bool) {
+	logger := h.app.Logger
+	projectID := chi.URLParam(r, "project_id")
+
+	project, err := h.app.Repository.ProjectFindByPublicID(r.Context(), projectID)
+	if err != nil {
+		h.writeSentryError(w, http.StatusBadRequest, "invalid project id")
+		logger.Error("invalid project ID", zap.Error(err))
+		return repository.Project{}, SentryAuth{}, false
+	}
+
+	auth, err := ParseSentryAuth(r)
+	if errors.Is(err, ErrMissingSentryAuth) && envelopeDSN != "" {
+		auth, err = ParseSentryAuthDSN(envelopeDSN)
+	}
+	if err != nil {
+		h.writeSentryError(w, http.StatusUnauthorized, err.Error())
+		return repository.Project{}, SentryAuth{}, false
+	}
+	if project.RequireIngestionSecret {
+		if !project.HasSecretAccess(auth.Key, auth.Secret) {
+			h.writeSentryError(w, http.StatusForbidden, "invalid sentry_key or sentry_secret")
+			return repository.Project{}, SentryAuth{}, false
+		}
+	} else if !project.HasAccess(auth.Key) {
+		h.writeSentryError(w, http.StatusForbidden, "invalid sentry_key")
+		return repository.Project{}, SentryAuth{}, false
+	}
+	return project, auth, true
+}
+
+func (h EventHandler) writeSentryError(w http.ResponseWriter, statusCode int, detail string) {
+	w.WriteHeader(statusCode)
+	if _, err := w.Write(NewSentryJSONError(detail)); err != nil {
+		h.app.Logger.Error("writing response body failed", zap.Error(err))
+	}
+}
+
+// publish applies the inbound filters and enforces the project limits before publishing the event.
+// Filtered and duplicate events are discarded silently, and filtered events do not count against the quotas.
+func (h EventHandler) publish(ctx context.Context, msg ingestion.ProjectEventMessage) error {
+	filter, filtered, err := h.filters.Match(ctx, msg.ProjectID, msg.Event)
+	if err != nil {
+		return err
+	}
+	if filtered {
+		h.app.Logger.Debug("event filtered",
+			zap.Uint("project_id", msg.ProjectID),
+			zap.String("event_id", msg.Event.EventId),
+			zap.Uint("filter_id", filter.ID),
+			zap.String("filter_type", filter.Type))
+		h.quotas.Record(msg.ProjectID, repository.OutcomeFiltered)
+		return nil
+	}
+	if err := h.quotas.Check(ctx, msg.ProjectID); err != nil {
+		return err
+	}
+	err = h.aggr.Publish(ctx, msg)
+	if err != nil {
+		h.quotas.Release(msg.ProjectID)
+	}
+	if errors.Is(err, ingestion.ErrDuplicateEvent) {
+		h.app.Logger.Debug("duplicate event discarded",
+			zap.Uint("project_id", msg.ProjectID), zap.String("event_id", msg.Event.EventId))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	h.quotas.Record(msg.ProjectID, repository.OutcomeAccepted)
+	return nil
+}
+
+func isTooManyRequests(err error) bool {
+	return errors.Is(err, ingestion.ErrBackpressure) ||
+		errors.Is(err, ingestion.ErrRateLimited) ||
+		errors.Is(err, ingestion.ErrOverQuota)
+}
+
+// writeTooManyRequests rejects the request when a project limit is exceeded or too many events are pending.
+// SDKs honor the rate limit headers and stop sending events of the limited categories for the given
+// number of seconds.
+func (h EventHandler) writeTooManyRequests(w http.ResponseWriter, err error) {
+	retryAfter := h.app.IngestionBackpressureRetryAfter()
+	// An empty list of categories applies to all of them
+	categories, scope, reason := "", "project", "backpressure"
+	var bpErr ingestion.BackpressureError
+	var limitErr ingestion.LimitError
+	switch {
+	case errors.As(err, &bpErr):
+		if bpErr.Global() {
+			scope = "organization"
+		}
+	case errors.As(err, &limitErr):
+		retryAfter = limitErr.RetryAfter
+		categories = "error"
+		reason = string(limitErr.Outcome)
+	}
+	seconds := max(int(math.Ceil(retryAfter.Seconds())), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.Header().Set("X-Sentry-Rate-Limits", fmt.Sprintf("%d:%s:%s:%s", seconds, categories, scope, reason))
+	h.app.Logger.Warn("event rejected", zap.String("reason", reason), zap.Error(err))
+	h.writeSentryError(w, http.StatusTooManyRequests, err.Error())
+}
 
-		w.WriteHeader(http.StatusOK)
+func (h EventHandler) writeJSON(w http.ResponseWriter, statusCode int, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(statusCode)
+	if _, err := w.Write(b); err != nil {
+		h.app.Logger.Error("writing response body failed", zap.Error(err))
 	}
 }
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeStorePayload(t *testing.T) {
+	event := `{"event_id":"fc6d8c0c43fc4630ad850ee518f1b9d0","message":"hello"}`
+	tests := []struct {
+		name    string
+		body    string
+		maxSize int64
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "plain JSON",
+			body:    "  " + event + "\n",
+			maxSize: 1024,
+			want:    event,
+		},
+		{
+			name:    "base64-encoded JSON",
+			body:    base64.StdEncoding.EncodeToString([]byte(event)),
+			maxSize: 1024,
+			want:    event,
+		},
+		{
+			name:    "base64-encoded zlib-compressed JSON",
+			body:    base64.StdEncoding.EncodeToString(compress(t, "deflate", []byte(event))),
+			maxSize: 1024,
+			want:    event,
+		},
+		{
+			name:    "invalid base64",
+			body:    "%%%",
+			maxSize: 1024,
+			wantErr: ErrInvalidRequestEncoding,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeStorePayload([]byte(tt.body), tt.maxSize)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+
+	t.Run("decompressed size exceeds limit", func(t *testing.T) {
+		body := base64.StdEncoding.EncodeToString(compress(t, "deflate", []byte(event)))
+		_, err := decodeStorePayload([]byte(body), 10)
+		var maxBytesErr *http.MaxBytesError
+		assert.ErrorAs(t, err, &maxBytesErr)
+	})
+}
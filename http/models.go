@@ -14,10 +14,12 @@ type ProjectEventMessage struct {
 }
 
 type Project struct {
-	ID               uint      `json:"id"`
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
-	Name             string    `json:"name"`
-	IngestionAPIKeys []string  `json:"ingestion_api_keys"`
-	PublicID         string    `json:"public_id"`
+	ID                     uint      `json:"id"`
+	CreatedAt              time.Time `json:"created_at"`
+	UpdatedAt              time.Time `json:"updated_at"`
+	Name                   string    `json:"name"`
+	IngestionAPIKeys       []string  `json:"ingestion_api_keys"`
+	IngestionAPISecrets    []string  `json:"ingestion_api_secrets,omitempty"`
+	RequireIngestionSecret bool      `json:"require_ingestion_secret"`
+	PublicID               string    `json:"public_id"`
 }
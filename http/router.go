@@ -69,7 +69,11 @@ func NewRouter(application app.App) *chi.Mux {
 	r.Use(middleware.CleanPath)
 	r.Use(middleware.AllowContentType(
 		"application/x-sentry-envelope",
-		"application/json"))
+		"application/json",
+		// Legacy store endpoint clients
+		"application/octet-stream",
+		"text/plain"))
+	r.Use(DecompressRequestBody(application.HTTPMaxRequestBodySize()))
 	if application.DebugEnabled() {
 		r.Use(func(next http.Handler) http.Handler {
 			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
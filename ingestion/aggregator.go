@@ -1,35 +1,70 @@
 package ingestion
 
 import (
+	"cmp"
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash"
+	"hash/fnv"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/coocood/freecache"
 	"go.uber.org/zap"
 
 	"github.com/georgepsarakis/periscope/newcontext"
+	"github.com/georgepsarakis/periscope/repository"
 )
 
 const topicNameEvents = "ingestion.raw_events"
 
+// MetadataPartitionKey is the message metadata key holding the project ID of an event.
+const MetadataPartitionKey = "partition_key"
+
 type Aggregator struct {
 	logger               *zap.Logger
+	options              AggregatorOptions
 	fingerprintGenerator FingerprintGenerator
-	queue                map[GlobalEventKey][]AggregatedEvent
-	lock                 *sync.RWMutex
-	pubsub               *pubsub
+	fingerprintRules     FingerprintRuleProvider
+	patterns             *patternCache
+	seenEvents           *freecache.Cache
+	pending              *pendingEvents
+	sharedDepth          *sharedDepth
+	shards               []*aggregatorShard
+	sequence             atomic.Uint64
+	// progress holds, for each consumer worker, the next sequence the worker has to complete.
+	progress []atomic.Uint64
+	// size is the number of aggregated events that are not flushed yet.
+	size          atomic.Int64
+	flushRequests chan struct{}
+	// heldBack is set when Flush keeps events of groups with events still being processed.
+	heldBack   atomic.Bool
+	flushStats *flushStats
+	pubsub     *pubsub
+}
+
+// aggregatorShard holds the events of the groups whose key hashes to the shard, so that consumers
+// enqueueing events of different groups rarely contend for the same lock.
+type aggregatorShard struct {
+	lock  sync.Mutex
+	queue map[GlobalEventKey][]AggregatedEvent
 }
 
 type pubsub struct {
-	topic        *gochannel.GoChannel
+	queue        Queue
+	durable      bool
 	subscription <-chan *message.Message
 }
 
@@ -50,34 +85,190 @@ func (g GlobalEventKey) String() string {
 type AggregatedEvent struct {
 	AggregationKey GlobalEventKey `json:"aggregation_key"`
 	ProjectEvent   ProjectEvent   `json:"project_event"`
+	// message is the queue message of a durable queue, acknowledged once the event is persisted.
+	message *message.Message
+	// sequence is the delivery order of the event, consumers enqueue events concurrently.
+	sequence uint64
+	// payload is the queued event message, stored when the event is dead-lettered.
+	payload []byte
+	// attempts is the number of failed attempts to persist the event, retryAt delays the next one.
+	attempts int
+	retryAt  time.Time
+}
+
+// Ack acknowledges the queue message of the event, after it has been persisted or discarded.
+func (e AggregatedEvent) Ack() {
+	if e.message != nil {
+		e.message.Ack()
+	}
+}
+
+// Nack rejects the queue message of the event, so that it is delivered again.
+func (e AggregatedEvent) Nack() {
+	if e.message != nil {
+		e.message.Nack()
+	}
 }
 
 const fingerprintDelimiter = "/"
 
-func NewAggregator(logger *zap.Logger) *Aggregator {
-	topic := gochannel.NewGoChannel(gochannel.Config{}, nil)
+// AggregatorOptions configures an Aggregator, zero values are replaced with the defaults.
+type AggregatorOptions struct {
+	// MaxFutureSkew is how far ahead of the receive time an event timestamp can be.
+	MaxFutureSkew time.Duration
+	// MaxEventAge is how far behind the receive time an event timestamp can be, e.g. for events
+	// buffered by an SDK while offline.
+	MaxEventAge time.Duration
+	// DeduplicationWindow is how long published event IDs are remembered to discard retried submissions.
+	DeduplicationWindow time.Duration
+	// Queue transports the published events, an in-memory channel is used when nil.
+	Queue Queue
+	// MaxPendingEvents limits the events that are published and not persisted yet, across all projects.
+	MaxPendingEvents int
+	// MaxPendingEventsPerProject limits the pending events of each project, so that a single project
+	// cannot exhaust the global limit.
+	MaxPendingEventsPerProject int
+	// Consumers is the number of workers processing the events received from the queue.
+	Consumers int
+	// Shards is the number of partitions of the aggregated events, each one with a separate lock.
+	Shards int
+	// FlushMaxEvents requests a flush once this many events are aggregated, before the flush interval elapses.
+	FlushMaxEvents int
+	// FlushMaxGroupEvents requests a flush once a single group has this many aggregated events.
+	FlushMaxGroupEvents int
+	// DeadLetters stores the events that cannot be processed or persisted, when nil they are only logged.
+	DeadLetters DeadLetterStore
+	// RetryMaxAttempts is the number of attempts to persist an event before it is dead-lettered.
+	RetryMaxAttempts int
+	// RetryBackoff is the delay after the first failed attempt, doubled after each attempt up to RetryMaxBackoff.
+	RetryBackoff    time.Duration
+	RetryMaxBackoff time.Duration
+}
+
+const (
+	DefaultMaxFutureSkew       = time.Minute
+	DefaultMaxEventAge         = 30 * 24 * time.Hour
+	DefaultDeduplicationWindow = 5 * time.Minute
+	DefaultAggregatorShards    = 64
+	DefaultFlushMaxEvents      = 1000
+	DefaultFlushMaxGroupEvents = 100
+	DefaultRetryMaxAttempts    = 5
+	DefaultRetryBackoff        = time.Second
+	DefaultRetryMaxBackoff     = 30 * time.Second
+)
+
+// seenEventsCacheSize is the memory used to remember published event IDs, roughly 100k entries.
+const seenEventsCacheSize = 8 * 1024 * 1024
+
+// ErrDuplicateEvent is returned by Publish for an event ID that was already published within the
+// deduplication window.
+var ErrDuplicateEvent = errors.New("duplicate event")
+
+func (o AggregatorOptions) withDefaults() AggregatorOptions {
+	if o.MaxFutureSkew <= 0 {
+		o.MaxFutureSkew = DefaultMaxFutureSkew
+	}
+	if o.MaxEventAge <= 0 {
+		o.MaxEventAge = DefaultMaxEventAge
+	}
+	if o.DeduplicationWindow <= 0 {
+		o.DeduplicationWindow = DefaultDeduplicationWindow
+	}
+	if o.MaxPendingEvents <= 0 {
+		o.MaxPendingEvents = DefaultMaxPendingEvents
+	}
+	if o.MaxPendingEventsPerProject <= 0 {
+		o.MaxPendingEventsPerProject = DefaultMaxPendingEventsPerProject
+	}
+	if o.Consumers <= 0 {
+		o.Consumers = runtime.NumCPU()
+	}
+	if o.Shards <= 0 {
+		o.Shards = DefaultAggregatorShards
+	}
+	if o.FlushMaxEvents <= 0 {
+		o.FlushMaxEvents = DefaultFlushMaxEvents
+	}
+	if o.FlushMaxGroupEvents <= 0 {
+		o.FlushMaxGroupEvents = DefaultFlushMaxGroupEvents
+	}
+	if o.RetryMaxAttempts <= 0 {
+		o.RetryMaxAttempts = DefaultRetryMaxAttempts
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = DefaultRetryBackoff
+	}
+	if o.RetryMaxBackoff <= 0 {
+		o.RetryMaxBackoff = DefaultRetryMaxBackoff
+	}
+	return o
+}
+
+// NewAggregator creates an Aggregator. The rule provider is optional, when nil no fingerprint rules are applied.
+func NewAggregator(logger *zap.Logger, rules FingerprintRuleProvider, opts AggregatorOptions) *Aggregator {
+	opts = opts.withDefaults()
+	queue := opts.Queue
+	if queue == nil {
+		queue = gochannel.NewGoChannel(gochannel.Config{}, nil)
+	}
+	durable := false
+	if q, ok := queue.(durableQueue); ok {
+		durable = q.Durable()
+	}
+	var shared *sharedDepth
+	if r, ok := queue.(depthReporter); ok {
+		shared = &sharedDepth{reporter: r}
+	}
+	shards := make([]*aggregatorShard, opts.Shards)
+	for i := range shards {
+		shards[i] = &aggregatorShard{queue: newQueue()}
+	}
+	progress := make([]atomic.Uint64, opts.Consumers)
+	for i := range progress {
+		// Sequences start from one and worker i processes the sequences that are congruent to i
+		if i == 0 {
+			progress[i].Store(uint64(opts.Consumers))
+		} else {
+			progress[i].Store(uint64(i))
+		}
+	}
 	return &Aggregator{
-		logger: logger,
+		logger:           logger,
+		options:          opts,
+		fingerprintRules: rules,
+		patterns:         &patternCache{},
+		seenEvents:       freecache.NewCache(seenEventsCacheSize),
+		pending:          newPendingEvents(),
+		sharedDepth:      shared,
 		pubsub: &pubsub{
-			topic: topic,
+			queue:   queue,
+			durable: durable,
 		},
-		lock: &sync.RWMutex{},
+		shards:        shards,
+		progress:      progress,
+		flushRequests: make(chan struct{}, 1),
+		flushStats:    newFlushStats(),
 		fingerprintGenerator: FingerprintGenerator{
 			hasher: sha1.New,
 			normalizer: func(elements []string) string {
 				return fingerprintDelimiter + strings.Join(elements, fingerprintDelimiter) + fingerprintDelimiter
 			},
 		},
-		queue: newQueue(),
 	}
 }
 
 func newQueue() map[GlobalEventKey][]AggregatedEvent {
-	return make(map[GlobalEventKey][]AggregatedEvent, 1000)
+	return make(map[GlobalEventKey][]AggregatedEvent, 64)
+}
+
+func (a *Aggregator) shard(key GlobalEventKey) *aggregatorShard {
+	h := fnv.New32a()
+	h.Write([]byte(key.String()))
+	return a.shards[h.Sum32()%uint32(len(a.shards))]
 }
 
 func (a *Aggregator) Subscribe(ctx context.Context) error {
-	s, err := a.pubsub.topic.Subscribe(ctx, topicNameEvents)
+	s, err := a.pubsub.queue.Subscribe(ctx, topicNameEvents)
 	if err != nil {
 		return err
 	}
@@ -85,40 +276,127 @@ func (a *Aggregator) Subscribe(ctx context.Context) error {
 	return nil
 }
 
+// delivery is a received message, numbered in the order it was received from the queue.
+type delivery struct {
+	msg      *message.Message
+	sequence uint64
+}
+
+// deliveryBuffer is the number of messages waiting for each consumer worker.
+const deliveryBuffer = 16
+
+// Consumer receives the events from the queue and processes them with concurrent workers. Events are
+// numbered as they are received and assigned to the workers in turn, so that Flush can hold back the
+// events that were received after an event still being processed, preserving the order of each group.
 func (a *Aggregator) Consumer(ctx context.Context) func() error {
 	return func() error {
 		appLogger := newcontext.LoggerFromContext(ctx)
-		appLogger.Info("starting aggregator consumer")
+		appLogger.Info("starting aggregator consumer", zap.Int("workers", a.options.Consumers))
+		workers := make([]chan delivery, a.options.Consumers)
+		var wg sync.WaitGroup
+		for i := range workers {
+			workers[i] = make(chan delivery, deliveryBuffer)
+			wg.Add(1)
+			go func(deliveries <-chan delivery) {
+				defer wg.Done()
+				for d := range deliveries {
+					a.consume(ctx, d.msg, d.sequence)
+					a.progress[i].Store(d.sequence + uint64(len(workers)))
+					if a.heldBack.CompareAndSwap(true, false) {
+						// The events kept by the previous flush may be complete now
+						a.requestFlush()
+					}
+				}
+			}(workers[i])
+		}
+		defer wg.Wait()
+		defer func() {
+			for _, w := range workers {
+				close(w)
+			}
+		}()
 		for {
 			select {
 			case <-ctx.Done():
 				appLogger.Info("aggregator consumer shutdown due to context cancellation", zap.Error(ctx.Err()))
 				return nil
-			case msg := <-a.pubsub.subscription:
-				// we need to Acknowledge that we received and processed the message,
-				// otherwise, it will be resent over and over again.
-				appLogger.Info(
-					fmt.Sprintf("received message: %s, payload: %s\n", msg.UUID, string(msg.Payload)))
-				ev := ProjectEventMessage{}
-				err := json.Unmarshal(msg.Payload, &ev)
-				if err != nil {
-					appLogger.Error("failed to unmarshal event", zap.Error(err))
-				} else {
-					pev, err := a.Extract(ev)
-					if err != nil {
-						appLogger.Error("failed to process event", zap.Error(err))
-					}
-					a.Enqueue(AggregatedEvent{
-						AggregationKey: GlobalEventKey{ProjectID: pev.ProjectID, Hash: pev.Fingerprint},
-						ProjectEvent:   pev,
-					})
+			case msg, ok := <-a.pubsub.subscription:
+				if !ok {
+					appLogger.Info("aggregator consumer shutdown due to closed subscription")
+					return nil
 				}
-				msg.Ack()
+				appLogger.Debug("received message",
+					zap.String("uuid", msg.UUID), zap.ByteString("payload", msg.Payload))
+				if !a.pubsub.durable {
+					// The in-memory channel delivers the next message once the current one is acknowledged
+					msg.Ack()
+				}
+				sequence := a.sequence.Add(1)
+				workers[sequence%uint64(len(workers))] <- delivery{msg: msg, sequence: sequence}
 			}
 		}
 	}
 }
 
+// consume enqueues the event of a message. Messages of a durable queue are acknowledged once the event is
+// persisted, in-memory messages are acknowledged by Consumer when received. A zero sequence marks an event
+// that is not ordered against the events received by Consumer.
+func (a *Aggregator) consume(ctx context.Context, msg *message.Message, sequence uint64) {
+	appLogger := newcontext.LoggerFromContext(ctx)
+	ev := ProjectEventMessage{}
+	if err := json.Unmarshal(msg.Payload, &ev); err != nil {
+		// Malformed messages cannot be processed on redelivery either
+		appLogger.Error("failed to unmarshal event", zap.Error(err))
+		projectID, _ := strconv.ParseUint(msg.Metadata.Get(MetadataPartitionKey), 10, 64)
+		a.reject(msg, repository.DeadLetterEvent{
+			ProjectID: uint(projectID),
+			Stage:     repository.DeadLetterStageDecode,
+			Error:     err.Error(),
+			Attempts:  1,
+			Payload:   string(msg.Payload),
+		})
+		return
+	}
+	pev, err := a.Extract(ctx, ev)
+	if err != nil {
+		appLogger.Error("failed to process event", zap.Error(err))
+		a.reject(msg, repository.DeadLetterEvent{
+			ProjectID: ev.ProjectID,
+			EventID:   ev.Event.EventId,
+			Stage:     repository.DeadLetterStageExtract,
+			Error:     err.Error(),
+			Attempts:  1,
+			Payload:   string(msg.Payload),
+		})
+		return
+	}
+	ae := AggregatedEvent{
+		AggregationKey: GlobalEventKey{ProjectID: pev.ProjectID, Hash: pev.Fingerprint},
+		ProjectEvent:   pev,
+		sequence:       sequence,
+		payload:        msg.Payload,
+	}
+	if a.pubsub.durable {
+		ae.message = msg
+	}
+	a.Enqueue(ae)
+}
+
+func (a *Aggregator) discard(msg *message.Message) {
+	if a.pubsub.durable {
+		msg.Ack()
+		return
+	}
+	if projectID, err := strconv.ParseUint(msg.Metadata.Get(MetadataPartitionKey), 10, 64); err == nil {
+		a.pending.release(uint(projectID))
+	}
+}
+
+// Close stops the event queue. Pending messages of a durable queue are delivered again on the next start.
+func (a *Aggregator) Close() error {
+	return a.pubsub.queue.Close()
+}
+
 func (a *Aggregator) fingerprint(elements []string) string {
 	h := a.fingerprintGenerator.hasher()
 	h.Write([]byte(a.fingerprintGenerator.normalizer(elements)))
@@ -126,69 +404,297 @@ func (a *Aggregator) fingerprint(elements []string) string {
 }
 
 type ProjectEvent struct {
-	ProjectID      uint            `json:"project_id"`
-	EventID        string          `json:"event_id"`
-	Fingerprint    string          `json:"fingerprint"`
-	RawFingerprint json.RawMessage `json:"raw_fingerprint"`
-	Trace          json.RawMessage `json:"trace"`
-	RawEvent       json.RawMessage `json:"event"`
-	Title          string          `json:"title"`
+	ProjectID       uint            `json:"project_id"`
+	EventID         string          `json:"event_id"`
+	Fingerprint     string          `json:"fingerprint"`
+	GroupingVersion string          `json:"grouping_version"`
+	RawFingerprint  json.RawMessage `json:"raw_fingerprint"`
+	Trace           json.RawMessage `json:"trace"`
+	RawEvent        json.RawMessage `json:"event"`
+	Exceptions      json.RawMessage `json:"exceptions"`
+	Title           string          `json:"title"`
+	Client          ClientInfo      `json:"client"`
+	Context         EventContext    `json:"context"`
+	EmittedAt       time.Time       `json:"emitted_at"`
+	ReceivedAt      time.Time       `json:"received_at"`
+}
+
+// EventContext holds the attributes an SDK attaches to an event to help triage it.
+// Structured attributes are kept as JSON and are nil when the SDK did not send them.
+type EventContext struct {
+	Tags        json.RawMessage `json:"tags,omitempty"`
+	Extra       json.RawMessage `json:"extra,omitempty"`
+	Breadcrumbs json.RawMessage `json:"breadcrumbs,omitempty"`
+	User        json.RawMessage `json:"user,omitempty"`
+	Request     json.RawMessage `json:"request,omitempty"`
+	Contexts    json.RawMessage `json:"contexts,omitempty"`
+	ServerName  string          `json:"server_name,omitempty"`
+	Release     string          `json:"release,omitempty"`
+	Dist        string          `json:"dist,omitempty"`
+	Environment string          `json:"environment,omitempty"`
+	Transaction string          `json:"transaction,omitempty"`
+}
+
+func newEventContext(ev Event) (EventContext, error) {
+	c := EventContext{
+		ServerName:  ev.ServerName,
+		Release:     ev.Release,
+		Dist:        ev.Dist,
+		Environment: ev.Environment,
+		Transaction: ev.Transaction,
+	}
+	var err error
+	if len(ev.Tags) > 0 {
+		if c.Tags, err = json.Marshal(ev.Tags); err != nil {
+			return EventContext{}, err
+		}
+	}
+	if len(ev.Extra) > 0 {
+		if c.Extra, err = json.Marshal(ev.Extra); err != nil {
+			return EventContext{}, err
+		}
+	}
+	if len(ev.Breadcrumbs) > 0 {
+		if c.Breadcrumbs, err = json.Marshal(ev.Breadcrumbs); err != nil {
+			return EventContext{}, err
+		}
+	}
+	if ev.User != nil {
+		if c.User, err = json.Marshal(ev.User); err != nil {
+			return EventContext{}, err
+		}
+	}
+	if ev.Request != nil {
+		if c.Request, err = json.Marshal(ev.Request); err != nil {
+			return EventContext{}, err
+		}
+	}
+	if len(ev.Contexts) > 0 {
+		if c.Contexts, err = json.Marshal(ev.Contexts); err != nil {
+			return EventContext{}, err
+		}
+	}
+	return c, nil
 }
 
-func (a *Aggregator) Publish(projectID uint, event Event) error {
-	p, err := json.Marshal(ProjectEventMessage{Event: event, ProjectID: projectID})
+// Publish queues an event for aggregation. SDKs retry failed submissions, so an event ID that was published
+// for the same project within the deduplication window is discarded with ErrDuplicateEvent. When the pending
+// events limits are reached, the event is rejected with a BackpressureError.
+func (a *Aggregator) Publish(ctx context.Context, msg ProjectEventMessage) error {
+	p, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	release, err := a.admit(ctx, msg.ProjectID)
+	if err != nil {
+		return err
+	}
+	key := []byte(fmt.Sprintf("%d:%s", msg.ProjectID, msg.Event.EventId))
+	prev, err := a.seenEvents.GetOrSet(key, []byte{1}, int(a.options.DeduplicationWindow.Seconds()))
 	if err != nil {
+		release()
 		return err
 	}
-	msg := message.NewMessage(watermill.NewULID(), p)
-	return a.pubsub.topic.Publish(topicNameEvents, msg)
+	if prev != nil {
+		release()
+		return ErrDuplicateEvent
+	}
+	if err := a.publish(msg.ProjectID, p); err != nil {
+		a.seenEvents.Del(key)
+		release()
+		return err
+	}
+	return nil
+}
+
+func (a *Aggregator) publish(projectID uint, payload []byte) error {
+	m := message.NewMessage(watermill.NewULID(), payload)
+	m.Metadata.Set(MetadataPartitionKey, strconv.FormatUint(uint64(projectID), 10))
+	return a.pubsub.queue.Publish(topicNameEvents, m)
+}
+
+// Settle acknowledges the queue messages of a batch once the events are persisted or discarded,
+// or rejects them so that the events are delivered again.
+func (a *Aggregator) Settle(batch []AggregatedEvent, ack bool) {
+	for _, ev := range batch {
+		if ack {
+			ev.Ack()
+		} else {
+			ev.Nack()
+		}
+		if !a.pubsub.durable {
+			a.pending.release(ev.ProjectEvent.ProjectID)
+		}
+	}
 }
 
-func (a *Aggregator) Extract(ev ProjectEventMessage) (ProjectEvent, error) {
+func (a *Aggregator) Extract(ctx context.Context, ev ProjectEventMessage) (ProjectEvent, error) {
 	sdkEvent := ev.Event
-	fp, err := json.Marshal(sdkEvent.Fingerprint)
+	elements, err := a.groupingElements(ctx, ev.ProjectID, sdkEvent)
 	if err != nil {
 		return ProjectEvent{}, err
 	}
-	st, err := json.Marshal(sdkEvent.Exception[0].Stacktrace)
+	fp, err := json.Marshal(sdkEvent.Fingerprint)
 	if err != nil {
 		return ProjectEvent{}, err
 	}
-	re, err := json.Marshal(ev.Event)
+	var st, exceptions json.RawMessage
+	if exc, ok := sdkEvent.Exception.Primary(); ok {
+		st, err = json.Marshal(exc.Stacktrace)
+		if err != nil {
+			return ProjectEvent{}, err
+		}
+		exceptions, err = json.Marshal(sdkEvent.Exception)
+		if err != nil {
+			return ProjectEvent{}, err
+		}
+	}
+	re := ev.Payload
+	if len(re) == 0 {
+		// Messages published without the original payload
+		if re, err = json.Marshal(ev.Event); err != nil {
+			return ProjectEvent{}, err
+		}
+	}
+	eventContext, err := newEventContext(sdkEvent)
 	if err != nil {
 		return ProjectEvent{}, err
 	}
+	receivedAt := ev.ReceivedAt
+	if receivedAt.IsZero() {
+		receivedAt = time.Now().UTC()
+	}
+	client := ev.Client
+	if client.Name == "" {
+		client = ClientInfo{Name: sdkEvent.Sdk.Name, Version: sdkEvent.Sdk.Version}
+	}
 	return ProjectEvent{
-		ProjectID:      ev.ProjectID,
-		EventID:        ev.Event.EventId,
-		RawFingerprint: fp,
-		RawEvent:       re,
-		Fingerprint:    a.fingerprint(sdkEvent.Fingerprint),
-		Trace:          st,
-		Title:          sdkEvent.Exception[0].Value,
+		ProjectID:       ev.ProjectID,
+		EventID:         ev.Event.EventId,
+		RawFingerprint:  fp,
+		RawEvent:        re,
+		Fingerprint:     a.fingerprint(elements),
+		GroupingVersion: GroupingVersion,
+		Trace:           st,
+		Exceptions:      exceptions,
+		Title:           eventTitle(sdkEvent),
+		Client:          client,
+		Context:         eventContext,
+		EmittedAt:       a.emittedAt(ev, receivedAt),
+		ReceivedAt:      receivedAt,
 	}, nil
 }
 
+// emittedAt returns the client timestamp of the event. Timestamps that are missing, too far in the future
+// or older than the maximum event age are replaced with the receive time, since the client clock is wrong.
+func (a *Aggregator) emittedAt(ev ProjectEventMessage, receivedAt time.Time) time.Time {
+	ts := ev.Event.Timestamp.Time
+	if ts.IsZero() {
+		return receivedAt
+	}
+	if ts.After(receivedAt.Add(a.options.MaxFutureSkew)) || ts.Before(receivedAt.Add(-a.options.MaxEventAge)) {
+		a.logger.Debug("event timestamp clock skew detected",
+			zap.Uint("project_id", ev.ProjectID),
+			zap.String("event_id", ev.Event.EventId),
+			zap.Time("timestamp", ts),
+			zap.Time("received_at", receivedAt))
+		return receivedAt
+	}
+	return ts.UTC()
+}
+
+// groupingElements applies the fingerprint rules of the project before falling back to the event fingerprint.
+func (a *Aggregator) groupingElements(ctx context.Context, projectID uint, ev Event) ([]string, error) {
+	if a.fingerprintRules == nil {
+		return groupingElements(ev), nil
+	}
+	rules, err := a.fingerprintRules.FingerprintRulesByProjectID(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if elements, ok := a.patterns.applyFingerprintRules(rules, ev); ok {
+		return elements, nil
+	}
+	return groupingElements(ev), nil
+}
+
 func (a *Aggregator) Enqueue(ae AggregatedEvent) {
-	a.lock.Lock()
-	defer a.lock.Unlock()
+	s := a.shard(ae.AggregationKey)
+	s.lock.Lock()
+	s.queue[ae.AggregationKey] = append(s.queue[ae.AggregationKey], ae)
+	groupSize := len(s.queue[ae.AggregationKey])
+	s.lock.Unlock()
+
+	size := a.size.Add(1)
+	if size >= int64(a.options.FlushMaxEvents) || groupSize >= a.options.FlushMaxGroupEvents {
+		a.requestFlush()
+	}
+}
 
-	backlog, exists := a.queue[ae.AggregationKey]
-	if !exists {
-		a.queue[ae.AggregationKey] = []AggregatedEvent{ae}
-	} else {
-		a.queue[ae.AggregationKey] = append(backlog, ae)
+func (a *Aggregator) requestFlush() {
+	select {
+	case a.flushRequests <- struct{}{}:
+	default:
+		// A flush is already requested
 	}
 }
 
+// FlushRequests receives a value when the aggregated events exceed the flush thresholds, so that they
+// are persisted before the flush interval elapses.
+func (a *Aggregator) FlushRequests() <-chan struct{} {
+	return a.flushRequests
+}
+
+// Flush removes the aggregated events and returns them in batches per group, ordered as they were received.
+// Events received after an event that a worker is still processing are kept for the next flush, as well as
+// the groups with events waiting to be retried.
 func (a *Aggregator) Flush() [][]AggregatedEvent {
-	a.lock.Lock()
-	defer a.lock.Unlock()
-	batch := make([][]AggregatedEvent, 0, len(a.queue))
-	for _, v := range a.queue {
-		batch = append(batch, v)
-	}
-	// TODO: minimize allocations
-	a.queue = newQueue()
+	return a.flush(time.Now())
+}
+
+// Drain is Flush on shutdown, events waiting to be retried are included.
+func (a *Aggregator) Drain() [][]AggregatedEvent {
+	return a.flush(time.Time{})
+}
+
+// flush returns the events that are complete and due by now, a zero time ignores the retry delays.
+func (a *Aggregator) flush(now time.Time) [][]AggregatedEvent {
+	completed := a.completed()
+	var batch [][]AggregatedEvent
+	for _, s := range a.shards {
+		s.lock.Lock()
+		for key, events := range s.queue {
+			slices.SortStableFunc(events, func(x, y AggregatedEvent) int {
+				return cmp.Compare(x.sequence, y.sequence)
+			})
+			n := 0
+			for n < len(events) && events[n].sequence < completed && (now.IsZero() || !events[n].retryAt.After(now)) {
+				n++
+			}
+			if n < len(events) && events[n].sequence >= completed {
+				a.heldBack.Store(true)
+			}
+			if n == 0 {
+				continue
+			}
+			batch = append(batch, events[:n:n])
+			a.size.Add(-int64(n))
+			if n == len(events) {
+				delete(s.queue, key)
+			} else {
+				s.queue[key] = slices.Clone(events[n:])
+			}
+		}
+		s.lock.Unlock()
+	}
 	return batch
 }
+
+// completed returns the lowest sequence that is not processed yet, all earlier events are enqueued.
+func (a *Aggregator) completed() uint64 {
+	lowest := a.progress[0].Load()
+	for i := 1; i < len(a.progress); i++ {
+		lowest = min(lowest, a.progress[i].Load())
+	}
+	return lowest
+}
@@ -0,0 +1,364 @@
+package ingestion
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/georgepsarakis/periscope/newcontext"
+)
+
+func decodeEvent(t *testing.T, payload string) Event {
+	t.Helper()
+	var ev Event
+	require.NoError(t, json.Unmarshal([]byte(payload), &ev))
+	return ev
+}
+
+func TestAggregator_Extract(t *testing.T) {
+	tests := []struct {
+		name           string
+		payload        string
+		wantTitle      string
+		wantExceptions int
+	}{
+		{
+			name:           "exception list",
+			payload:        `{"event_id":"1","exception":[{"type":"*errors.errorString","value":"test error"}]}`,
+			wantTitle:      "test error",
+			wantExceptions: 1,
+		},
+		{
+			name: "chained exception values",
+			payload: `{"event_id":"2","exception":{"values":[
+				{"type":"KeyError","value":"'id'"},
+				{"type":"ValueError","value":"lookup failed","mechanism":{"type":"chained","exception_id":1,"parent_id":0}}
+			]}}`,
+			wantTitle:      "lookup failed",
+			wantExceptions: 2,
+		},
+		{
+			name:      "plain message",
+			payload:   `{"event_id":"3","level":"info","message":"deployment finished\nsecond line"}`,
+			wantTitle: "deployment finished",
+		},
+		{
+			name:      "logentry",
+			payload:   `{"event_id":"4","logentry":{"message":"user %s logged in","params":["bob"],"formatted":"user bob logged in"}}`,
+			wantTitle: "user bob logged in",
+		},
+		{
+			name:      "neither exception nor message",
+			payload:   `{"event_id":"5"}`,
+			wantTitle: untitledEvent,
+		},
+	}
+	aggr := NewAggregator(zap.NewNop(), nil, AggregatorOptions{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pev, err := aggr.Extract(context.Background(), ProjectEventMessage{ProjectID: 1, Event: decodeEvent(t, tt.payload)})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantTitle, pev.Title)
+			assert.NotEmpty(t, pev.Fingerprint)
+			if tt.wantExceptions == 0 {
+				assert.Nil(t, pev.Exceptions)
+				return
+			}
+			var exceptions []Exception
+			require.NoError(t, json.Unmarshal(pev.Exceptions, &exceptions))
+			assert.Len(t, exceptions, tt.wantExceptions)
+		})
+	}
+}
+
+func TestAggregator_Extract_MessageGrouping(t *testing.T) {
+	aggr := NewAggregator(zap.NewNop(), nil, AggregatorOptions{})
+	extract := func(payload string) string {
+		pev, err := aggr.Extract(context.Background(), ProjectEventMessage{ProjectID: 1, Event: decodeEvent(t, payload)})
+		require.NoError(t, err)
+		return pev.Fingerprint
+	}
+	first := extract(`{"logentry":{"message":"user %s logged in","formatted":"user alice logged in"}}`)
+	second := extract(`{"logentry":{"message":"user %s logged in","formatted":"user bob logged in"}}`)
+	other := extract(`{"message":"cache warmed up"}`)
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first, other)
+}
+
+func TestAggregator_Extract_EventContext(t *testing.T) {
+	aggr := NewAggregator(zap.NewNop(), nil, AggregatorOptions{})
+	ev := decodeEvent(t, `{
+		"event_id": "1",
+		"message": "payment failed",
+		"tags": [["region", "eu-west-1"], ["retries", 3]],
+		"extra": {"order_id": 42},
+		"breadcrumbs": {"values": [{"category": "http", "message": "GET /orders", "timestamp": 1700000000.5}]},
+		"user": {"id": 1001, "email": "jane@example.com"},
+		"request": {"url": "https://example.com/orders", "method": "POST", "headers": [["Content-Type", "application/json"]], "query_string": "a=1"},
+		"contexts": {"os": {"name": "Linux"}, "trace": {"trace_id": "abc"}},
+		"server_name": "web-1",
+		"release": "shop@1.2.3",
+		"dist": "42",
+		"environment": "production",
+		"transaction": "/orders"
+	}`)
+	pev, err := aggr.Extract(context.Background(), ProjectEventMessage{ProjectID: 1, Event: ev})
+	require.NoError(t, err)
+
+	c := pev.Context
+	assert.Equal(t, "web-1", c.ServerName)
+	assert.Equal(t, "shop@1.2.3", c.Release)
+	assert.Equal(t, "42", c.Dist)
+	assert.Equal(t, "production", c.Environment)
+	assert.Equal(t, "/orders", c.Transaction)
+	assert.JSONEq(t, `{"region":"eu-west-1","retries":"3"}`, string(c.Tags))
+	assert.JSONEq(t, `{"order_id":42}`, string(c.Extra))
+	assert.JSONEq(t, `[{"category":"http","message":"GET /orders","timestamp":1700000000.5}]`, string(c.Breadcrumbs))
+	assert.JSONEq(t, `{"id":"1001","email":"jane@example.com"}`, string(c.User))
+	assert.JSONEq(t, `{"url":"https://example.com/orders","method":"POST","query_string":"a=1","headers":{"Content-Type":"application/json"}}`,
+		string(c.Request))
+	assert.JSONEq(t, `{"os":{"name":"Linux"},"trace":{"trace_id":"abc"}}`, string(c.Contexts))
+
+	pev, err = aggr.Extract(context.Background(), ProjectEventMessage{ProjectID: 1, Event: decodeEvent(t, `{"event_id":"2"}`)})
+	require.NoError(t, err)
+	assert.Equal(t, EventContext{}, pev.Context)
+}
+
+func TestAggregator_Extract_RawEvent(t *testing.T) {
+	aggr := NewAggregator(zap.NewNop(), nil, AggregatorOptions{})
+	payload := `{"event_id": "1", "message": "disk full", "modules": {"django": "5.0"}}`
+	pev, err := aggr.Extract(context.Background(), ProjectEventMessage{
+		ProjectID: 1,
+		Event:     decodeEvent(t, payload),
+		Payload:   []byte(payload),
+	})
+	require.NoError(t, err)
+	// Attributes that are not modeled are kept
+	assert.Equal(t, payload, string(pev.RawEvent))
+}
+
+func TestAggregator_Extract_Timestamps(t *testing.T) {
+	receivedAt := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	aggr := NewAggregator(zap.NewNop(), nil, AggregatorOptions{MaxFutureSkew: time.Minute, MaxEventAge: 24 * time.Hour})
+	tests := []struct {
+		name          string
+		timestamp     string
+		wantEmittedAt time.Time
+	}{
+		{
+			name:          "buffered offline",
+			timestamp:     `"2026-10-17T18:00:00Z"`,
+			wantEmittedAt: time.Date(2026, 10, 17, 18, 0, 0, 0, time.UTC),
+		},
+		{
+			name:          "within future skew",
+			timestamp:     `"2026-10-18T12:00:30Z"`,
+			wantEmittedAt: time.Date(2026, 10, 18, 12, 0, 30, 0, time.UTC),
+		},
+		{
+			name:          "too far in the future",
+			timestamp:     `"2026-10-18T12:05:00Z"`,
+			wantEmittedAt: receivedAt,
+		},
+		{
+			name:          "older than the maximum age",
+			timestamp:     `"2026-10-10T12:00:00Z"`,
+			wantEmittedAt: receivedAt,
+		},
+		{
+			name:          "missing",
+			timestamp:     `null`,
+			wantEmittedAt: receivedAt,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev := decodeEvent(t, `{"event_id":"1","timestamp":`+tt.timestamp+`}`)
+			pev, err := aggr.Extract(context.Background(), ProjectEventMessage{ProjectID: 1, Event: ev, ReceivedAt: receivedAt})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantEmittedAt, pev.EmittedAt)
+			assert.Equal(t, receivedAt, pev.ReceivedAt)
+		})
+	}
+}
+
+func TestAggregator_Publish_Duplicate(t *testing.T) {
+	aggr := NewAggregator(zap.NewNop(), nil, AggregatorOptions{})
+	msg := ProjectEventMessage{ProjectID: 1, Event: Event{EventId: "fc6d8c0c43fc4630ad850ee518f1b9d0"}}
+
+	require.NoError(t, aggr.Publish(context.Background(), msg))
+	assert.ErrorIs(t, aggr.Publish(context.Background(), msg), ErrDuplicateEvent)
+
+	msg.ProjectID = 2
+	assert.NoError(t, aggr.Publish(context.Background(), msg))
+}
+
+func TestAggregator_Publish_Backpressure(t *testing.T) {
+	ctx := newcontext.WithLogger(context.Background(), zap.NewNop())
+	aggr := NewAggregator(zap.NewNop(), nil, AggregatorOptions{MaxPendingEvents: 3, MaxPendingEventsPerProject: 2})
+	t.Cleanup(func() { _ = aggr.Close() })
+	messages, err := aggr.pubsub.queue.Subscribe(ctx, topicNameEvents)
+	require.NoError(t, err)
+	publish := func(projectID uint, eventID string) error {
+		return aggr.Publish(ctx, ProjectEventMessage{ProjectID: projectID, Event: Event{EventId: eventID}})
+	}
+
+	require.NoError(t, publish(1, "00000000000000000000000000000001"))
+	require.NoError(t, publish(1, "00000000000000000000000000000002"))
+	err = publish(1, "00000000000000000000000000000003")
+	require.ErrorIs(t, err, ErrBackpressure)
+	var bpErr BackpressureError
+	require.ErrorAs(t, err, &bpErr)
+	assert.Equal(t, BackpressureError{ProjectID: 1, Pending: 2, Limit: 2}, bpErr)
+
+	require.NoError(t, publish(2, "00000000000000000000000000000004"))
+	err = publish(3, "00000000000000000000000000000005")
+	require.ErrorAs(t, err, &bpErr)
+	assert.True(t, bpErr.Global())
+
+	for range 3 {
+		msg := <-messages
+		msg.Ack()
+		aggr.consume(ctx, msg, 0)
+	}
+	stats, err := aggr.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, QueueDepth{Total: 3, Projects: map[uint]int{1: 2, 2: 1}}, stats.Pending)
+	for _, batch := range aggr.Flush() {
+		aggr.Settle(batch, true)
+	}
+	// Persisted events release their slot, and rejected events are not remembered as duplicates
+	require.NoError(t, publish(1, "00000000000000000000000000000003"))
+	d, err := aggr.Depth(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, QueueDepth{Total: 1, Projects: map[uint]int{1: 1}}, d)
+}
+
+func TestAggregator_Consumer_Ordering(t *testing.T) {
+	ctx, cancel := context.WithCancel(newcontext.WithLogger(context.Background(), zap.NewNop()))
+	aggr := NewAggregator(zap.NewNop(), nil, AggregatorOptions{Consumers: 4, Shards: 3})
+	t.Cleanup(func() { _ = aggr.Close() })
+	require.NoError(t, aggr.Subscribe(ctx))
+	done := make(chan error)
+	go func() { done <- aggr.Consumer(ctx)() }()
+
+	const events = 200
+	for n := range events {
+		require.NoError(t, aggr.Publish(ctx, ProjectEventMessage{
+			ProjectID: uint(n%5 + 1),
+			Event: Event{
+				EventId:     fmt.Sprintf("%032x", n+1),
+				Message:     &LogEntry{Formatted: fmt.Sprintf("event %d", n)},
+				Fingerprint: []string{"ordered"},
+			},
+		}))
+	}
+
+	var batches [][]AggregatedEvent
+	require.Eventually(t, func() bool {
+		batches = append(batches, aggr.Flush()...)
+		total := 0
+		for _, batch := range batches {
+			total += len(batch)
+		}
+		return total == events
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+
+	groups := map[GlobalEventKey][]AggregatedEvent{}
+	for _, batch := range batches {
+		groups[batch[0].AggregationKey] = append(groups[batch[0].AggregationKey], batch...)
+	}
+	assert.Len(t, groups, 5)
+	// Events of a group are flushed in the order they were received, including across flushes
+	for key, group := range groups {
+		assert.True(t, slices.IsSortedFunc(group, func(x, y AggregatedEvent) int {
+			return cmp.Compare(x.sequence, y.sequence)
+		}), "group %s", key)
+	}
+}
+
+func TestAggregator_Flush_HoldsBackUnordered(t *testing.T) {
+	aggr := NewAggregator(zap.NewNop(), nil, AggregatorOptions{Consumers: 2})
+	t.Cleanup(func() { _ = aggr.Close() })
+	key := GlobalEventKey{ProjectID: 1, Hash: "a"}
+	// Sequence 2 is still processed by the first worker, while the second worker completed sequences 1 and 3
+	aggr.Enqueue(AggregatedEvent{AggregationKey: key, sequence: 3})
+	aggr.Enqueue(AggregatedEvent{AggregationKey: key, sequence: 1})
+	aggr.progress[1].Store(5)
+
+	batches := aggr.Flush()
+	require.Len(t, batches, 1)
+	assert.Equal(t, []uint64{1}, sequences(batches[0]))
+
+	aggr.Enqueue(AggregatedEvent{AggregationKey: key, sequence: 2})
+	aggr.progress[0].Store(4)
+	batches = aggr.Flush()
+	require.Len(t, batches, 1)
+	assert.Equal(t, []uint64{2, 3}, sequences(batches[0]))
+	assert.Empty(t, aggr.Flush())
+}
+
+func sequences(events []AggregatedEvent) []uint64 {
+	s := make([]uint64, 0, len(events))
+	for _, e := range events {
+		s = append(s, e.sequence)
+	}
+	return s
+}
+
+func TestAggregator_FlushRequests(t *testing.T) {
+	aggr := NewAggregator(zap.NewNop(), nil, AggregatorOptions{FlushMaxEvents: 4, FlushMaxGroupEvents: 3})
+	t.Cleanup(func() { _ = aggr.Close() })
+	requested := func() bool {
+		select {
+		case <-aggr.FlushRequests():
+			return true
+		default:
+			return false
+		}
+	}
+
+	aggr.Enqueue(AggregatedEvent{AggregationKey: GlobalEventKey{ProjectID: 1, Hash: "a"}})
+	aggr.Enqueue(AggregatedEvent{AggregationKey: GlobalEventKey{ProjectID: 1, Hash: "a"}})
+	assert.False(t, requested())
+	aggr.Enqueue(AggregatedEvent{AggregationKey: GlobalEventKey{ProjectID: 1, Hash: "a"}})
+	assert.True(t, requested(), "group threshold")
+
+	aggr.Enqueue(AggregatedEvent{AggregationKey: GlobalEventKey{ProjectID: 2, Hash: "b"}})
+	assert.True(t, requested(), "total threshold")
+	assert.Len(t, aggr.Flush(), 2)
+
+	// Flushed events no longer count towards the thresholds
+	aggr.Enqueue(AggregatedEvent{AggregationKey: GlobalEventKey{ProjectID: 1, Hash: "a"}})
+	assert.False(t, requested())
+}
+
+func TestFlushStats_Record(t *testing.T) {
+	s := newFlushStats()
+	completed := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	s.record(FlushRecord{Trigger: FlushTriggerSize, Duration: 40 * time.Millisecond, Events: 120, Groups: 3,
+		Lag: 900 * time.Millisecond, Completed: completed})
+	s.record(FlushRecord{Trigger: FlushTriggerInterval, Duration: 10 * time.Millisecond, Events: 5, Groups: 2,
+		Lag: 1200 * time.Millisecond, Completed: completed.Add(time.Second)})
+
+	stats := s.snapshot()
+	assert.Equal(t, map[string]int{FlushTriggerSize: 1, FlushTriggerInterval: 1}, stats.Flushes)
+	assert.Equal(t, 125, stats.Events)
+	assert.Equal(t, completed.Add(time.Second), *stats.LastFlushedAt)
+	assert.Equal(t, int64(10), stats.LastDurationMs)
+	assert.Equal(t, int64(40), stats.MaxDurationMs)
+	assert.Equal(t, 5, stats.LastBatchEvents)
+	assert.Equal(t, 2, stats.LastBatchGroups)
+	assert.Equal(t, 120, stats.MaxBatchEvents)
+	assert.Equal(t, int64(1200), stats.MaxLagMs)
+}
@@ -0,0 +1,185 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrBackpressure is returned by Publish when accepting the event would exceed a pending events limit.
+var ErrBackpressure = errors.New("too many pending events")
+
+// BackpressureError reports the pending events limit that was exceeded.
+type BackpressureError struct {
+	// ProjectID is zero when the global limit was exceeded.
+	ProjectID uint
+	Pending   int
+	Limit     int
+}
+
+func (e BackpressureError) Error() string {
+	if e.Global() {
+		return fmt.Sprintf("%s: %d of %d", ErrBackpressure, e.Pending, e.Limit)
+	}
+	return fmt.Sprintf("%s for project %d: %d of %d", ErrBackpressure, e.ProjectID, e.Pending, e.Limit)
+}
+
+func (e BackpressureError) Unwrap() error {
+	return ErrBackpressure
+}
+
+func (e BackpressureError) Global() bool {
+	return e.ProjectID == 0
+}
+
+// QueueDepth is the number of events accepted by the ingestion endpoints and not persisted yet.
+type QueueDepth struct {
+	Total    int          `json:"total"`
+	Projects map[uint]int `json:"projects"`
+}
+
+// depthReporter is implemented by queues that count their pending messages, since they may be shared
+// by multiple processes.
+type depthReporter interface {
+	Depth(ctx context.Context, topic string) (QueueDepth, error)
+}
+
+// depthRefreshInterval limits how often the depth of a shared queue is queried.
+const depthRefreshInterval = time.Second
+
+const (
+	DefaultMaxPendingEvents           = 100000
+	DefaultMaxPendingEventsPerProject = 10000
+)
+
+// pendingEvents counts the events of an in-memory queue, from publishing until they are persisted or discarded.
+type pendingEvents struct {
+	mu       sync.Mutex
+	total    int
+	projects map[uint]int
+}
+
+func newPendingEvents() *pendingEvents {
+	return &pendingEvents{projects: make(map[uint]int)}
+}
+
+// reserve counts an event as pending, unless a limit is reached.
+func (p *pendingEvents) reserve(projectID uint, maxTotal, maxPerProject int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := checkPendingLimits(p.total, p.projects[projectID], projectID, maxTotal, maxPerProject); err != nil {
+		return err
+	}
+	p.total++
+	p.projects[projectID]++
+	return nil
+}
+
+func (p *pendingEvents) release(projectID uint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.projects[projectID] == 0 {
+		return
+	}
+	p.total--
+	p.projects[projectID]--
+	if p.projects[projectID] == 0 {
+		delete(p.projects, projectID)
+	}
+}
+
+func (p *pendingEvents) depth() QueueDepth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d := QueueDepth{Total: p.total, Projects: make(map[uint]int, len(p.projects))}
+	for id, n := range p.projects {
+		d.Projects[id] = n
+	}
+	return d
+}
+
+func checkPendingLimits(total, project int, projectID uint, maxTotal, maxPerProject int) error {
+	if total >= maxTotal {
+		return BackpressureError{Pending: total, Limit: maxTotal}
+	}
+	if project >= maxPerProject {
+		return BackpressureError{ProjectID: projectID, Pending: project, Limit: maxPerProject}
+	}
+	return nil
+}
+
+// sharedDepth caches the depth of a queue shared by multiple processes.
+type sharedDepth struct {
+	mu          sync.Mutex
+	reporter    depthReporter
+	depth       QueueDepth
+	refreshedAt time.Time
+}
+
+func (s *sharedDepth) get(ctx context.Context) (QueueDepth, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.refreshedAt) < depthRefreshInterval {
+		return s.depth, nil
+	}
+	d, err := s.reporter.Depth(ctx, topicNameEvents)
+	if err != nil {
+		return QueueDepth{}, err
+	}
+	s.depth = d
+	s.refreshedAt = time.Now()
+	return d, nil
+}
+
+// admit checks the pending events limits before publishing an event. The returned function releases the
+// reservation when the event is not published after all.
+func (a *Aggregator) admit(ctx context.Context, projectID uint) (func(), error) {
+	if a.sharedDepth != nil {
+		// Shared queues are checked against the recent depth, bursts may exceed the limits by a few events
+		d, err := a.sharedDepth.get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkPendingLimits(d.Total, d.Projects[projectID], projectID,
+			a.options.MaxPendingEvents, a.options.MaxPendingEventsPerProject); err != nil {
+			return nil, err
+		}
+		return func() {}, nil
+	}
+	if err := a.pending.reserve(projectID, a.options.MaxPendingEvents, a.options.MaxPendingEventsPerProject); err != nil {
+		return nil, err
+	}
+	return func() { a.pending.release(projectID) }, nil
+}
+
+// Depth returns the number of pending events, as counted by the queue when it is shared between processes.
+func (a *Aggregator) Depth(ctx context.Context) (QueueDepth, error) {
+	if a.sharedDepth != nil {
+		return a.sharedDepth.get(ctx)
+	}
+	return a.pending.depth(), nil
+}
+
+// Stats describes the state of the ingestion pipeline for monitoring.
+type Stats struct {
+	Pending                    QueueDepth `json:"pending"`
+	MaxPendingEvents           int        `json:"max_pending_events"`
+	MaxPendingEventsPerProject int        `json:"max_pending_events_per_project"`
+	// Flush is recorded by the worker role, it is empty in processes that only ingest events.
+	Flush FlushStats `json:"flush"`
+}
+
+func (a *Aggregator) Stats(ctx context.Context) (Stats, error) {
+	d, err := a.Depth(ctx)
+	if err != nil {
+		return Stats{}, err
+	}
+	return Stats{
+		Pending:                    d,
+		MaxPendingEvents:           a.options.MaxPendingEvents,
+		MaxPendingEventsPerProject: a.options.MaxPendingEventsPerProject,
+		Flush:                      a.flushStats.snapshot(),
+	}, nil
+}
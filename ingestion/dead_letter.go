@@ -0,0 +1,118 @@
+package ingestion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"go.uber.org/zap"
+
+	"github.com/georgepsarakis/periscope/repository"
+)
+
+// DeadLetterStore keeps the events that cannot be processed or persisted, so that they can be inspected
+// and replayed.
+type DeadLetterStore interface {
+	DeadLetterEventsCreate(ctx context.Context, events []repository.DeadLetterEvent) error
+}
+
+// ErrInvalidDeadLetter is returned by Replay for a dead letter whose payload is not an event message.
+var ErrInvalidDeadLetter = errors.New("dead letter payload cannot be replayed")
+
+// deadLetterTimeout bounds storing dead letters, which also happens after the consumer context is cancelled.
+const deadLetterTimeout = 5 * time.Second
+
+func (a *Aggregator) deadLetter(events []repository.DeadLetterEvent) error {
+	for _, e := range events {
+		a.logger.Error("event dead-lettered",
+			zap.Uint("project_id", e.ProjectID),
+			zap.String("event_id", e.EventID),
+			zap.String("stage", e.Stage),
+			zap.String("error", e.Error))
+	}
+	if a.options.DeadLetters == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deadLetterTimeout)
+	defer cancel()
+	if err := a.options.DeadLetters.DeadLetterEventsCreate(ctx, events); err != nil {
+		a.logger.Error("failed to store dead letters", zap.Int("count", len(events)), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// reject dead-letters a message that cannot be processed. The message of a durable queue is delivered
+// again when the dead letter cannot be stored.
+func (a *Aggregator) reject(msg *message.Message, dl repository.DeadLetterEvent) {
+	if err := a.deadLetter([]repository.DeadLetterEvent{dl}); err != nil && a.pubsub.durable {
+		msg.Nack()
+		return
+	}
+	a.discard(msg)
+}
+
+// Retry enqueues again the events of a batch that failed to persist, delayed by an exponential backoff.
+// Events that exhausted their attempts are dead-lettered.
+func (a *Aggregator) Retry(batch []AggregatedEvent, cause error) {
+	var exhausted []AggregatedEvent
+	for _, ev := range batch {
+		if ev.attempts+1 >= a.options.RetryMaxAttempts {
+			exhausted = append(exhausted, ev)
+			continue
+		}
+		ev.attempts++
+		ev.retryAt = time.Now().Add(a.retryBackoff(ev.attempts))
+		a.Enqueue(ev)
+	}
+	if len(exhausted) > 0 {
+		a.Abandon(exhausted, cause)
+	}
+}
+
+// Abandon dead-letters the events of a batch that failed to persist without retrying them, e.g. on shutdown.
+// The messages of a durable queue are rejected instead when the dead letters cannot be stored.
+func (a *Aggregator) Abandon(batch []AggregatedEvent, cause error) {
+	events := make([]repository.DeadLetterEvent, 0, len(batch))
+	for _, ev := range batch {
+		events = append(events, repository.DeadLetterEvent{
+			ProjectID: ev.ProjectEvent.ProjectID,
+			EventID:   ev.ProjectEvent.EventID,
+			Stage:     repository.DeadLetterStagePersist,
+			Error:     cause.Error(),
+			Attempts:  ev.attempts + 1,
+			Payload:   string(ev.payload),
+		})
+	}
+	err := a.deadLetter(events)
+	a.Settle(batch, err == nil || !a.pubsub.durable)
+}
+
+func (a *Aggregator) retryBackoff(attempts int) time.Duration {
+	d := a.options.RetryBackoff << min(attempts-1, 30)
+	if d <= 0 || d > a.options.RetryMaxBackoff {
+		return a.options.RetryMaxBackoff
+	}
+	return d
+}
+
+// Replay publishes the payload of a dead letter again. Duplicate detection is bypassed, since the event
+// was already published once.
+func (a *Aggregator) Replay(ctx context.Context, payload []byte) error {
+	msg := ProjectEventMessage{}
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidDeadLetter, err)
+	}
+	release, err := a.admit(ctx, msg.ProjectID)
+	if err != nil {
+		return err
+	}
+	if err := a.publish(msg.ProjectID, payload); err != nil {
+		release()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/georgepsarakis/periscope/newcontext"
+	"github.com/georgepsarakis/periscope/repository"
+)
+
+type memoryDeadLetterStore struct {
+	lock   sync.Mutex
+	events []repository.DeadLetterEvent
+}
+
+func (s *memoryDeadLetterStore) DeadLetterEventsCreate(_ context.Context, events []repository.DeadLetterEvent) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+type failingFingerprintRules struct{}
+
+func (failingFingerprintRules) FingerprintRulesByProjectID(_ context.Context, _ uint) ([]repository.FingerprintRule, error) {
+	return nil, errors.New("rules unavailable")
+}
+
+func TestAggregator_Retry(t *testing.T) {
+	store := &memoryDeadLetterStore{}
+	aggr := NewAggregator(zap.NewNop(), nil, AggregatorOptions{
+		DeadLetters:      store,
+		RetryMaxAttempts: 3,
+		RetryBackoff:     time.Hour,
+	})
+	t.Cleanup(func() { _ = aggr.Close() })
+	key := GlobalEventKey{ProjectID: 1, Hash: "a"}
+	aggr.Enqueue(AggregatedEvent{
+		AggregationKey: key,
+		ProjectEvent:   ProjectEvent{ProjectID: 1, EventID: "0f8fad5bd9cb469fa16570867728950e"},
+		payload:        []byte(`{"project_id": 1}`),
+		sequence:       0,
+	})
+	cause := errors.New("database is locked")
+
+	batches := aggr.Flush()
+	require.Len(t, batches, 1)
+	aggr.Retry(batches[0], cause)
+	// The group waits for the retry, including events received later
+	aggr.Enqueue(AggregatedEvent{AggregationKey: key, ProjectEvent: ProjectEvent{ProjectID: 1}})
+	assert.Empty(t, aggr.Flush())
+
+	batches = aggr.Drain()
+	require.Len(t, batches, 1)
+	require.Len(t, batches[0], 2)
+	assert.Equal(t, 1, batches[0][0].attempts)
+	aggr.Retry(batches[0][:1], cause)
+	assert.Empty(t, store.events)
+
+	batches = aggr.Drain()
+	require.Len(t, batches, 1)
+	aggr.Retry(batches[0], cause)
+	assert.Empty(t, aggr.Drain())
+	require.Len(t, store.events, 1)
+	assert.Equal(t, repository.DeadLetterEvent{
+		ProjectID: 1,
+		EventID:   "0f8fad5bd9cb469fa16570867728950e",
+		Stage:     repository.DeadLetterStagePersist,
+		Error:     "database is locked",
+		Attempts:  3,
+		Payload:   `{"project_id": 1}`,
+	}, store.events[0])
+}
+
+func TestAggregator_retryBackoff(t *testing.T) {
+	aggr := NewAggregator(zap.NewNop(), nil, AggregatorOptions{
+		RetryBackoff:    time.Second,
+		RetryMaxBackoff: 10 * time.Second,
+	})
+	t.Cleanup(func() { _ = aggr.Close() })
+	assert.Equal(t, time.Second, aggr.retryBackoff(1))
+	assert.Equal(t, 4*time.Second, aggr.retryBackoff(3))
+	assert.Equal(t, 10*time.Second, aggr.retryBackoff(5))
+	assert.Equal(t, 10*time.Second, aggr.retryBackoff(100))
+}
+
+func TestAggregator_consume_DeadLetter(t *testing.T) {
+	ctx := newcontext.WithLogger(context.Background(), zap.NewNop())
+	store := &memoryDeadLetterStore{}
+	aggr := NewAggregator(zap.NewNop(), failingFingerprintRules{}, AggregatorOptions{DeadLetters: store})
+	t.Cleanup(func() { _ = aggr.Close() })
+
+	malformed := message.NewMessage("1", []byte(`{"project_id": `))
+	malformed.Metadata.Set(MetadataPartitionKey, "7")
+	aggr.consume(ctx, malformed, 0)
+	aggr.consume(ctx, message.NewMessage("2",
+		[]byte(`{"project_id": 7, "event": {"event_id": "7c9e6679742540de944be07fc1f90ae7"}}`)), 0)
+
+	require.Len(t, store.events, 2)
+	assert.Equal(t, uint(7), store.events[0].ProjectID)
+	assert.Equal(t, repository.DeadLetterStageDecode, store.events[0].Stage)
+	assert.Equal(t, `{"project_id": `, store.events[0].Payload)
+	assert.Equal(t, repository.DeadLetterStageExtract, store.events[1].Stage)
+	assert.Equal(t, "7c9e6679742540de944be07fc1f90ae7", store.events[1].EventID)
+	assert.Equal(t, "rules unavailable", store.events[1].Error)
+	assert.Empty(t, aggr.Flush())
+}
+
+func TestAggregator_Replay(t *testing.T) {
+	ctx := newcontext.WithLogger(context.Background(), zap.NewNop())
+	aggr := NewAggregator(zap.NewNop(), nil, AggregatorOptions{})
+	t.Cleanup(func() { _ = aggr.Close() })
+	messages, err := aggr.pubsub.queue.Subscribe(ctx, topicNameEvents)
+	require.NoError(t, err)
+
+	event := ProjectEventMessage{ProjectID: 1, Event: Event{EventId: "0f8fad5bd9cb469fa16570867728950e"}}
+	require.NoError(t, aggr.Publish(ctx, event))
+	(<-messages).Ack()
+	// The event was already published, replaying it bypasses the duplicate detection
+	require.NoError(t, aggr.Replay(ctx, []byte(`{"project_id": 1, "event": {"event_id": "0f8fad5bd9cb469fa16570867728950e"}}`)))
+	msg := <-messages
+	msg.Ack()
+	assert.Equal(t, "1", msg.Metadata.Get(MetadataPartitionKey))
+
+	assert.ErrorIs(t, aggr.Replay(ctx, []byte(`{"project_id": `)), ErrInvalidDeadLetter)
+}
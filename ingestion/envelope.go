@@ -0,0 +1,203 @@
+package ingestion
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Envelope item types, see https://develop.sentry.dev/sdk/data-model/envelope-items/
+const (
+	EnvelopeItemTypeEvent        = "event"
+	EnvelopeItemTypeTransaction  = "transaction"
+	EnvelopeItemTypeAttachment   = "attachment"
+	EnvelopeItemTypeSession      = "session"
+	EnvelopeItemTypeSessions     = "sessions"
+	EnvelopeItemTypeUserReport   = "user_report"
+	EnvelopeItemTypeClientReport = "client_report"
+	EnvelopeItemTypeCheckIn      = "check_in"
+	EnvelopeItemTypeLog          = "log"
+)
+
+var ErrInvalidEnvelope = errors.New("invalid envelope")
+var ErrInvalidEnvelopeItem = errors.New("invalid envelope item")
+
+// EnvelopeHeader is the first line of a Sentry envelope.
+type EnvelopeHeader struct {
+	EventID string    `json:"event_id"`
+	DSN     string    `json:"dsn"`
+	SentAt  time.Time `json:"sent_at"`
+	Sdk     struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"sdk"`
+}
+
+type EnvelopeItemHeader struct {
+	Type string `json:"type"`
+	// Length is optional, when omitted the payload is terminated by a newline character.
+	Length      *int   `json:"length"`
+	ContentType string `json:"content_type"`
+	Filename    string `json:"filename"`
+}
+
+type EnvelopeItem struct {
+	Header  EnvelopeItemHeader
+	Payload []byte
+}
+
+// EnvelopeReader iterates over the items of a Sentry envelope.
+// See https://develop.sentry.dev/sdk/data-model/envelopes/ for the format specification.
+type EnvelopeReader struct {
+	reader *bufio.Reader
+	header EnvelopeHeader
+	items  int
+}
+
+func NewEnvelopeReader(r io.Reader) (*EnvelopeReader, error) {
+	er := &EnvelopeReader{reader: bufio.NewReader(r)}
+	line, err := er.readLine()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, fmt.Errorf("%w: missing envelope header", ErrInvalidEnvelope)
+	}
+	if err := json.Unmarshal(line, &er.header); err != nil {
+		return nil, fmt.Errorf("%w: malformed envelope header: %w", ErrInvalidEnvelope, err)
+	}
+	return er, nil
+}
+
+func (er *EnvelopeReader) Header() EnvelopeHeader {
+	return er.header
+}
+
+// Next returns the next envelope item. When no items are left io.EOF is returned.
+func (er *EnvelopeReader) Next() (EnvelopeItem, error) {
+	var line []byte
+	for len(line) == 0 {
+		var err error
+		line, err = er.readLine()
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(line) == 0 {
+				return EnvelopeItem{}, io.EOF
+			}
+			if !errors.Is(err, io.EOF) {
+				return EnvelopeItem{}, err
+			}
+		}
+	}
+	item := EnvelopeItem{}
+	if err := json.Unmarshal(line, &item.Header); err != nil {
+		return EnvelopeItem{}, fmt.Errorf("%w: malformed header for item %d: %w", ErrInvalidEnvelope, er.items, err)
+	}
+	er.items++
+
+	if item.Header.Length == nil {
+		payload, err := er.readLine()
+		if err != nil && !errors.Is(err, io.EOF) {
+			return EnvelopeItem{}, err
+		}
+		item.Payload = payload
+		return item, nil
+	}
+
+	length := *item.Header.Length
+	if length < 0 {
+		return EnvelopeItem{}, fmt.Errorf("%w: negative length for item %d", ErrInvalidEnvelope, er.items-1)
+	}
+	// Avoid allocating the declared length upfront, the header is client-controlled.
+	payload, err := io.ReadAll(io.LimitReader(er.reader, int64(length)))
+	if err != nil {
+		return EnvelopeItem{}, err
+	}
+	if len(payload) != length {
+		return EnvelopeItem{}, fmt.Errorf("%w: item %d payload is shorter than its declared length", ErrInvalidEnvelope, er.items-1)
+	}
+	// Consume the optional newline separating the payload from the next item header.
+	if b, err := er.reader.Peek(1); err == nil && b[0] == '\n' {
+		_, _ = er.reader.Discard(1)
+	}
+	item.Payload = payload
+	return item, nil
+}
+
+func (er *EnvelopeReader) readLine() ([]byte, error) {
+	line, err := er.reader.ReadBytes('\n')
+	return bytes.TrimRight(line, "\r\n"), err
+}
+
+// ItemRejection describes an envelope item that was not accepted.
+type ItemRejection struct {
+	Index  int    `json:"index"`
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+type EnvelopeReport struct {
+	Accepted int             `json:"accepted"`
+	Rejected []ItemRejection `json:"rejected,omitempty"`
+}
+
+// EnvelopeItemHandler processes a single envelope item. Returning an error wrapping ErrInvalidEnvelopeItem
+// rejects the item, any other error aborts the envelope processing.
+type EnvelopeItemHandler func(header EnvelopeHeader, item EnvelopeItem) error
+
+type EnvelopeDispatcher struct {
+	handlers map[string]EnvelopeItemHandler
+}
+
+func NewEnvelopeDispatcher() EnvelopeDispatcher {
+	return EnvelopeDispatcher{handlers: make(map[string]EnvelopeItemHandler)}
+}
+
+func (d EnvelopeDispatcher) Handle(itemType string, h EnvelopeItemHandler) {
+	d.handlers[itemType] = h
+}
+
+// Dispatch reads every item of the envelope and then calls the handler registered for each item type.
+// Handlers are not called when the envelope is malformed, so that no item is processed before the
+// envelope is rejected. Items without a handler are reported as rejected.
+func (d EnvelopeDispatcher) Dispatch(er *EnvelopeReader) (EnvelopeReport, error) {
+	report := EnvelopeReport{}
+	var items []EnvelopeItem
+	for {
+		item, err := er.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+		items = append(items, item)
+	}
+	for index, item := range items {
+		h, ok := d.handlers[item.Header.Type]
+		if !ok {
+			report.Rejected = append(report.Rejected, ItemRejection{
+				Index:  index,
+				Type:   item.Header.Type,
+				Reason: "unsupported item type",
+			})
+			continue
+		}
+		if err := h(er.Header(), item); err != nil {
+			if !errors.Is(err, ErrInvalidEnvelopeItem) {
+				return report, err
+			}
+			report.Rejected = append(report.Rejected, ItemRejection{
+				Index:  index,
+				Type:   item.Header.Type,
+				Reason: err.Error(),
+			})
+			continue
+		}
+		report.Accepted++
+	}
+	return report, nil
+}
@@ -0,0 +1,149 @@
+package ingestion
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAllItems(t *testing.T, body string) (EnvelopeHeader, []EnvelopeItem, error) {
+	t.Helper()
+	er, err := NewEnvelopeReader(strings.NewReader(body))
+	if err != nil {
+		return EnvelopeHeader{}, nil, err
+	}
+	var items []EnvelopeItem
+	for {
+		item, err := er.Next()
+		if errors.Is(err, io.EOF) {
+			return er.Header(), items, nil
+		}
+		if err != nil {
+			return er.Header(), items, err
+		}
+		items = append(items, item)
+	}
+}
+
+func TestEnvelopeReader(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantEventID  string
+		wantTypes    []string
+		wantPayloads []string
+		wantErr      error
+	}{
+		{
+			name:         "single event with implicit length",
+			body:         "{\"event_id\":\"9ec79c33ec9942ab8353589fcb2e04dc\"}\n{\"type\":\"event\"}\n{\"message\":\"hello\"}\n",
+			wantEventID:  "9ec79c33ec9942ab8353589fcb2e04dc",
+			wantTypes:    []string{"event"},
+			wantPayloads: []string{`{"message":"hello"}`},
+		},
+		{
+			name:         "payload without trailing newline",
+			body:         "{}\n{\"type\":\"event\"}\n{\"message\":\"hello\"}",
+			wantTypes:    []string{"event"},
+			wantPayloads: []string{`{"message":"hello"}`},
+		},
+		{
+			name:         "explicit length with binary payload containing newlines",
+			body:         "{}\n{\"type\":\"attachment\",\"length\":7,\"filename\":\"a.txt\"}\nab\ncd\ne\n{\"type\":\"event\",\"length\":2}\n{}\n",
+			wantTypes:    []string{"attachment", "event"},
+			wantPayloads: []string{"ab\ncd\ne", "{}"},
+		},
+		{
+			name:         "multiple items with mixed lengths",
+			body:         "{\"dsn\":\"https://key@localhost/1\"}\n{\"type\":\"event\",\"length\":13}\n{\"level\":\"e\"}\n{\"type\":\"session\"}\n{\"sid\":\"1\"}\n",
+			wantTypes:    []string{"event", "session"},
+			wantPayloads: []string{`{"level":"e"}`, `{"sid":"1"}`},
+		},
+		{
+			name:    "empty body",
+			body:    "",
+			wantErr: ErrInvalidEnvelope,
+		},
+		{
+			name:    "malformed envelope header",
+			body:    "not-json\n",
+			wantErr: ErrInvalidEnvelope,
+		},
+		{
+			name:      "truncated payload",
+			body:      "{}\n{\"type\":\"event\",\"length\":100}\n{}\n",
+			wantTypes: nil,
+			wantErr:   ErrInvalidEnvelope,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, items, err := readAllItems(t, tt.body)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantEventID, header.EventID)
+			var types, payloads []string
+			for _, item := range items {
+				types = append(types, item.Header.Type)
+				payloads = append(payloads, string(item.Payload))
+			}
+			assert.Equal(t, tt.wantTypes, types)
+			assert.Equal(t, tt.wantPayloads, payloads)
+		})
+	}
+}
+
+func TestEnvelopeDispatcher_Dispatch(t *testing.T) {
+	body := "{}\n" +
+		"{\"type\":\"event\"}\n{\"message\":\"first\"}\n" +
+		"{\"type\":\"session\"}\n{}\n" +
+		"{\"type\":\"event\"}\nnot-json\n" +
+		"{\"type\":\"event\"}\n{\"message\":\"second\"}\n"
+	er, err := NewEnvelopeReader(strings.NewReader(body))
+	require.NoError(t, err)
+
+	var received []string
+	d := NewEnvelopeDispatcher()
+	d.Handle(EnvelopeItemTypeEvent, func(_ EnvelopeHeader, item EnvelopeItem) error {
+		if item.Payload[0] != '{' {
+			return fmt.Errorf("%w: not a JSON object", ErrInvalidEnvelopeItem)
+		}
+		received = append(received, string(item.Payload))
+		return nil
+	})
+	report, err := d.Dispatch(er)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Accepted)
+	assert.Equal(t, []string{`{"message":"first"}`, `{"message":"second"}`}, received)
+	assert.Equal(t, []ItemRejection{
+		{Index: 1, Type: "session", Reason: "unsupported item type"},
+		{Index: 2, Type: "event", Reason: "invalid envelope item: not a JSON object"},
+	}, report.Rejected)
+}
+
+func TestEnvelopeDispatcher_Dispatch_MalformedEnvelope(t *testing.T) {
+	body := "{}\n" +
+		"{\"type\":\"event\"}\n{\"message\":\"first\"}\n" +
+		"{\"type\":\"event\",\"length\":100}\n{}\n"
+	er, err := NewEnvelopeReader(strings.NewReader(body))
+	require.NoError(t, err)
+
+	called := false
+	d := NewEnvelopeDispatcher()
+	d.Handle(EnvelopeItemTypeEvent, func(_ EnvelopeHeader, _ EnvelopeItem) error {
+		called = true
+		return nil
+	})
+	_, err = d.Dispatch(er)
+	require.ErrorIs(t, err, ErrInvalidEnvelope)
+	// No item is processed when the envelope is rejected
+	assert.False(t, called)
+}
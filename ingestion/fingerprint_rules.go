@@ -0,0 +1,192 @@
+package ingestion
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/georgepsarakis/periscope/repository"
+)
+
+// Fingerprint variables supported by fingerprint rules, in addition to FingerprintVariableDefault.
+const (
+	FingerprintVariableType     = "{{ type }}"
+	FingerprintVariableFunction = "{{ function }}"
+	FingerprintVariableModule   = "{{ module }}"
+	FingerprintVariableLevel    = "{{ level }}"
+)
+
+type FingerprintRuleProvider interface {
+	FingerprintRulesByProjectID(ctx context.Context, projectID uint) ([]repository.FingerprintRule, error)
+}
+
+// maxCachedPatterns bounds the patternCache, patterns of modified or deleted rules are otherwise kept forever.
+const maxCachedPatterns = 1024
+
+// patternCache keeps the compiled patterns of fingerprint rules and inbound filters. The cache is emptied
+// when it is full, the patterns still in use are compiled again on their next evaluation.
+type patternCache struct {
+	lock     sync.RWMutex
+	patterns map[string]*regexp.Regexp
+}
+
+func (c *patternCache) regexp(pattern string) (*regexp.Regexp, error) {
+	c.lock.RLock()
+	re, ok := c.patterns[pattern]
+	c.lock.RUnlock()
+	if ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.patterns == nil || len(c.patterns) >= maxCachedPatterns {
+		c.patterns = make(map[string]*regexp.Regexp)
+	}
+	c.patterns[pattern] = re
+	return re, nil
+}
+
+func (c *patternCache) glob(pattern string) *regexp.Regexp {
+	re, _ := c.regexp(GlobToRegexp(pattern))
+	return re
+}
+
+// GlobToRegexp converts a glob pattern, where * matches any sequence of characters and ? matches a single
+// character, to an anchored regular expression.
+func GlobToRegexp(pattern string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// crashingFrame returns the last in-app frame of the outermost exception, falling back to its last frame.
+func crashingFrame(ev Event) (Frame, bool) {
+	exc, ok := ev.Exception.Primary()
+	if !ok || len(exc.Stacktrace.Frames) == 0 {
+		return Frame{}, false
+	}
+	frames := exc.Stacktrace.Frames
+	for i := len(frames) - 1; i >= 0; i-- {
+		if frames[i].InApp != nil && *frames[i].InApp {
+			return frames[i], true
+		}
+	}
+	return frames[len(frames)-1], true
+}
+
+func (c *patternCache) matchRule(rule repository.FingerprintRule, ev Event) bool {
+	if rule.Level != "" && !strings.EqualFold(rule.Level, ev.Level) {
+		return false
+	}
+	if rule.ExceptionType != "" && !c.matchAnyException(ev, func(exc Exception) bool {
+		return c.glob(rule.ExceptionType).MatchString(exc.Type)
+	}) {
+		return false
+	}
+	if rule.Message != "" {
+		re, err := c.regexp(rule.Message)
+		if err != nil {
+			return false
+		}
+		matched := re.MatchString(ev.LogEntry.Text()) || re.MatchString(ev.Message.Text()) ||
+			c.matchAnyException(ev, func(exc Exception) bool { return re.MatchString(exc.Value) })
+		if !matched {
+			return false
+		}
+	}
+	if rule.Module != "" || rule.Function != "" {
+		matched := c.matchAnyException(ev, func(exc Exception) bool {
+			for _, f := range exc.Stacktrace.Frames {
+				if rule.Module != "" && !c.glob(rule.Module).MatchString(f.Module) {
+					continue
+				}
+				if rule.Function != "" && !c.glob(rule.Function).MatchString(f.Function) {
+					continue
+				}
+				return true
+			}
+			return false
+		})
+		if !matched {
+			return false
+		}
+	}
+	for key, pattern := range rule.Tags {
+		value, ok := ev.Tags[key]
+		if !ok || !c.glob(pattern).MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *patternCache) matchAnyException(ev Event, match func(exc Exception) bool) bool {
+	for _, exc := range ev.Exception {
+		if match(exc) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandFingerprint resolves the variables of a rule fingerprint against the event.
+func expandFingerprint(fingerprint []string, ev Event) []string {
+	elements := make([]string, 0, len(fingerprint))
+	frame, hasFrame := crashingFrame(ev)
+	for _, e := range fingerprint {
+		switch {
+		case isFingerprintVariable(e, FingerprintVariableDefault):
+			elements = append(elements, defaultGroupingComponents(ev)...)
+		case isFingerprintVariable(e, FingerprintVariableType):
+			if exc, ok := ev.Exception.Primary(); ok && exc.Type != "" {
+				elements = append(elements, exc.Type)
+			} else {
+				elements = append(elements, "<no-type>")
+			}
+		case isFingerprintVariable(e, FingerprintVariableFunction):
+			if hasFrame && frame.Function != "" {
+				elements = append(elements, frame.Function)
+			} else {
+				elements = append(elements, "<no-function>")
+			}
+		case isFingerprintVariable(e, FingerprintVariableModule):
+			if hasFrame && frame.Module != "" {
+				elements = append(elements, frame.Module)
+			} else {
+				elements = append(elements, "<no-module>")
+			}
+		case isFingerprintVariable(e, FingerprintVariableLevel):
+			elements = append(elements, ev.Level)
+		default:
+			elements = append(elements, e)
+		}
+	}
+	return elements
+}
+
+// applyFingerprintRules returns the expanded fingerprint of the first matching rule.
+// Rules take precedence over the fingerprint sent by the SDK.
+func (c *patternCache) applyFingerprintRules(rules []repository.FingerprintRule, ev Event) ([]string, bool) {
+	for _, rule := range rules {
+		if c.matchRule(rule, ev) {
+			return expandFingerprint(rule.Fingerprint, ev), true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,132 @@
+package ingestion
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/georgepsarakis/periscope/repository"
+)
+
+type staticRuleProvider []repository.FingerprintRule
+
+func (p staticRuleProvider) FingerprintRulesByProjectID(_ context.Context, _ uint) ([]repository.FingerprintRule, error) {
+	return p, nil
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	assert.Equal(t, `^github\.com/acme/.*$`, GlobToRegexp("github.com/acme/*"))
+	assert.Equal(t, `^Error.$`, GlobToRegexp("Error?"))
+}
+
+func TestApplyFingerprintRules(t *testing.T) {
+	inApp := true
+	ev := Event{
+		Level: "error",
+		Tags:  Tags{"region": "eu-west-1"},
+		Exception: Exceptions{{
+			Type:  "*net.OpError",
+			Value: "dial tcp 10.0.0.1:5432: connection refused",
+			Stacktrace: Stacktrace{Frames: []Frame{
+				{Module: "github.com/acme/api/db", Function: "Connect", InApp: &inApp},
+				{Module: "database/sql", Function: "Open"},
+			}},
+		}},
+	}
+	tests := []struct {
+		name  string
+		rules []repository.FingerprintRule
+		want  []string
+		match bool
+	}{
+		{
+			name:  "exception type glob",
+			rules: []repository.FingerprintRule{{ExceptionType: "*net.*", Fingerprint: []string{"network"}}},
+			want:  []string{"network"},
+			match: true,
+		},
+		{
+			name:  "message regular expression with type variable",
+			rules: []repository.FingerprintRule{{Message: `connection refused$`, Fingerprint: []string{"{{ type }}", "refused"}}},
+			want:  []string{"*net.OpError", "refused"},
+			match: true,
+		},
+		{
+			name: "module and function with function variable",
+			rules: []repository.FingerprintRule{{
+				Module: "github.com/acme/*", Function: "Conn*", Fingerprint: []string{"db", "{{ function }}"},
+			}},
+			want:  []string{"db", "Connect"},
+			match: true,
+		},
+		{
+			name:  "level and tag",
+			rules: []repository.FingerprintRule{{Level: "ERROR", Tags: map[string]string{"region": "eu-*"}, Fingerprint: []string{"eu"}}},
+			want:  []string{"eu"},
+			match: true,
+		},
+		{
+			name:  "default variable",
+			rules: []repository.FingerprintRule{{Level: "error", Fingerprint: []string{"{{ default }}", "extra"}}},
+			want:  []string{"type:*net.OpError", "frame:github.com/acme/api/db:Connect", "extra"},
+			match: true,
+		},
+		{
+			name: "all matchers must match",
+			rules: []repository.FingerprintRule{{
+				ExceptionType: "*net.OpError", Tags: map[string]string{"region": "us-*"}, Fingerprint: []string{"us"},
+			}},
+			match: false,
+		},
+		{
+			name: "first matching rule wins",
+			rules: []repository.FingerprintRule{
+				{Level: "warning", Fingerprint: []string{"warning"}},
+				{Level: "error", Fingerprint: []string{"first"}},
+				{Level: "error", Fingerprint: []string{"second"}},
+			},
+			want:  []string{"first"},
+			match: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &patternCache{}
+			got, ok := c.applyFingerprintRules(tt.rules, ev)
+			assert.Equal(t, tt.match, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPatternCache_Bounded(t *testing.T) {
+	c := &patternCache{}
+	for i := 0; i < maxCachedPatterns+10; i++ {
+		re, err := c.regexp(fmt.Sprintf("^error %d$", i))
+		require.NoError(t, err)
+		assert.True(t, re.MatchString(fmt.Sprintf("error %d", i)))
+		assert.LessOrEqual(t, len(c.patterns), maxCachedPatterns)
+	}
+	_, err := c.regexp("(")
+	assert.Error(t, err)
+}
+
+func TestAggregator_Extract_FingerprintRules(t *testing.T) {
+	rules := staticRuleProvider{{ExceptionType: "ValueError", Fingerprint: []string{"value-errors"}}}
+	withRules := NewAggregator(zap.NewNop(), rules, AggregatorOptions{})
+	withoutRules := NewAggregator(zap.NewNop(), nil, AggregatorOptions{})
+
+	extract := func(aggr *Aggregator, payload string) string {
+		pev, err := aggr.Extract(context.Background(), ProjectEventMessage{ProjectID: 1, Event: decodeEvent(t, payload)})
+		require.NoError(t, err)
+		return pev.Fingerprint
+	}
+	first := extract(withRules, `{"fingerprint":["a"],"exception":[{"type":"ValueError","value":"a"}]}`)
+	second := extract(withRules, `{"fingerprint":["b"],"exception":[{"type":"ValueError","value":"b"}]}`)
+	assert.Equal(t, first, second)
+	assert.Equal(t, first, extract(withoutRules, `{"fingerprint":["value-errors"]}`))
+}
@@ -0,0 +1,72 @@
+package ingestion
+
+import (
+	"maps"
+	"sync"
+	"time"
+)
+
+// Flush triggers, recorded in the flush statistics.
+const (
+	FlushTriggerInterval = "interval"
+	FlushTriggerSize     = "size"
+	FlushTriggerShutdown = "shutdown"
+)
+
+// FlushRecord describes a completed flush of aggregated events.
+type FlushRecord struct {
+	Trigger  string
+	Duration time.Duration
+	Events   int
+	Groups   int
+	// Lag is the time between receiving the oldest flushed event and the end of the flush.
+	Lag       time.Duration
+	Completed time.Time
+}
+
+// FlushStats summarizes the flushes of aggregated events since the process started.
+type FlushStats struct {
+	Flushes         map[string]int `json:"flushes"`
+	Events          int            `json:"events"`
+	LastFlushedAt   *time.Time     `json:"last_flushed_at"`
+	LastDurationMs  int64          `json:"last_duration_ms"`
+	MaxDurationMs   int64          `json:"max_duration_ms"`
+	LastBatchEvents int            `json:"last_batch_events"`
+	LastBatchGroups int            `json:"last_batch_groups"`
+	MaxBatchEvents  int            `json:"max_batch_events"`
+	LastLagMs       int64          `json:"last_lag_ms"`
+	MaxLagMs        int64          `json:"max_lag_ms"`
+}
+
+type flushStats struct {
+	lock  sync.Mutex
+	stats FlushStats
+}
+
+func newFlushStats() *flushStats {
+	return &flushStats{stats: FlushStats{Flushes: map[string]int{}}}
+}
+
+func (s *flushStats) record(r FlushRecord) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stats.Flushes[r.Trigger]++
+	s.stats.Events += r.Events
+	completed := r.Completed
+	s.stats.LastFlushedAt = &completed
+	s.stats.LastDurationMs = r.Duration.Milliseconds()
+	s.stats.MaxDurationMs = max(s.stats.MaxDurationMs, s.stats.LastDurationMs)
+	s.stats.LastBatchEvents = r.Events
+	s.stats.LastBatchGroups = r.Groups
+	s.stats.MaxBatchEvents = max(s.stats.MaxBatchEvents, r.Events)
+	s.stats.LastLagMs = r.Lag.Milliseconds()
+	s.stats.MaxLagMs = max(s.stats.MaxLagMs, s.stats.LastLagMs)
+}
+
+func (s *flushStats) snapshot() FlushStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stats := s.stats
+	stats.Flushes = maps.Clone(s.stats.Flushes)
+	return stats
+}
@@ -0,0 +1,123 @@
+package ingestion
+
+import (
+	"regexp"
+	"strings"
+)
+
+// GroupingVersion identifies the algorithm that produced the aggregation key of an event group.
+// Any change to defaultGroupingComponents that alters the resulting hashes requires a new version,
+// so that groups created by previous versions can still be told apart.
+const GroupingVersion = "default:1"
+
+// GroupingVersionLegacy is assigned to groups created before grouping versions were recorded.
+const GroupingVersionLegacy = "legacy"
+
+// FingerprintVariableDefault expands to the default grouping components when used in a fingerprint.
+const FingerprintVariableDefault = "{{ default }}"
+
+var messageNormalizers = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`), "<uuid>"},
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`), "<date>"},
+	{regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), "<ip>"},
+	{regexp.MustCompile(`[\w.+-]+@[\w-]+\.[\w.-]+`), "<email>"},
+	{regexp.MustCompile(`\b0x[0-9a-fA-F]+\b`), "<hex>"},
+	{regexp.MustCompile(`\b[0-9a-fA-F]{8,}\b`), "<hex>"},
+	{regexp.MustCompile(`\d+`), "<int>"},
+}
+
+// normalizeMessage replaces variable parts of a message, such as identifiers and numbers, with placeholders.
+func normalizeMessage(msg string) string {
+	msg = strings.TrimSpace(msg)
+	for _, n := range messageNormalizers {
+		msg = n.pattern.ReplaceAllString(msg, n.replacement)
+	}
+	return msg
+}
+
+// defaultGroupingComponents builds the grouping components of an event that has no custom fingerprint.
+// Exceptions are grouped by their type and the in-app frames of their stack trace, ignoring line numbers
+// so that unrelated code changes do not split issues. Exceptions without a stack trace and message events
+// are grouped by their normalized message.
+func defaultGroupingComponents(ev Event) []string {
+	var components []string
+	for _, exc := range ev.Exception {
+		if exc.Mechanism != nil && exc.Mechanism.IsExceptionGroup {
+			continue
+		}
+		components = append(components, "type:"+exceptionType(exc))
+		frames := groupingFrames(exc.Stacktrace.Frames)
+		for _, f := range frames {
+			components = append(components, "frame:"+f)
+		}
+		if len(frames) == 0 {
+			components = append(components, "value:"+normalizeMessage(exc.Value))
+		}
+	}
+	if len(components) > 0 {
+		return components
+	}
+	if msg := eventMessageTemplate(ev); msg != "" {
+		return []string{"message:" + normalizeMessage(msg)}
+	}
+	return []string{"untitled"}
+}
+
+func exceptionType(exc Exception) string {
+	if exc.Module != "" {
+		return exc.Module + "." + exc.Type
+	}
+	return exc.Type
+}
+
+// groupingFrames returns the module and function of the in-app frames. When the SDK marked
+// no frame as in-app, all frames are considered.
+func groupingFrames(frames []Frame) []string {
+	inApp := false
+	for _, f := range frames {
+		if f.InApp != nil && *f.InApp {
+			inApp = true
+			break
+		}
+	}
+	var result []string
+	for _, f := range frames {
+		if inApp && (f.InApp == nil || !*f.InApp) {
+			continue
+		}
+		location := f.Module
+		if location == "" {
+			location = f.Filename
+		}
+		if location == "" && f.Function == "" {
+			continue
+		}
+		result = append(result, location+":"+f.Function)
+	}
+	return result
+}
+
+// isFingerprintVariable compares fingerprint variables ignoring whitespace, e.g. {{default}} and {{ default }}.
+func isFingerprintVariable(element, variable string) bool {
+	return strings.Join(strings.Fields(element), "") == strings.Join(strings.Fields(variable), "")
+}
+
+// groupingElements returns the elements hashed into the event fingerprint. A custom fingerprint sent by
+// the SDK is used as is, except for the {{ default }} variable which expands to the default components.
+func groupingElements(ev Event) []string {
+	if len(ev.Fingerprint) == 0 {
+		return defaultGroupingComponents(ev)
+	}
+	elements := make([]string, 0, len(ev.Fingerprint))
+	for _, e := range ev.Fingerprint {
+		if isFingerprintVariable(e, FingerprintVariableDefault) {
+			elements = append(elements, defaultGroupingComponents(ev)...)
+			continue
+		}
+		elements = append(elements, e)
+	}
+	return elements
+}
@@ -0,0 +1,94 @@
+package ingestion
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		want string
+	}{
+		{
+			name: "numbers",
+			msg:  "user 1234 not found after 3 attempts",
+			want: "user <int> not found after <int> attempts",
+		},
+		{
+			name: "uuid",
+			msg:  "order 0f8fad5b-d9cb-469f-a165-70867728950e failed",
+			want: "order <uuid> failed",
+		},
+		{
+			name: "ip address and timestamp",
+			msg:  "connection from 10.0.0.12 refused at 2026-10-18T09:12:04Z",
+			want: "connection from <ip> refused at <date>",
+		},
+		{
+			name: "email and hex",
+			msg:  "mail to jane.doe@example.com rejected, object 0x7ffee4c3 hash 9ec79c33ec9942ab",
+			want: "mail to <email> rejected, object <hex> hash <hex>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, normalizeMessage(tt.msg))
+		})
+	}
+}
+
+func TestGroupingElements(t *testing.T) {
+	inApp := true
+	notInApp := false
+	exception := func(value string, line int) Event {
+		return Event{
+			Exception: Exceptions{{
+				Type:  "*errors.errorString",
+				Value: value,
+				Stacktrace: Stacktrace{Frames: []Frame{
+					{Module: "runtime", Function: "goexit", Lineno: 1, InApp: &notInApp},
+					{Module: "main", Function: "handler", Lineno: line, InApp: &inApp},
+				}},
+			}},
+		}
+	}
+
+	t.Run("line numbers and values do not split groups", func(t *testing.T) {
+		assert.Equal(t,
+			groupingElements(exception("test error 1", 10)),
+			groupingElements(exception("test error 2", 42)))
+	})
+	t.Run("only in-app frames are used", func(t *testing.T) {
+		assert.Equal(t,
+			[]string{"type:*errors.errorString", "frame:main:handler"},
+			groupingElements(exception("test error", 10)))
+	})
+	t.Run("exception types split groups", func(t *testing.T) {
+		other := exception("test error", 10)
+		other.Exception[0].Type = "*url.Error"
+		assert.NotEqual(t, groupingElements(exception("test error", 10)), groupingElements(other))
+	})
+	t.Run("exceptions without stack trace use the normalized value", func(t *testing.T) {
+		ev := Event{Exception: Exceptions{{Type: "ValueError", Value: "invalid literal for int(): 42"}}}
+		assert.Equal(t, []string{"type:ValueError", "value:invalid literal for int(): <int>"}, groupingElements(ev))
+	})
+	t.Run("message events use the message template", func(t *testing.T) {
+		ev := Event{LogEntry: &LogEntry{Message: "user %s logged in", Formatted: "user bob logged in"}}
+		assert.Equal(t, []string{"message:user %s logged in"}, groupingElements(ev))
+	})
+	t.Run("custom fingerprint", func(t *testing.T) {
+		ev := exception("test error", 10)
+		ev.Fingerprint = []string{"payments", "timeout"}
+		assert.Equal(t, []string{"payments", "timeout"}, groupingElements(ev))
+	})
+	t.Run("custom fingerprint extending the default", func(t *testing.T) {
+		ev := exception("test error", 10)
+		ev.Fingerprint = []string{"{{default}}", "eu-west-1"}
+		assert.Equal(t,
+			[]string{"type:*errors.errorString", "frame:main:handler", "eu-west-1"},
+			groupingElements(ev))
+	})
+}
@@ -0,0 +1,257 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/georgepsarakis/periscope/repository"
+)
+
+// Inbound filter types. Environment and release filters match a glob pattern, message and exception type
+// filters match a regular expression, and the other filters take no pattern.
+const (
+	InboundFilterEnvironment       = "environment"
+	InboundFilterRelease           = "release"
+	InboundFilterMessage           = "message"
+	InboundFilterExceptionType     = "exception_type"
+	InboundFilterLocalhost         = "localhost"
+	InboundFilterBrowserExtensions = "browser_extensions"
+	InboundFilterWebCrawlers       = "web_crawlers"
+)
+
+var InboundFilterTypes = []string{
+	InboundFilterEnvironment,
+	InboundFilterRelease,
+	InboundFilterMessage,
+	InboundFilterExceptionType,
+	InboundFilterLocalhost,
+	InboundFilterBrowserExtensions,
+	InboundFilterWebCrawlers,
+}
+
+var ErrInvalidInboundFilter = errors.New("invalid inbound filter")
+
+// ValidateInboundFilter verifies the type of the filter and that its pattern is valid for the type.
+func ValidateInboundFilter(filter repository.InboundFilter) error {
+	if !slices.Contains(InboundFilterTypes, filter.Type) {
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidInboundFilter, filter.Type)
+	}
+	switch filter.Type {
+	case InboundFilterEnvironment, InboundFilterRelease:
+		if filter.Pattern == "" {
+			return fmt.Errorf("%w: %s filters require a pattern", ErrInvalidInboundFilter, filter.Type)
+		}
+	case InboundFilterMessage, InboundFilterExceptionType:
+		if filter.Pattern == "" {
+			return fmt.Errorf("%w: %s filters require a pattern", ErrInvalidInboundFilter, filter.Type)
+		}
+		if _, err := regexp.Compile(filter.Pattern); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidInboundFilter, err)
+		}
+	default:
+		if filter.Pattern != "" {
+			return fmt.Errorf("%w: %s filters do not accept a pattern", ErrInvalidInboundFilter, filter.Type)
+		}
+	}
+	return nil
+}
+
+// browserExtensionErrors are raised by popular browser extensions and injected scripts, not by applications.
+var browserExtensionErrors = regexp.MustCompile(strings.Join([]string{
+	`top\.GLOBALS`,
+	`originalCreateNotification`,
+	`canvas\.contentDocument`,
+	`MyApp_RemoveAllHighlights`,
+	`http://tt\.epicplay\.com`,
+	`Can't find variable: ZiteReader`,
+	`jigsaw is not defined`,
+	`ComboSearch is not defined`,
+	`http://loading\.retry\.widdit\.com/`,
+	`atomicFindClose`,
+	`fb_xd_fragment`,
+	`bmi_SafeAddOnload`,
+	`EBCallBackMessageReceived`,
+	`conduitPage`,
+}, "|"))
+
+var browserExtensionSchemes = []string{
+	"chrome-extension://",
+	"moz-extension://",
+	"safari-extension://",
+	"safari-web-extension://",
+	"ms-browser-extension://",
+}
+
+var webCrawlerUserAgents = regexp.MustCompile(`(?i)` + strings.Join([]string{
+	`googlebot`, `bingbot`, `slurp`, `duckduckbot`, `baiduspider`, `yandex(bot|images)`, `sogou`, `exabot`,
+	`facebookexternalhit`, `facebot`, `ia_archiver`, `ahrefsbot`, `semrushbot`, `mj12bot`, `applebot`,
+	`petalbot`, `twitterbot`, `linkedinbot`, `slackbot`, `pingdom`, `uptimerobot`, `headlesschrome`,
+	`crawler`, `spider`,
+}, "|"))
+
+type InboundFilterProvider interface {
+	InboundFiltersByProjectID(ctx context.Context, projectID uint) ([]repository.InboundFilter, error)
+	InboundFilterCountersIncrement(ctx context.Context, projectID uint, counts map[uint]int, filteredAt map[uint]time.Time) error
+}
+
+// InboundFilters drops the events matching the filters of their project before they are queued.
+// The number of events dropped by each filter and its last match are kept in memory and stored periodically
+// by the scheduler.
+type InboundFilters struct {
+	provider InboundFilterProvider
+	logger   *zap.Logger
+	interval time.Duration
+	patterns patternCache
+	now      func() time.Time
+
+	counts     *counters[uint, uint]
+	mu         sync.Mutex
+	filteredAt map[uint]time.Time
+}
+
+func NewInboundFilters(logger *zap.Logger, provider InboundFilterProvider, flushInterval time.Duration) *InboundFilters {
+	return &InboundFilters{
+		provider:   provider,
+		logger:     logger,
+		interval:   flushInterval,
+		now:        repository.UTCNow,
+		counts:     newCounters[uint, uint](),
+		filteredAt: make(map[uint]time.Time),
+	}
+}
+
+// Match returns the first filter of the project that matches the event, and counts the filtered event.
+func (f *InboundFilters) Match(ctx context.Context, projectID uint, ev Event) (repository.InboundFilter, bool, error) {
+	filters, err := f.provider.InboundFiltersByProjectID(ctx, projectID)
+	if err != nil {
+		return repository.InboundFilter{}, false, err
+	}
+	for _, filter := range filters {
+		if !f.matches(filter, ev) {
+			continue
+		}
+		f.mu.Lock()
+		f.filteredAt[filter.ID] = f.now()
+		f.mu.Unlock()
+		f.counts.add(projectID, filter.ID, 1)
+		return filter, true, nil
+	}
+	return repository.InboundFilter{}, false, nil
+}
+
+func (f *InboundFilters) matches(filter repository.InboundFilter, ev Event) bool {
+	switch filter.Type {
+	case InboundFilterEnvironment:
+		return f.patterns.glob(filter.Pattern).MatchString(ev.Environment)
+	case InboundFilterRelease:
+		return ev.Release != "" && f.patterns.glob(filter.Pattern).MatchString(ev.Release)
+	case InboundFilterMessage:
+		re, err := f.patterns.regexp(filter.Pattern)
+		if err != nil {
+			return false
+		}
+		return re.MatchString(ev.LogEntry.Text()) || re.MatchString(ev.Message.Text()) ||
+			f.patterns.matchAnyException(ev, func(exc Exception) bool { return re.MatchString(exc.Value) })
+	case InboundFilterExceptionType:
+		re, err := f.patterns.regexp(filter.Pattern)
+		if err != nil {
+			return false
+		}
+		return f.patterns.matchAnyException(ev, func(exc Exception) bool { return re.MatchString(exc.Type) })
+	case InboundFilterLocalhost:
+		return isLocalhostEvent(ev)
+	case InboundFilterBrowserExtensions:
+		return isBrowserExtensionEvent(ev)
+	case InboundFilterWebCrawlers:
+		return isWebCrawlerEvent(ev)
+	}
+	return false
+}
+
+func isLocalhostEvent(ev Event) bool {
+	if ev.User != nil && isLoopback(ev.User.IPAddress) {
+		return true
+	}
+	if ev.Request == nil || ev.Request.URL == "" {
+		return false
+	}
+	u, err := url.Parse(ev.Request.URL)
+	if err != nil {
+		return false
+	}
+	return u.Hostname() == "localhost" || isLoopback(u.Hostname())
+}
+
+func isLoopback(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func isBrowserExtensionEvent(ev Event) bool {
+	for _, exc := range ev.Exception {
+		if browserExtensionErrors.MatchString(exc.Value) {
+			return true
+		}
+		for _, frame := range exc.Stacktrace.Frames {
+			for _, scheme := range browserExtensionSchemes {
+				if strings.HasPrefix(frame.AbsPath, scheme) || strings.HasPrefix(frame.Filename, scheme) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func isWebCrawlerEvent(ev Event) bool {
+	if ev.Request == nil {
+		return false
+	}
+	for name, value := range ev.Request.Headers {
+		if strings.EqualFold(name, "User-Agent") {
+			return webCrawlerUserAgents.MatchString(value)
+		}
+	}
+	return false
+}
+
+// Flush adds the events counted since the previous flush to the filter counters, along with the last match
+// of each filter.
+func (f *InboundFilters) Flush(ctx context.Context) error {
+	return f.counts.flush(ctx, func(ctx context.Context, projectID uint, counts map[uint]int) error {
+		filteredAt := make(map[uint]time.Time, len(counts))
+		f.mu.Lock()
+		for id := range counts {
+			filteredAt[id] = f.filteredAt[id]
+		}
+		f.mu.Unlock()
+		if err := f.provider.InboundFilterCountersIncrement(ctx, projectID, counts, filteredAt); err != nil {
+			return err
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for id, at := range filteredAt {
+			// Kept for the next flush when the filter matched again meanwhile
+			if f.filteredAt[id].Equal(at) {
+				delete(f.filteredAt, id)
+			}
+		}
+		return nil
+	})
+}
+
+func (f *InboundFilters) Scheduler(ctx context.Context) func() error {
+	return func() error {
+		return flushCounters(ctx, f.logger, f.interval, "inbound filters", f.Flush)
+	}
+}
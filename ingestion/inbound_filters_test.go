@@ -0,0 +1,206 @@
+package ingestion
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/georgepsarakis/periscope/repository"
+)
+
+type memoryInboundFilterProvider struct {
+	filters    []repository.InboundFilter
+	counts     map[uint]int
+	filteredAt map[uint]time.Time
+}
+
+func (p *memoryInboundFilterProvider) InboundFiltersByProjectID(_ context.Context, _ uint) ([]repository.InboundFilter, error) {
+	return p.filters, nil
+}
+
+func (p *memoryInboundFilterProvider) InboundFilterCountersIncrement(_ context.Context, _ uint, counts map[uint]int, filteredAt map[uint]time.Time) error {
+	for id, n := range counts {
+		p.counts[id] += n
+	}
+	if p.filteredAt == nil {
+		p.filteredAt = map[uint]time.Time{}
+	}
+	for id, at := range filteredAt {
+		p.filteredAt[id] = at
+	}
+	return nil
+}
+
+func TestValidateInboundFilter(t *testing.T) {
+	assert.NoError(t, ValidateInboundFilter(repository.InboundFilter{Type: InboundFilterRelease, Pattern: "*-rc*"}))
+	assert.NoError(t, ValidateInboundFilter(repository.InboundFilter{Type: InboundFilterLocalhost}))
+	assert.ErrorIs(t, ValidateInboundFilter(repository.InboundFilter{Type: "ip_address"}), ErrInvalidInboundFilter)
+	assert.ErrorIs(t, ValidateInboundFilter(repository.InboundFilter{Type: InboundFilterEnvironment}), ErrInvalidInboundFilter)
+	assert.ErrorIs(t, ValidateInboundFilter(repository.InboundFilter{Type: InboundFilterMessage, Pattern: "("}), ErrInvalidInboundFilter)
+	assert.ErrorIs(t, ValidateInboundFilter(repository.InboundFilter{Type: InboundFilterWebCrawlers, Pattern: "bot"}), ErrInvalidInboundFilter)
+}
+
+func TestInboundFilters_Match(t *testing.T) {
+	ev := Event{
+		Environment: "staging",
+		Release:     "api@2.0.0-rc1",
+		Message:     &LogEntry{Formatted: "ResizeObserver loop limit exceeded"},
+		Exception: Exceptions{{
+			Type:  "ChunkLoadError",
+			Value: "Loading chunk 7 failed",
+			Stacktrace: Stacktrace{Frames: []Frame{
+				{AbsPath: "https://app.example.com/static/main.js"},
+			}},
+		}},
+	}
+	tests := []struct {
+		name   string
+		filter repository.InboundFilter
+		event  func(ev Event) Event
+		match  bool
+	}{
+		{
+			name:   "environment",
+			filter: repository.InboundFilter{Type: InboundFilterEnvironment, Pattern: "stag*"},
+			match:  true,
+		},
+		{
+			name:   "environment mismatch",
+			filter: repository.InboundFilter{Type: InboundFilterEnvironment, Pattern: "production"},
+		},
+		{
+			name:   "release glob",
+			filter: repository.InboundFilter{Type: InboundFilterRelease, Pattern: "*-rc*"},
+			match:  true,
+		},
+		{
+			name:   "message regular expression",
+			filter: repository.InboundFilter{Type: InboundFilterMessage, Pattern: `^ResizeObserver loop`},
+			match:  true,
+		},
+		{
+			name:   "exception value regular expression",
+			filter: repository.InboundFilter{Type: InboundFilterMessage, Pattern: `Loading chunk \d+ failed`},
+			match:  true,
+		},
+		{
+			name:   "exception type regular expression",
+			filter: repository.InboundFilter{Type: InboundFilterExceptionType, Pattern: `^Chunk`},
+			match:  true,
+		},
+		{
+			name:   "not localhost",
+			filter: repository.InboundFilter{Type: InboundFilterLocalhost},
+		},
+		{
+			name:   "localhost request",
+			filter: repository.InboundFilter{Type: InboundFilterLocalhost},
+			event: func(ev Event) Event {
+				ev.Request = &Request{URL: "http://localhost:3000/checkout"}
+				return ev
+			},
+			match: true,
+		},
+		{
+			name:   "loopback user address",
+			filter: repository.InboundFilter{Type: InboundFilterLocalhost},
+			event: func(ev Event) Event {
+				ev.User = &User{IPAddress: "::1"}
+				return ev
+			},
+			match: true,
+		},
+		{
+			name:   "browser extension frame",
+			filter: repository.InboundFilter{Type: InboundFilterBrowserExtensions},
+			event: func(ev Event) Event {
+				ev.Exception = Exceptions{{Type: "TypeError", Stacktrace: Stacktrace{Frames: []Frame{
+					{AbsPath: "chrome-extension://abcdef/content.js"},
+				}}}}
+				return ev
+			},
+			match: true,
+		},
+		{
+			name:   "browser extension error",
+			filter: repository.InboundFilter{Type: InboundFilterBrowserExtensions},
+			event: func(ev Event) Event {
+				ev.Exception = Exceptions{{Type: "TypeError", Value: "top.GLOBALS is undefined"}}
+				return ev
+			},
+			match: true,
+		},
+		{
+			name:   "not a browser extension",
+			filter: repository.InboundFilter{Type: InboundFilterBrowserExtensions},
+		},
+		{
+			name:   "web crawler",
+			filter: repository.InboundFilter{Type: InboundFilterWebCrawlers},
+			event: func(ev Event) Event {
+				ev.Request = &Request{Headers: StringMap{"user-agent": "Mozilla/5.0 (compatible; Googlebot/2.1)"}}
+				return ev
+			},
+			match: true,
+		},
+		{
+			name:   "browser user agent",
+			filter: repository.InboundFilter{Type: InboundFilterWebCrawlers},
+			event: func(ev Event) Event {
+				ev.Request = &Request{Headers: StringMap{"User-Agent": "Mozilla/5.0 (X11; Linux x86_64) Firefox/131.0"}}
+				return ev
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.ID = 1
+			provider := &memoryInboundFilterProvider{filters: []repository.InboundFilter{tt.filter}}
+			f := NewInboundFilters(zap.NewNop(), provider, time.Second)
+			e := ev
+			if tt.event != nil {
+				e = tt.event(ev)
+			}
+			filter, ok, err := f.Match(context.Background(), 1, e)
+			require.NoError(t, err)
+			assert.Equal(t, tt.match, ok)
+			if tt.match {
+				assert.Equal(t, tt.filter, filter)
+			}
+		})
+	}
+}
+
+func TestInboundFilters_Flush(t *testing.T) {
+	provider := &memoryInboundFilterProvider{
+		filters: []repository.InboundFilter{
+			{BaseModel: repository.BaseModel{ID: 1}, Type: InboundFilterEnvironment, Pattern: "development"},
+			{BaseModel: repository.BaseModel{ID: 2}, Type: InboundFilterEnvironment, Pattern: "staging"},
+		},
+		counts: map[uint]int{},
+	}
+	f := NewInboundFilters(zap.NewNop(), provider, time.Second)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+	ctx := context.Background()
+	for _, env := range []string{"development", "staging", "staging", "production"} {
+		_, _, err := f.Match(ctx, 1, Event{Environment: env})
+		require.NoError(t, err)
+		now = now.Add(time.Minute)
+	}
+
+	require.NoError(t, f.Flush(ctx))
+	assert.Equal(t, map[uint]int{1: 1, 2: 2}, provider.counts)
+	// Each filter is stamped with its own last match
+	assert.Equal(t, map[uint]time.Time{
+		1: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+		2: time.Date(2026, 10, 18, 12, 2, 0, 0, time.UTC),
+	}, provider.filteredAt)
+	assert.Empty(t, f.filteredAt)
+	require.NoError(t, f.Flush(ctx))
+	assert.Equal(t, map[uint]int{1: 1, 2: 2}, provider.counts)
+}
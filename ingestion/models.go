@@ -1,25 +1,35 @@
 package ingestion
 
-import "time"
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
 
 type SDKEvent struct {
-	Contexts struct {
-		Device struct {
-			Arch   string `json:"arch"`
-			NumCpu int    `json:"num_cpu"`
-		} `json:"device"`
-		Os struct {
-			Name string `json:"name"`
-		} `json:"os"`
-		Runtime struct {
-			Name    string `json:"name"`
-			Version string `json:"version"`
-		} `json:"runtime"`
-	} `json:"contexts"`
-	EventId     string   `json:"event_id"`
-	Fingerprint []string `json:"fingerprint"`
-	Level       string   `json:"level"`
-	Platform    string   `json:"platform"`
+	// Contexts are keyed by context name, e.g. device, os, runtime or trace.
+	Contexts    map[string]map[string]any `json:"contexts,omitempty"`
+	EventId     string                    `json:"event_id"`
+	Fingerprint []string                  `json:"fingerprint"`
+	Level       string                    `json:"level"`
+	Tags        Tags                      `json:"tags,omitempty"`
+	Extra       map[string]any            `json:"extra,omitempty"`
+	Breadcrumbs Breadcrumbs               `json:"breadcrumbs,omitempty"`
+	Request     *Request                  `json:"request,omitempty"`
+	ServerName  string                    `json:"server_name,omitempty"`
+	Release     string                    `json:"release,omitempty"`
+	Dist        string                    `json:"dist,omitempty"`
+	Environment string                    `json:"environment,omitempty"`
+	Transaction string                    `json:"transaction,omitempty"`
+	Platform    string                    `json:"platform"`
 	Sdk         struct {
 		Name         string   `json:"name"`
 		Version      string   `json:"version"`
@@ -29,28 +39,339 @@ type SDKEvent struct {
 			Version string `json:"version"`
 		} `json:"packages"`
 	} `json:"sdk"`
-	User struct {
-	} `json:"user"`
+	User *User `json:"user,omitempty"`
 	// Name -> Version
 	Modules   map[string]string `json:"modules"`
-	Exception []struct {
-		Type       string `json:"type"`
-		Value      string `json:"value"`
-		Stacktrace struct {
-			Frames []struct {
-				Function string `json:"function"`
-				Module   string `json:"module"`
-				AbsPath  string `json:"abs_path"`
-				Lineno   int    `json:"lineno"`
-			} `json:"frames"`
-		} `json:"stacktrace"`
-	} `json:"exception"`
-	Timestamp time.Time `json:"timestamp"`
+	Message   *LogEntry         `json:"message,omitempty"`
+	LogEntry  *LogEntry         `json:"logentry,omitempty"`
+	Exception Exceptions        `json:"exception"`
+	Timestamp Timestamp         `json:"timestamp"`
+}
+
+var ErrInvalidEventID = errors.New("invalid event ID")
+
+// NormalizeEventID converts an event ID to the form used by Sentry, 32 lowercase hexadecimal characters.
+// UUIDs with dashes are accepted, and an ID is generated for events without one.
+func NormalizeEventID(id string) (string, error) {
+	if id == "" {
+		return strings.ReplaceAll(uuid.NewString(), "-", ""), nil
+	}
+	normalized := strings.ToLower(strings.ReplaceAll(id, "-", ""))
+	if len(normalized) != 32 {
+		return "", fmt.Errorf("%w: %q", ErrInvalidEventID, id)
+	}
+	if _, err := hex.DecodeString(normalized); err != nil {
+		return "", fmt.Errorf("%w: %q", ErrInvalidEventID, id)
+	}
+	return normalized, nil
 }
 
 type ProjectEventMessage struct {
 	ProjectID uint  `json:"project_id"`
 	Event     Event `json:"event"`
+	// Payload is the event as sent by the SDK, including the attributes that Event does not model.
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	Client     ClientInfo      `json:"client"`
+	ReceivedAt time.Time       `json:"received_at"`
+}
+
+// ClientInfo identifies the SDK that sent an event, as reported in the sentry_client authentication parameter.
+type ClientInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
 }
 
 type Event SDKEvent
+
+// StringMap accepts both the object and the list of key-value pairs forms, as used by the tags attribute
+// and the request headers.
+type StringMap map[string]string
+
+type Tags = StringMap
+
+func (t *StringMap) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '[' {
+		var pairs [][]any
+		if err := json.Unmarshal(b, &pairs); err != nil {
+			return err
+		}
+		tags := make(StringMap, len(pairs))
+		for _, pair := range pairs {
+			if len(pair) == 2 {
+				tags[tagValue(pair[0])] = tagValue(pair[1])
+			}
+		}
+		*t = tags
+		return nil
+	}
+	var values map[string]any
+	if err := json.Unmarshal(b, &values); err != nil {
+		return err
+	}
+	tags := make(StringMap, len(values))
+	for k, v := range values {
+		tags[k] = tagValue(v)
+	}
+	*t = tags
+	return nil
+}
+
+// tagValue converts tag values to strings, SDKs may send numbers and booleans as well.
+func tagValue(v any) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// Timestamp accepts RFC 3339 strings and numeric UNIX timestamps in seconds, as sent by the different SDKs.
+// Timestamps without a timezone are in UTC.
+type Timestamp struct {
+	time.Time
+}
+
+var timestampLayouts = []string{time.RFC3339, "2006-01-02T15:04:05"}
+
+func (t *Timestamp) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+	if b[0] != '"' {
+		var seconds float64
+		if err := json.Unmarshal(b, &seconds); err != nil {
+			return err
+		}
+		whole, frac := math.Modf(seconds)
+		t.Time = time.Unix(int64(whole), int64(frac*1e9)).Round(time.Microsecond).UTC()
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	for _, layout := range timestampLayouts {
+		if parsed, err := time.Parse(layout, s); err == nil {
+			t.Time = parsed.UTC()
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid timestamp %q", s)
+}
+
+// User identifies the user affected by an event. SDKs may send the identifier as a number.
+type User struct {
+	ID        StringValue    `json:"id,omitempty"`
+	Email     string         `json:"email,omitempty"`
+	Username  string         `json:"username,omitempty"`
+	IPAddress string         `json:"ip_address,omitempty"`
+	Segment   string         `json:"segment,omitempty"`
+	Data      map[string]any `json:"data,omitempty"`
+}
+
+// StringValue is a string attribute that SDKs may also send as a number or boolean.
+type StringValue string
+
+func (s *StringValue) UnmarshalJSON(b []byte) error {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*s = StringValue(tagValue(v))
+	return nil
+}
+
+// Request describes the HTTP request that was being handled when the event occurred. The query string,
+// cookies and body are kept as sent, since SDKs use either strings or structured values for them.
+type Request struct {
+	URL         string          `json:"url,omitempty"`
+	Method      string          `json:"method,omitempty"`
+	QueryString json.RawMessage `json:"query_string,omitempty"`
+	Cookies     json.RawMessage `json:"cookies,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty"`
+	Headers     StringMap       `json:"headers,omitempty"`
+	Env         StringMap       `json:"env,omitempty"`
+}
+
+type Breadcrumb struct {
+	Type      string          `json:"type,omitempty"`
+	Category  string          `json:"category,omitempty"`
+	Message   string          `json:"message,omitempty"`
+	Level     string          `json:"level,omitempty"`
+	Data      map[string]any  `json:"data,omitempty"`
+	Timestamp json.RawMessage `json:"timestamp,omitempty"`
+}
+
+// Breadcrumbs accepts both a plain list and the {"values": [...]} form of the breadcrumbs attribute.
+type Breadcrumbs []Breadcrumb
+
+func (br *Breadcrumbs) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '{' {
+		var v struct {
+			Values []Breadcrumb `json:"values"`
+		}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return err
+		}
+		*br = v.Values
+		return nil
+	}
+	var v []Breadcrumb
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*br = v
+	return nil
+}
+
+type Frame struct {
+	Function string `json:"function"`
+	Module   string `json:"module"`
+	Filename string `json:"filename,omitempty"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    *bool  `json:"in_app,omitempty"`
+}
+
+type Stacktrace struct {
+	Frames []Frame `json:"frames"`
+}
+
+// Mechanism describes how an exception was captured and links chained exceptions to their parent.
+type Mechanism struct {
+	Type             string `json:"type,omitempty"`
+	Handled          *bool  `json:"handled,omitempty"`
+	ExceptionID      *int   `json:"exception_id,omitempty"`
+	ParentID         *int   `json:"parent_id,omitempty"`
+	IsExceptionGroup bool   `json:"is_exception_group,omitempty"`
+}
+
+type Exception struct {
+	Type       string     `json:"type"`
+	Value      string     `json:"value"`
+	Module     string     `json:"module,omitempty"`
+	Mechanism  *Mechanism `json:"mechanism,omitempty"`
+	Stacktrace Stacktrace `json:"stacktrace"`
+}
+
+// Exceptions is the chain of exceptions of an event. Following the Sentry protocol, causes come first
+// and the exception that was actually raised is the last element.
+type Exceptions []Exception
+
+// UnmarshalJSON accepts both a plain list and the {"values": [...]} form of the exception attribute.
+func (e *Exceptions) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '{' {
+		var v struct {
+			Values []Exception `json:"values"`
+		}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return err
+		}
+		*e = v.Values
+		return nil
+	}
+	var v []Exception
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*e = v
+	return nil
+}
+
+// Primary returns the outermost exception of the chain.
+func (e Exceptions) Primary() (Exception, bool) {
+	if len(e) == 0 {
+		return Exception{}, false
+	}
+	return e[len(e)-1], true
+}
+
+// LogEntry is the message of an event, either in the message or the logentry attribute.
+type LogEntry struct {
+	Message   string `json:"message,omitempty"`
+	Formatted string `json:"formatted,omitempty"`
+	Params    []any  `json:"params,omitempty"`
+}
+
+// UnmarshalJSON accepts both a plain string and the object form of the message.
+func (l *LogEntry) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '"' {
+		return json.Unmarshal(b, &l.Formatted)
+	}
+	type logEntry LogEntry
+	var v logEntry
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*l = LogEntry(v)
+	return nil
+}
+
+// Text returns the formatted message, falling back to the message template.
+func (l *LogEntry) Text() string {
+	if l == nil {
+		return ""
+	}
+	if l.Formatted != "" {
+		return l.Formatted
+	}
+	return l.Message
+}
+
+// Template returns the message before parameter substitution, which is preferred for grouping.
+func (l *LogEntry) Template() string {
+	if l == nil {
+		return ""
+	}
+	if l.Message != "" {
+		return l.Message
+	}
+	return l.Formatted
+}
+
+const untitledEvent = "<unlabeled event>"
+const maxTitleLength = 256
+
+// eventTitle follows the Sentry conventions: the value of the outermost exception,
+// or the first line of the message for events without exceptions.
+func eventTitle(ev Event) string {
+	if exc, ok := ev.Exception.Primary(); ok {
+		if exc.Value != "" {
+			return exc.Value
+		}
+		if exc.Type != "" {
+			return exc.Type
+		}
+	}
+	msg := ev.LogEntry.Text()
+	if msg == "" {
+		msg = ev.Message.Text()
+	}
+	msg, _, _ = strings.Cut(strings.TrimSpace(msg), "\n")
+	if msg == "" {
+		return untitledEvent
+	}
+	if len(msg) > maxTitleLength {
+		msg = msg[:maxTitleLength]
+		// Avoid splitting a multibyte character
+		for !utf8.ValidString(msg) {
+			msg = msg[:len(msg)-1]
+		}
+	}
+	return msg
+}
+
+// eventMessageTemplate returns the message of the event, without parameters substituted when possible.
+func eventMessageTemplate(ev Event) string {
+	if t := ev.LogEntry.Template(); t != "" {
+		return t
+	}
+	return ev.Message.Template()
+}
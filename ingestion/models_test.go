@@ -0,0 +1,83 @@
+package ingestion
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimestamp_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name:  "RFC 3339 with timezone",
+			input: `"2026-10-18T12:30:00.250+02:00"`,
+			want:  time.Date(2026, 10, 18, 10, 30, 0, 250000000, time.UTC),
+		},
+		{
+			name:  "without timezone",
+			input: `"2026-10-18T12:30:00.5"`,
+			want:  time.Date(2026, 10, 18, 12, 30, 0, 500000000, time.UTC),
+		},
+		{
+			name:  "UNIX timestamp with fraction",
+			input: `1792326600.125`,
+			want:  time.Date(2026, 10, 18, 12, 30, 0, 125000000, time.UTC),
+		},
+		{
+			name:  "UNIX timestamp",
+			input: `1792326600`,
+			want:  time.Date(2026, 10, 18, 12, 30, 0, 0, time.UTC),
+		},
+		{
+			name:  "null",
+			input: `null`,
+		},
+		{
+			name:    "invalid string",
+			input:   `"yesterday"`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ts Timestamp
+			err := json.Unmarshal([]byte(tt.input), &ts)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.want.Equal(ts.Time), "got %s", ts.Time)
+		})
+	}
+}
+
+func TestNormalizeEventID(t *testing.T) {
+	id, err := NormalizeEventID("FC6D8C0C-43FC-4630-AD85-0EE518F1B9D0")
+	require.NoError(t, err)
+	assert.Equal(t, "fc6d8c0c43fc4630ad850ee518f1b9d0", id)
+
+	id, err = NormalizeEventID("fc6d8c0c43fc4630ad850ee518f1b9d0")
+	require.NoError(t, err)
+	assert.Equal(t, "fc6d8c0c43fc4630ad850ee518f1b9d0", id)
+
+	generated, err := NormalizeEventID("")
+	require.NoError(t, err)
+	assert.Len(t, generated, 32)
+	other, err := NormalizeEventID("")
+	require.NoError(t, err)
+	assert.NotEqual(t, generated, other)
+
+	for _, invalid := range []string{"1", "zc6d8c0c43fc4630ad850ee518f1b9d0", "fc6d8c0c43fc4630ad850ee518f1b9d0ff"} {
+		_, err := NormalizeEventID(invalid)
+		assert.ErrorIs(t, err, ErrInvalidEventID, invalid)
+	}
+}
@@ -2,6 +2,7 @@ package ingestion
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"go.uber.org/zap"
@@ -10,23 +11,55 @@ import (
 	"github.com/georgepsarakis/periscope/repository"
 )
 
+// PersistenceOptions configures Persistence, zero values are replaced with the defaults.
+type PersistenceOptions struct {
+	// Interval is the maximum time between flushes, flushes also run earlier when the aggregator
+	// exceeds its flush thresholds.
+	Interval time.Duration
+	// Timeout bounds each flush.
+	Timeout time.Duration
+	// DrainTimeout bounds the final flush on shutdown.
+	DrainTimeout time.Duration
+}
+
+const (
+	DefaultFlushInterval     = time.Second
+	DefaultFlushTimeout      = 5 * time.Second
+	DefaultFlushDrainTimeout = 30 * time.Second
+)
+
+func (o PersistenceOptions) withDefaults() PersistenceOptions {
+	if o.Interval <= 0 {
+		o.Interval = DefaultFlushInterval
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultFlushTimeout
+	}
+	if o.DrainTimeout <= 0 {
+		o.DrainTimeout = DefaultFlushDrainTimeout
+	}
+	return o
+}
+
 type Persistence struct {
-	application       app.App
-	schedulerInterval time.Duration
-	aggregator        *Aggregator
+	application app.App
+	options     PersistenceOptions
+	aggregator  *Aggregator
 }
 
-func NewPersistence(application app.App, schedulerInterval time.Duration, aggr *Aggregator) Persistence {
+func NewPersistence(application app.App, aggr *Aggregator, opts PersistenceOptions) Persistence {
 	return Persistence{
-		application:       application,
-		schedulerInterval: schedulerInterval,
-		aggregator:        aggr,
+		application: application,
+		options:     opts.withDefaults(),
+		aggregator:  aggr,
 	}
 }
 
+// Scheduler flushes the aggregated events when the interval elapses or the aggregator requests a flush,
+// whichever comes first.
 func (p Persistence) Scheduler(ctx context.Context) func() error {
 	return func() error {
-		ticker := time.NewTicker(p.schedulerInterval)
+		ticker := time.NewTicker(p.options.Interval)
 		defer ticker.Stop()
 		logger := p.application.Logger
 
@@ -35,15 +68,18 @@ func (p Persistence) Scheduler(ctx context.Context) func() error {
 		for {
 			select {
 			case <-ticker.C:
-				logger.Info("event persistence ticker tick")
-				// TODO: timeout should be configurable
-				if err := p.flush(); err != nil {
+				if err := p.flush(p.options.Timeout, FlushTriggerInterval); err != nil {
 					logger.Error("flush operation failed", zap.Error(err))
 				}
+			case <-p.aggregator.FlushRequests():
+				if err := p.flush(p.options.Timeout, FlushTriggerSize); err != nil {
+					logger.Error("flush operation failed", zap.Error(err))
+				}
+				ticker.Reset(p.options.Interval)
 			case <-ctx.Done():
 				logger.Info("ticker stopped due to timeout or cancellation")
 				logger.Info("draining event queue")
-				if err := p.flush(); err != nil {
+				if err := p.flush(p.options.DrainTimeout, FlushTriggerShutdown); err != nil {
 					logger.Error("flush operation failed", zap.Error(err))
 				}
 				return nil
@@ -52,44 +88,167 @@ func (p Persistence) Scheduler(ctx context.Context) func() error {
 	}
 }
 
-func (p Persistence) flush() error {
+func (p Persistence) flush(timeout time.Duration, trigger string) error {
 	log := p.application.Logger
 
-	// TODO: timeout should be configurable
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	log.Info("event persistence flush started")
+	shutdown := trigger == FlushTriggerShutdown
+	var batches [][]AggregatedEvent
+	if shutdown {
+		batches = p.aggregator.Drain()
+	} else {
+		batches = p.aggregator.Flush()
+	}
+	if len(batches) == 0 {
+		return nil
+	}
+	started := time.Now()
+	log.Debug("event persistence flush started", zap.String("trigger", trigger))
 
-	for _, batch := range p.aggregator.Flush() {
+	var flushErr error
+	var oldest time.Time
+	events := 0
+	for _, batch := range batches {
+		events += len(batch)
+		for _, ae := range batch {
+			if receivedAt := ae.ProjectEvent.ReceivedAt; !receivedAt.IsZero() && (oldest.IsZero() || receivedAt.Before(oldest)) {
+				oldest = receivedAt
+			}
+		}
+	}
+	// Failed batches are retried by later flushes, a failure of the final flush cannot be retried
+	failed := func(batch []AggregatedEvent, err error) {
+		if shutdown {
+			p.aggregator.Abandon(batch, err)
+		} else {
+			p.aggregator.Retry(batch, err)
+		}
+	}
+	var pending [][]AggregatedEvent
+	var eventBatches []repository.EventBatch
+	for _, batch := range batches {
 		ev := batch[0]
 		project, err := p.application.Repository.ProjectFindByID(ctx, ev.ProjectEvent.ProjectID)
 		if err != nil {
 			log.Error("failed to find project",
 				zap.Error(err),
 				zap.Uint("project_id", ev.ProjectEvent.ProjectID))
+			// Events of deleted projects are discarded, other errors are retried
+			if errors.Is(err, repository.ErrRecordNotFound) {
+				p.aggregator.Settle(batch, true)
+			} else {
+				failed(batch, err)
+				flushErr = errors.Join(flushErr, err)
+			}
 			continue
 		}
-		events := make([]repository.Event, 0, len(batch))
-		for _, event := range batch {
-			events = append(events, repository.Event{
-				EventID:     event.ProjectEvent.EventID,
-				Fingerprint: event.ProjectEvent.Fingerprint,
-				ProjectID:   ev.ProjectEvent.ProjectID,
-				StackTrace:  ev.ProjectEvent.Trace,
-				Title:       event.ProjectEvent.Title,
-			})
+		pending = append(pending, batch)
+		eventBatches = append(eventBatches, newEventBatch(project, batch))
+	}
+	if err := p.store(ctx, timeout, pending, eventBatches, failed); err != nil {
+		flushErr = errors.Join(flushErr, err)
+	}
+	completed := time.Now()
+	var lag time.Duration
+	if !oldest.IsZero() {
+		lag = completed.Sub(oldest)
+	}
+	p.aggregator.flushStats.record(FlushRecord{
+		Trigger:   trigger,
+		Duration:  completed.Sub(started),
+		Events:    events,
+		Groups:    len(batches),
+		Lag:       lag,
+		Completed: completed,
+	})
+	log.Info("event persistence flush completed",
+		zap.String("trigger", trigger),
+		zap.Int("events", events),
+		zap.Int("groups", len(batches)),
+		zap.Duration("duration", completed.Sub(started)),
+		zap.Duration("lag", lag))
+
+	return flushErr
+}
+
+// store persists the batches of a flush in a single transaction. When the transaction fails, each group is
+// stored separately, so that a single failing group does not delay the rest of the flush.
+func (p Persistence) store(ctx context.Context, timeout time.Duration, batches [][]AggregatedEvent, eventBatches []repository.EventBatch, failed func([]AggregatedEvent, error)) error {
+	if len(batches) == 0 {
+		return nil
+	}
+	sampling := p.application.EventSampling()
+	results, err := p.application.Repository.CreateEventBatches(ctx, eventBatches, sampling)
+	if err == nil {
+		for i, batch := range batches {
+			p.persisted(batch, results[i])
 		}
-		grp, createdEvents, err := p.application.Repository.CreateEvents(ctx, project, events)
+		return nil
+	}
+	if len(batches) == 1 {
+		failed(batches[0], err)
+		return err
+	}
+	p.application.Logger.Warn("flush transaction failed, storing groups separately", zap.Error(err))
+	// The failed transaction may have used up the flush timeout, so each group gets its own
+	storeGroup := func(eventBatch repository.EventBatch) ([]repository.EventBatchResult, error) {
+		groupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		defer cancel()
+		return p.application.Repository.CreateEventBatches(groupCtx, []repository.EventBatch{eventBatch}, sampling)
+	}
+	var storeErr error
+	for i, batch := range batches {
+		results, err := storeGroup(eventBatches[i])
 		if err != nil {
-			return err
+			failed(batch, err)
+			storeErr = errors.Join(storeErr, err)
+			continue
 		}
-		log.Info("events persisted successfully",
-			zap.Uint("projectID", batch[0].ProjectEvent.ProjectID),
-			zap.Uint("eventGroupID", grp.ID),
-			zap.Int("count", len(createdEvents)))
+		p.persisted(batch, results[0])
 	}
-	log.Info("event persistence flush completed")
+	return storeErr
+}
+
+func (p Persistence) persisted(batch []AggregatedEvent, result repository.EventBatchResult) {
+	p.aggregator.Settle(batch, true)
+	p.application.Logger.Info("events persisted successfully",
+		zap.Uint("projectID", batch[0].ProjectEvent.ProjectID),
+		zap.Uint("eventGroupID", result.Group.ID),
+		zap.Bool("created", result.Created),
+		zap.Int("count", len(result.Events)),
+		zap.Int("received", len(batch)))
+}
 
-	return nil
+func newEventBatch(project repository.Project, batch []AggregatedEvent) repository.EventBatch {
+	events := make([]repository.Event, 0, len(batch))
+	for _, event := range batch {
+		events = append(events, repository.Event{
+			EventID:         event.ProjectEvent.EventID,
+			Fingerprint:     event.ProjectEvent.Fingerprint,
+			GroupingVersion: event.ProjectEvent.GroupingVersion,
+			ProjectID:       project.ID,
+			StackTrace:      event.ProjectEvent.Trace,
+			Exceptions:      event.ProjectEvent.Exceptions,
+			Title:           event.ProjectEvent.Title,
+			ClientName:      event.ProjectEvent.Client.Name,
+			ClientVersion:   event.ProjectEvent.Client.Version,
+			Tags:            event.ProjectEvent.Context.Tags,
+			Extra:           event.ProjectEvent.Context.Extra,
+			Breadcrumbs:     event.ProjectEvent.Context.Breadcrumbs,
+			User:            event.ProjectEvent.Context.User,
+			Request:         event.ProjectEvent.Context.Request,
+			Contexts:        event.ProjectEvent.Context.Contexts,
+			ServerName:      event.ProjectEvent.Context.ServerName,
+			Release:         event.ProjectEvent.Context.Release,
+			Dist:            event.ProjectEvent.Context.Dist,
+			Environment:     event.ProjectEvent.Context.Environment,
+			Transaction:     event.ProjectEvent.Context.Transaction,
+			Payload:         event.ProjectEvent.RawEvent,
+			EmittedAt:       event.ProjectEvent.EmittedAt,
+			ReceivedAt:      event.ProjectEvent.ReceivedAt,
+		})
+	}
+	return repository.EventBatch{Project: project, Events: events}
 }
@@ -0,0 +1,309 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"go.uber.org/zap"
+
+	"github.com/georgepsarakis/periscope/repository"
+)
+
+const (
+	QueueDriverMemory   = "memory"
+	QueueDriverDatabase = "database"
+)
+
+// Queue transports published events to the aggregator consumer.
+type Queue interface {
+	message.Publisher
+	message.Subscriber
+}
+
+// durableQueue is implemented by queues that keep messages until they are acknowledged. Messages of
+// durable queues are acknowledged only after the events have been persisted.
+type durableQueue interface {
+	Durable() bool
+}
+
+// QueueStore persists the messages of a DatabaseQueue.
+type QueueStore interface {
+	QueueMessagesCreate(ctx context.Context, topic string, messages []repository.QueueMessage) error
+	QueueMessagesLease(ctx context.Context, topic string, limit int, lease time.Duration) ([]repository.QueueMessage, error)
+	QueueMessageDelete(ctx context.Context, id uint) error
+	QueueMessageRelease(ctx context.Context, id uint, availableAt time.Time) error
+	QueueMessagesExtendLease(ctx context.Context, ids []uint, lease time.Duration) error
+	QueueMessagesDepth(ctx context.Context, topic string) (map[string]int, error)
+}
+
+// DatabaseQueueOptions configures a DatabaseQueue, zero values are replaced with the defaults.
+type DatabaseQueueOptions struct {
+	// LeaseDuration is how long a delivered message is locked. The leases of the messages that are not
+	// acknowledged yet are extended while the process runs, messages of a process that stopped are delivered
+	// again once their lease expires.
+	LeaseDuration time.Duration
+	// PollInterval is how often the database is checked for new messages when the queue is empty.
+	PollInterval time.Duration
+	// RetryDelay is how long a rejected message waits before it is delivered again.
+	RetryDelay time.Duration
+	BatchSize  int
+}
+
+const (
+	DefaultQueueLeaseDuration = time.Minute
+	DefaultQueuePollInterval  = 500 * time.Millisecond
+	DefaultQueueRetryDelay    = 5 * time.Second
+	DefaultQueueBatchSize     = 100
+)
+
+// queueStoreTimeout bounds the store operations that are not tied to a request context.
+const queueStoreTimeout = 5 * time.Second
+
+func (o DatabaseQueueOptions) withDefaults() DatabaseQueueOptions {
+	if o.LeaseDuration <= 0 {
+		o.LeaseDuration = DefaultQueueLeaseDuration
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = DefaultQueuePollInterval
+	}
+	if o.RetryDelay <= 0 {
+		o.RetryDelay = DefaultQueueRetryDelay
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = DefaultQueueBatchSize
+	}
+	return o
+}
+
+var ErrQueueClosed = errors.New("queue is closed")
+
+// DatabaseQueue is a watermill publisher and subscriber that stores messages in the database, so that
+// accepted events survive restarts. Messages are deleted when acknowledged, and messages pending at startup,
+// including the ones leased by a process that crashed, are delivered again.
+type DatabaseQueue struct {
+	store     QueueStore
+	logger    *zap.Logger
+	options   DatabaseQueueOptions
+	closing   chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+
+	// inFlight holds the IDs of the delivered messages that are not acknowledged or rejected yet.
+	inFlightLock sync.Mutex
+	inFlight     map[uint]struct{}
+}
+
+func NewDatabaseQueue(store QueueStore, logger *zap.Logger, opts DatabaseQueueOptions) *DatabaseQueue {
+	return &DatabaseQueue{
+		store:    store,
+		logger:   logger,
+		options:  opts.withDefaults(),
+		closing:  make(chan struct{}),
+		inFlight: make(map[uint]struct{}),
+	}
+}
+
+func (q *DatabaseQueue) Durable() bool {
+	return true
+}
+
+func (q *DatabaseQueue) Publish(topic string, messages ...*message.Message) error {
+	select {
+	case <-q.closing:
+		return ErrQueueClosed
+	default:
+	}
+	rows := make([]repository.QueueMessage, 0, len(messages))
+	for _, m := range messages {
+		rows = append(rows, repository.QueueMessage{
+			UUID:         m.UUID,
+			PartitionKey: m.Metadata.Get(MetadataPartitionKey),
+			Payload:      m.Payload,
+			Metadata:     m.Metadata,
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), queueStoreTimeout)
+	defer cancel()
+	return q.store.QueueMessagesCreate(ctx, topic, rows)
+}
+
+func (q *DatabaseQueue) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	select {
+	case <-q.closing:
+		return nil, ErrQueueClosed
+	default:
+	}
+	out := make(chan *message.Message)
+	q.wg.Add(2)
+	go q.poll(ctx, topic, out)
+	go q.extendLeases(ctx)
+	return out, nil
+}
+
+// Depth counts the messages of the topic that are not acknowledged yet, by project.
+func (q *DatabaseQueue) Depth(ctx context.Context, topic string) (QueueDepth, error) {
+	partitions, err := q.store.QueueMessagesDepth(ctx, topic)
+	if err != nil {
+		return QueueDepth{}, err
+	}
+	d := QueueDepth{Projects: make(map[uint]int, len(partitions))}
+	for partition, n := range partitions {
+		d.Total += n
+		if projectID, err := strconv.ParseUint(partition, 10, 64); err == nil {
+			d.Projects[uint(projectID)] += n
+		}
+	}
+	return d, nil
+}
+
+// Close stops delivering messages and waits for the delivered messages to be acknowledged or rejected.
+// Messages that are still pending are no longer extended and are delivered again after their lease expires.
+func (q *DatabaseQueue) Close() error {
+	q.closeOnce.Do(func() {
+		close(q.closing)
+	})
+	q.wg.Wait()
+	return nil
+}
+
+func (q *DatabaseQueue) poll(ctx context.Context, topic string, out chan<- *message.Message) {
+	defer q.wg.Done()
+	defer close(out)
+	ticker := time.NewTicker(q.options.PollInterval)
+	defer ticker.Stop()
+	for {
+		leased, err := q.store.QueueMessagesLease(ctx, topic, q.options.BatchSize, q.options.LeaseDuration)
+		if err != nil && ctx.Err() == nil {
+			q.logger.Error("failed to lease queue messages", zap.String("topic", topic), zap.Error(err))
+		}
+		for _, m := range leased {
+			// The lease of a message still being processed expired, e.g. when it could not be extended.
+			// Delivering it again would enqueue the event twice, the lease is extended from now on.
+			if !q.track(m.ID) {
+				q.logger.Warn("skipping redelivered queue message still in flight", zap.String("uuid", m.UUID))
+				continue
+			}
+			msg := message.NewMessage(m.UUID, m.Payload)
+			for k, v := range m.Metadata {
+				msg.Metadata.Set(k, v)
+			}
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				q.untrack(m.ID)
+				return
+			case <-q.closing:
+				q.untrack(m.ID)
+				return
+			}
+			q.wg.Add(1)
+			go q.awaitAck(m.ID, msg)
+		}
+		// Keep draining without waiting while the queue has a backlog
+		if len(leased) == q.options.BatchSize {
+			continue
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		case <-q.closing:
+			return
+		}
+	}
+}
+
+// track records a delivered message, it returns false when the message is already in flight.
+func (q *DatabaseQueue) track(id uint) bool {
+	q.inFlightLock.Lock()
+	defer q.inFlightLock.Unlock()
+	if _, ok := q.inFlight[id]; ok {
+		return false
+	}
+	q.inFlight[id] = struct{}{}
+	return true
+}
+
+func (q *DatabaseQueue) untrack(id uint) {
+	q.inFlightLock.Lock()
+	defer q.inFlightLock.Unlock()
+	delete(q.inFlight, id)
+}
+
+// extendLeases renews the leases of the messages in flight three times per lease duration, so that events
+// waiting for a flush or for a retry are not delivered again.
+func (q *DatabaseQueue) extendLeases(ctx context.Context) {
+	defer q.wg.Done()
+	ticker := time.NewTicker(q.options.LeaseDuration / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		case <-q.closing:
+			return
+		}
+		q.extendInFlight()
+	}
+}
+
+// extendInFlight holds the lock while the leases are extended, so that messages settled concurrently are
+// released after the extension.
+func (q *DatabaseQueue) extendInFlight() {
+	q.inFlightLock.Lock()
+	defer q.inFlightLock.Unlock()
+	if len(q.inFlight) == 0 {
+		return
+	}
+	ids := make([]uint, 0, len(q.inFlight))
+	for id := range q.inFlight {
+		ids = append(ids, id)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), queueStoreTimeout)
+	defer cancel()
+	if err := q.store.QueueMessagesExtendLease(ctx, ids, q.options.LeaseDuration); err != nil {
+		q.logger.Error("failed to extend queue message leases", zap.Int("messages", len(ids)), zap.Error(err))
+	}
+}
+
+func (q *DatabaseQueue) awaitAck(id uint, msg *message.Message) {
+	defer q.wg.Done()
+	// The message is no longer extended before it is released, so that the retry delay is not overridden
+	select {
+	case <-msg.Acked():
+		q.untrack(id)
+		q.delete(id, msg)
+	case <-msg.Nacked():
+		q.untrack(id)
+		q.release(id, msg)
+	case <-q.closing:
+		q.untrack(id)
+		// The lease expires and the message is delivered again, unless it was acknowledged concurrently
+		select {
+		case <-msg.Acked():
+			q.delete(id, msg)
+		default:
+		}
+	}
+}
+
+func (q *DatabaseQueue) delete(id uint, msg *message.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), queueStoreTimeout)
+	defer cancel()
+	if err := q.store.QueueMessageDelete(ctx, id); err != nil {
+		q.logger.Error("failed to delete acknowledged queue message", zap.String("uuid", msg.UUID), zap.Error(err))
+	}
+}
+
+func (q *DatabaseQueue) release(id uint, msg *message.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), queueStoreTimeout)
+	defer cancel()
+	if err := q.store.QueueMessageRelease(ctx, id, time.Now().UTC().Add(q.options.RetryDelay)); err != nil {
+		q.logger.Error("failed to release rejected queue message", zap.String("uuid", msg.UUID), zap.Error(err))
+	}
+}
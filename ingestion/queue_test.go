@@ -0,0 +1,253 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/georgepsarakis/periscope/newcontext"
+	"github.com/georgepsarakis/periscope/repository"
+)
+
+type memoryQueueStore struct {
+	mu       sync.Mutex
+	nextID   uint
+	messages map[uint]*storedQueueMessage
+	// extendErr fails the lease extensions when set
+	extendErr error
+}
+
+type storedQueueMessage struct {
+	message     repository.QueueMessage
+	lockedUntil time.Time
+}
+
+func newMemoryQueueStore() *memoryQueueStore {
+	return &memoryQueueStore{messages: map[uint]*storedQueueMessage{}}
+}
+
+func (s *memoryQueueStore) QueueMessagesCreate(_ context.Context, topic string, messages []repository.QueueMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range messages {
+		s.nextID++
+		m.ID = s.nextID
+		m.Topic = topic
+		s.messages[m.ID] = &storedQueueMessage{message: m}
+	}
+	return nil
+}
+
+func (s *memoryQueueStore) QueueMessagesLease(_ context.Context, topic string, limit int, lease time.Duration) ([]repository.QueueMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var leased []repository.QueueMessage
+	for id := uint(1); id <= s.nextID && len(leased) < limit; id++ {
+		m, ok := s.messages[id]
+		if !ok || m.message.Topic != topic || m.lockedUntil.After(now) {
+			continue
+		}
+		m.lockedUntil = now.Add(lease)
+		m.message.Attempts++
+		leased = append(leased, m.message)
+	}
+	return leased, nil
+}
+
+func (s *memoryQueueStore) QueueMessageDelete(_ context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.messages, id)
+	return nil
+}
+
+func (s *memoryQueueStore) QueueMessageRelease(_ context.Context, id uint, availableAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m, ok := s.messages[id]; ok {
+		m.lockedUntil = availableAt
+	}
+	return nil
+}
+
+func (s *memoryQueueStore) QueueMessagesExtendLease(_ context.Context, ids []uint, lease time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.extendErr != nil {
+		return s.extendErr
+	}
+	for _, id := range ids {
+		if m, ok := s.messages[id]; ok {
+			m.lockedUntil = time.Now().Add(lease)
+		}
+	}
+	return nil
+}
+
+func (s *memoryQueueStore) attempts(id uint) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.messages[id].message.Attempts
+}
+
+func (s *memoryQueueStore) QueueMessagesDepth(_ context.Context, topic string) (map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	depth := map[string]int{}
+	for _, m := range s.messages {
+		if m.message.Topic == topic {
+			depth[m.message.PartitionKey]++
+		}
+	}
+	return depth, nil
+}
+
+func (s *memoryQueueStore) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.messages)
+}
+
+func receive(t *testing.T, messages <-chan *message.Message) *message.Message {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(time.Second):
+		require.FailNow(t, "no message received")
+		return nil
+	}
+}
+
+func TestDatabaseQueue(t *testing.T) {
+	store := newMemoryQueueStore()
+	q := NewDatabaseQueue(store, zap.NewNop(), DatabaseQueueOptions{
+		LeaseDuration: 100 * time.Millisecond,
+		PollInterval:  10 * time.Millisecond,
+		RetryDelay:    10 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	require.NoError(t, q.Publish("events", message.NewMessage("1", []byte("first")), message.NewMessage("2", []byte("second"))))
+	messages, err := q.Subscribe(ctx, "events")
+	require.NoError(t, err)
+
+	first := receive(t, messages)
+	assert.Equal(t, "first", string(first.Payload))
+	second := receive(t, messages)
+	assert.Equal(t, "second", string(second.Payload))
+
+	// Acknowledged messages are deleted
+	first.Ack()
+	assert.Eventually(t, func() bool { return store.len() == 1 }, time.Second, 5*time.Millisecond)
+
+	// Rejected messages are delivered again after the retry delay
+	second.Nack()
+	redelivered := receive(t, messages)
+	assert.Equal(t, "2", redelivered.UUID)
+
+	// The lease of messages in flight is extended
+	select {
+	case msg := <-messages:
+		require.FailNow(t, "message in flight delivered again", msg.UUID)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	cancel()
+	require.NoError(t, q.Close())
+	assert.ErrorIs(t, q.Publish("events", message.NewMessage("3", nil)), ErrQueueClosed)
+
+	// Messages that are neither acknowledged nor rejected by a stopped process are delivered again
+	// after the lease expires
+	q = NewDatabaseQueue(store, zap.NewNop(), DatabaseQueueOptions{PollInterval: 10 * time.Millisecond})
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	messages, err = q.Subscribe(ctx, "events")
+	require.NoError(t, err)
+	redelivered = receive(t, messages)
+	assert.Equal(t, "2", redelivered.UUID)
+	redelivered.Ack()
+	assert.Eventually(t, func() bool { return store.len() == 0 }, time.Second, 5*time.Millisecond)
+	cancel()
+	require.NoError(t, q.Close())
+}
+
+func TestDatabaseQueue_SkipsMessagesInFlight(t *testing.T) {
+	store := newMemoryQueueStore()
+	store.extendErr = errors.New("database is locked")
+	q := NewDatabaseQueue(store, zap.NewNop(), DatabaseQueueOptions{
+		LeaseDuration: 30 * time.Millisecond,
+		PollInterval:  10 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	require.NoError(t, q.Publish("events", message.NewMessage("1", []byte("first"))))
+	messages, err := q.Subscribe(ctx, "events")
+	require.NoError(t, err)
+	first := receive(t, messages)
+
+	// The expired lease is taken again, without delivering the message twice
+	require.Eventually(t, func() bool { return store.attempts(1) > 1 }, time.Second, 5*time.Millisecond)
+	select {
+	case msg := <-messages:
+		require.FailNow(t, "message in flight delivered again", msg.UUID)
+	case <-time.After(100 * time.Millisecond):
+	}
+	first.Ack()
+	assert.Eventually(t, func() bool { return store.len() == 0 }, time.Second, 5*time.Millisecond)
+
+	cancel()
+	require.NoError(t, q.Close())
+}
+
+func TestAggregator_DurableQueue_AckAfterPersistence(t *testing.T) {
+	store := newMemoryQueueStore()
+	q := NewDatabaseQueue(store, zap.NewNop(), DatabaseQueueOptions{PollInterval: 10 * time.Millisecond})
+	aggr := NewAggregator(zap.NewNop(), nil, AggregatorOptions{Queue: q})
+	ctx, cancel := context.WithCancel(newcontext.WithLogger(context.Background(), zap.NewNop()))
+	defer cancel()
+	require.NoError(t, aggr.Subscribe(ctx))
+	go aggr.Consumer(ctx)() //nolint:errcheck
+
+	require.NoError(t, aggr.Publish(ctx, ProjectEventMessage{ProjectID: 1, Event: Event{EventId: "fc6d8c0c43fc4630ad850ee518f1b9d0"}}))
+	var batches [][]AggregatedEvent
+	require.Eventually(t, func() bool {
+		batches = append(batches, aggr.Flush()...)
+		return len(batches) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// The message is kept until the event is persisted
+	assert.Equal(t, 1, store.len())
+	aggr.Settle(batches[0], true)
+	assert.Eventually(t, func() bool { return store.len() == 0 }, time.Second, 5*time.Millisecond)
+
+	cancel()
+	require.NoError(t, aggr.Close())
+}
+
+func TestDatabaseQueue_Depth(t *testing.T) {
+	store := newMemoryQueueStore()
+	q := NewDatabaseQueue(store, zap.NewNop(), DatabaseQueueOptions{})
+	newMessage := func(uuid, partitionKey string) *message.Message {
+		m := message.NewMessage(uuid, nil)
+		m.Metadata.Set(MetadataPartitionKey, partitionKey)
+		return m
+	}
+	require.NoError(t, q.Publish("events",
+		newMessage("1", "1"), newMessage("2", "1"), newMessage("3", "2"), newMessage("4", "")))
+
+	d, err := q.Depth(context.Background(), "events")
+	require.NoError(t, err)
+	assert.Equal(t, QueueDepth{Total: 4, Projects: map[uint]int{1: 2, 2: 1}}, d)
+	require.NoError(t, q.Close())
+}
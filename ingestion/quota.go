@@ -0,0 +1,255 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/georgepsarakis/periscope/repository"
+)
+
+var (
+	ErrRateLimited = errors.New("project rate limit exceeded")
+	ErrOverQuota   = errors.New("project quota exceeded")
+)
+
+// LimitError reports the project limit that rejected an event and when events are accepted again.
+type LimitError struct {
+	ProjectID  uint
+	Outcome    repository.Outcome
+	Limit      int
+	RetryAfter time.Duration
+}
+
+func (e LimitError) Error() string {
+	return fmt.Sprintf("%s for project %d: limit %d, retry after %s", e.Unwrap(), e.ProjectID, e.Limit, e.RetryAfter)
+}
+
+func (e LimitError) Unwrap() error {
+	if e.Outcome == repository.OutcomeRateLimited {
+		return ErrRateLimited
+	}
+	return ErrOverQuota
+}
+
+// QuotaStore provides the project limits and persists the usage counters.
+type QuotaStore interface {
+	ProjectLimitsFindByProjectID(ctx context.Context, projectID uint) (repository.ProjectLimits, error)
+	ProjectUsageIncrement(ctx context.Context, projectID uint, day time.Time, counts map[repository.Outcome]int) error
+	ProjectUsageAccepted(ctx context.Context, projectID uint, from, to time.Time) (int, error)
+}
+
+// usageRefreshInterval limits how often the stored usage of a project is queried. Processes that ingest
+// concurrently see the events accepted by the others with this delay, so quotas may be exceeded slightly.
+const usageRefreshInterval = 10 * time.Second
+
+type usageKey struct {
+	projectID uint
+	day       time.Time
+}
+
+// projectQuota tracks the events per minute and the accepted events of the current day and month. Events
+// that passed the check and are being published are reserved, until they are recorded or released.
+type projectQuota struct {
+	window      time.Time
+	windowCount int
+	day         time.Time
+	daily       int
+	monthly     int
+	reserved    int
+	refreshedAt time.Time
+}
+
+// Quotas enforces the events per minute limits and the daily and monthly quotas of projects. Outcomes are
+// counted in memory and added to the stored usage periodically by the scheduler.
+//
+// The events per minute limit is tracked in the memory of each process, so every ingesting process allows
+// the configured rate. The quotas are shared through the stored usage.
+type Quotas struct {
+	store    QuotaStore
+	logger   *zap.Logger
+	interval time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	projects map[uint]*projectQuota
+	usage    *counters[usageKey, repository.Outcome]
+
+	// flushMu serializes the usage refreshes with the flushes, so that counters being stored are neither
+	// missed nor counted twice.
+	flushMu sync.Mutex
+}
+
+func NewQuotas(logger *zap.Logger, store QuotaStore, flushInterval time.Duration) *Quotas {
+	return &Quotas{
+		store:    store,
+		logger:   logger,
+		interval: flushInterval,
+		now:      repository.UTCNow,
+		projects: make(map[uint]*projectQuota),
+		usage:    newCounters[usageKey, repository.Outcome](),
+	}
+}
+
+// Check verifies that the project may submit another event and reserves it. Rejections are counted, accepted
+// events must be recorded with Record once they are published, or released with Release if publishing fails.
+func (q *Quotas) Check(ctx context.Context, projectID uint) error {
+	limits, err := q.store.ProjectLimitsFindByProjectID(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	if limits.EventsPerMinute <= 0 && limits.DailyQuota <= 0 && limits.MonthlyQuota <= 0 {
+		return nil
+	}
+	now := q.now()
+	day := startOfDay(now)
+	if limits.DailyQuota > 0 || limits.MonthlyQuota > 0 {
+		if err := q.refreshUsage(ctx, projectID, now); err != nil {
+			return err
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	pq := q.project(projectID)
+	if window := now.Truncate(time.Minute); !pq.window.Equal(window) {
+		pq.window = window
+		pq.windowCount = 0
+	}
+	var limitErr *LimitError
+	switch {
+	case limits.EventsPerMinute > 0 && pq.windowCount >= limits.EventsPerMinute:
+		limitErr = &LimitError{Outcome: repository.OutcomeRateLimited, Limit: limits.EventsPerMinute,
+			RetryAfter: pq.window.Add(time.Minute).Sub(now)}
+	case limits.DailyQuota > 0 && pq.daily+pq.reserved >= limits.DailyQuota:
+		limitErr = &LimitError{Outcome: repository.OutcomeOverQuota, Limit: limits.DailyQuota,
+			RetryAfter: day.AddDate(0, 0, 1).Sub(now)}
+	case limits.MonthlyQuota > 0 && pq.monthly+pq.reserved >= limits.MonthlyQuota:
+		limitErr = &LimitError{Outcome: repository.OutcomeOverQuota, Limit: limits.MonthlyQuota,
+			RetryAfter: startOfMonth(now).AddDate(0, 1, 0).Sub(now)}
+	}
+	if limitErr != nil {
+		limitErr.ProjectID = projectID
+		q.usage.add(usageKey{projectID: projectID, day: day}, limitErr.Outcome, 1)
+		return *limitErr
+	}
+	pq.windowCount++
+	pq.reserved++
+	return nil
+}
+
+// Record counts the outcome of an event of the project. Accepted events take the place of their reservation.
+func (q *Quotas) Record(projectID uint, outcome repository.Outcome) {
+	now := q.now()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.usage.add(usageKey{projectID: projectID, day: startOfDay(now)}, outcome, 1)
+	if outcome != repository.OutcomeAccepted {
+		return
+	}
+	pq, ok := q.projects[projectID]
+	if !ok {
+		return
+	}
+	if pq.reserved > 0 {
+		pq.reserved--
+	}
+	if pq.day.Equal(startOfDay(now)) {
+		pq.daily++
+		pq.monthly++
+	}
+}
+
+// Release returns the reservation of an event that passed the check but was not published.
+func (q *Quotas) Release(projectID uint) {
+	now := q.now()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	pq, ok := q.projects[projectID]
+	if !ok {
+		return
+	}
+	if pq.reserved > 0 {
+		pq.reserved--
+	}
+	if pq.windowCount > 0 && pq.window.Equal(now.Truncate(time.Minute)) {
+		pq.windowCount--
+	}
+}
+
+func (q *Quotas) project(projectID uint) *projectQuota {
+	pq, ok := q.projects[projectID]
+	if !ok {
+		pq = &projectQuota{}
+		q.projects[projectID] = pq
+	}
+	return pq
+}
+
+// refreshUsage reloads the accepted events of the project from the store, adding the ones not flushed yet.
+func (q *Quotas) refreshUsage(ctx context.Context, projectID uint, now time.Time) error {
+	day := startOfDay(now)
+	q.mu.Lock()
+	pq := q.project(projectID)
+	fresh := pq.day.Equal(day) && now.Sub(pq.refreshedAt) < usageRefreshInterval
+	q.mu.Unlock()
+	if fresh {
+		return nil
+	}
+	month := startOfMonth(now)
+	q.flushMu.Lock()
+	defer q.flushMu.Unlock()
+	daily, err := q.store.ProjectUsageAccepted(ctx, projectID, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return err
+	}
+	monthly, err := q.store.ProjectUsageAccepted(ctx, projectID, month, month.AddDate(0, 1, 0))
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.usage.each(func(key usageKey, counts map[repository.Outcome]int) {
+		if key.projectID != projectID || key.day.Before(month) {
+			return
+		}
+		monthly += counts[repository.OutcomeAccepted]
+		if key.day.Equal(day) {
+			daily += counts[repository.OutcomeAccepted]
+		}
+	})
+	pq.day = day
+	pq.daily = daily
+	pq.monthly = monthly
+	pq.refreshedAt = now
+	return nil
+}
+
+// Flush adds the outcomes counted since the previous flush to the stored usage.
+func (q *Quotas) Flush(ctx context.Context) error {
+	q.flushMu.Lock()
+	defer q.flushMu.Unlock()
+	return q.usage.flush(ctx, func(ctx context.Context, key usageKey, counts map[repository.Outcome]int) error {
+		return q.store.ProjectUsageIncrement(ctx, key.projectID, key.day, counts)
+	})
+}
+
+func (q *Quotas) Scheduler(ctx context.Context) func() error {
+	return func() error {
+		return flushCounters(ctx, q.logger, q.interval, "project usage", q.Flush)
+	}
+}
+
+func startOfDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+func startOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,189 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/georgepsarakis/periscope/repository"
+)
+
+type memoryQuotaStore struct {
+	mu           sync.Mutex
+	limits       map[uint]repository.ProjectLimits
+	usage        map[usageKey]map[repository.Outcome]int
+	incrementErr error
+}
+
+func newMemoryQuotaStore(limits ...repository.ProjectLimits) *memoryQuotaStore {
+	s := &memoryQuotaStore{
+		limits: map[uint]repository.ProjectLimits{},
+		usage:  map[usageKey]map[repository.Outcome]int{},
+	}
+	for _, l := range limits {
+		s.limits[l.ProjectID] = l
+	}
+	return s
+}
+
+func (s *memoryQuotaStore) ProjectLimitsFindByProjectID(_ context.Context, projectID uint) (repository.ProjectLimits, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limits[projectID], nil
+}
+
+func (s *memoryQuotaStore) ProjectUsageIncrement(_ context.Context, projectID uint, day time.Time, counts map[repository.Outcome]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.incrementErr != nil {
+		return s.incrementErr
+	}
+	key := usageKey{projectID: projectID, day: day}
+	if s.usage[key] == nil {
+		s.usage[key] = map[repository.Outcome]int{}
+	}
+	for outcome, n := range counts {
+		s.usage[key][outcome] += n
+	}
+	return nil
+}
+
+func (s *memoryQuotaStore) ProjectUsageAccepted(_ context.Context, projectID uint, from, to time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	accepted := 0
+	for key, counts := range s.usage {
+		if key.projectID == projectID && !key.day.Before(from) && key.day.Before(to) {
+			accepted += counts[repository.OutcomeAccepted]
+		}
+	}
+	return accepted, nil
+}
+
+func TestQuotas_Check_RateLimit(t *testing.T) {
+	store := newMemoryQuotaStore(repository.ProjectLimits{ProjectID: 1, EventsPerMinute: 2})
+	q := NewQuotas(zap.NewNop(), store, time.Second)
+	now := time.Date(2026, 10, 18, 12, 30, 15, 0, time.UTC)
+	q.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	require.NoError(t, q.Check(ctx, 1))
+	require.NoError(t, q.Check(ctx, 1))
+	err := q.Check(ctx, 1)
+	require.ErrorIs(t, err, ErrRateLimited)
+	var limitErr LimitError
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, LimitError{ProjectID: 1, Outcome: repository.OutcomeRateLimited, Limit: 2, RetryAfter: 45 * time.Second}, limitErr)
+	// Projects without limits are not affected
+	assert.NoError(t, q.Check(ctx, 2))
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, q.Check(ctx, 1))
+
+	require.NoError(t, q.Flush(ctx))
+	day := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, map[repository.Outcome]int{repository.OutcomeRateLimited: 1}, store.usage[usageKey{projectID: 1, day: day}])
+}
+
+func TestQuotas_Check_Quotas(t *testing.T) {
+	tests := []struct {
+		name       string
+		limits     repository.ProjectLimits
+		stored     map[time.Time]int
+		limit      int
+		retryAfter time.Duration
+	}{
+		{
+			name:       "daily quota",
+			limits:     repository.ProjectLimits{ProjectID: 1, DailyQuota: 3},
+			stored:     map[time.Time]int{time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC): 1},
+			limit:      3,
+			retryAfter: 12 * time.Hour,
+		},
+		{
+			name:       "monthly quota",
+			limits:     repository.ProjectLimits{ProjectID: 1, DailyQuota: 100, MonthlyQuota: 5},
+			stored:     map[time.Time]int{time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC): 3},
+			limit:      5,
+			retryAfter: 13*24*time.Hour + 12*time.Hour,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryQuotaStore(tt.limits)
+			for day, accepted := range tt.stored {
+				require.NoError(t, store.ProjectUsageIncrement(context.Background(), 1, day,
+					map[repository.Outcome]int{repository.OutcomeAccepted: accepted}))
+			}
+			q := NewQuotas(zap.NewNop(), store, time.Second)
+			q.now = func() time.Time { return time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC) }
+			ctx := context.Background()
+
+			for range 2 {
+				require.NoError(t, q.Check(ctx, 1))
+				q.Record(1, repository.OutcomeAccepted)
+			}
+			err := q.Check(ctx, 1)
+			require.ErrorIs(t, err, ErrOverQuota)
+			var limitErr LimitError
+			require.ErrorAs(t, err, &limitErr)
+			assert.Equal(t, tt.limit, limitErr.Limit)
+			assert.Equal(t, tt.retryAfter, limitErr.RetryAfter)
+
+			// Unflushed counters are included when the stored usage is reloaded
+			require.NoError(t, q.Flush(ctx))
+			q.Record(1, repository.OutcomeAccepted)
+			q.projects[1].refreshedAt = time.Time{}
+			assert.ErrorIs(t, q.Check(ctx, 1), ErrOverQuota)
+		})
+	}
+}
+
+func TestQuotas_Release(t *testing.T) {
+	store := newMemoryQuotaStore(repository.ProjectLimits{ProjectID: 1, EventsPerMinute: 1, DailyQuota: 1})
+	q := NewQuotas(zap.NewNop(), store, time.Second)
+	q.now = func() time.Time { return time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC) }
+	ctx := context.Background()
+
+	// The reservation counts against the limits until the event is published
+	require.NoError(t, q.Check(ctx, 1))
+	assert.Error(t, q.Check(ctx, 1))
+	q.Release(1)
+	require.NoError(t, q.Check(ctx, 1))
+	q.Record(1, repository.OutcomeAccepted)
+	assert.ErrorIs(t, q.Check(ctx, 1), ErrRateLimited)
+	assert.Zero(t, q.projects[1].reserved)
+	assert.Equal(t, 1, q.projects[1].daily)
+}
+
+func TestQuotas_Flush_Failure(t *testing.T) {
+	store := newMemoryQuotaStore(repository.ProjectLimits{ProjectID: 1, DailyQuota: 2})
+	q := NewQuotas(zap.NewNop(), store, time.Second)
+	q.now = func() time.Time { return time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC) }
+	ctx := context.Background()
+
+	require.NoError(t, q.Check(ctx, 1))
+	q.Record(1, repository.OutcomeAccepted)
+	store.incrementErr = errors.New("database is locked")
+	require.Error(t, q.Flush(ctx))
+
+	// Counters that failed to be stored are still included when the stored usage is reloaded
+	q.projects[1].refreshedAt = time.Time{}
+	require.NoError(t, q.Check(ctx, 1))
+	q.Record(1, repository.OutcomeAccepted)
+	q.projects[1].refreshedAt = time.Time{}
+	assert.ErrorIs(t, q.Check(ctx, 1), ErrOverQuota)
+
+	store.incrementErr = nil
+	require.NoError(t, q.Flush(ctx))
+	assert.Empty(t, q.usage.counts)
+	day := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, map[repository.Outcome]int{repository.OutcomeAccepted: 2, repository.OutcomeOverQuota: 1},
+		store.usage[usageKey{projectID: 1, day: day}])
+}
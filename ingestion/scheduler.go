@@ -0,0 +1,96 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// counterFlushTimeout bounds each flush of the in-memory counters.
+const counterFlushTimeout = 5 * time.Second
+
+// flushCounters calls flush periodically, and a final time when the context is cancelled, so that
+// counters kept in memory are stored before the process exits.
+func flushCounters(ctx context.Context, logger *zap.Logger, interval time.Duration, name string, flush func(ctx context.Context) error) error {
+	run := func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), counterFlushTimeout)
+		defer cancel()
+		if err := flush(flushCtx); err != nil {
+			logger.Error("counters flush failed", zap.String("counters", name), zap.Error(err))
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			run()
+		case <-ctx.Done():
+			run()
+			return nil
+		}
+	}
+}
+
+// counters are in-memory counts, grouped by a key such as the project, that are added to a store on flush.
+type counters[K comparable, C comparable] struct {
+	mu     sync.Mutex
+	counts map[K]map[C]int
+}
+
+func newCounters[K comparable, C comparable]() *counters[K, C] {
+	return &counters[K, C]{counts: make(map[K]map[C]int)}
+}
+
+func (c *counters[K, C]) add(key K, counter C, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts[key] == nil {
+		c.counts[key] = make(map[C]int)
+	}
+	c.counts[key][counter] += n
+}
+
+// each calls fn with the counts of every key that are not stored yet.
+func (c *counters[K, C]) each(fn func(key K, counts map[C]int)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, counts := range c.counts {
+		fn(key, counts)
+	}
+}
+
+// flush stores the counts of each key. Counts are kept in memory until they are stored, so that they are
+// still visible to each and failed ones are retried on the next flush.
+func (c *counters[K, C]) flush(ctx context.Context, store func(ctx context.Context, key K, counts map[C]int) error) error {
+	c.mu.Lock()
+	pending := make(map[K]map[C]int, len(c.counts))
+	for key, counts := range c.counts {
+		pending[key] = maps.Clone(counts)
+	}
+	c.mu.Unlock()
+
+	var flushErr error
+	for key, counts := range pending {
+		if err := store(ctx, key, counts); err != nil {
+			flushErr = errors.Join(flushErr, err)
+			continue
+		}
+		c.mu.Lock()
+		for counter, n := range counts {
+			c.counts[key][counter] -= n
+			if c.counts[key][counter] == 0 {
+				delete(c.counts[key], counter)
+			}
+		}
+		if len(c.counts[key]) == 0 {
+			delete(c.counts, key)
+		}
+		c.mu.Unlock()
+	}
+	return flushErr
+}
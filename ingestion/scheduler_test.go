@@ -0,0 +1,34 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounters_Flush(t *testing.T) {
+	c := newCounters[uint, string]()
+	c.add(1, "accepted", 2)
+	c.add(2, "filtered", 1)
+	ctx := context.Background()
+
+	stored := map[uint]map[string]int{}
+	err := c.flush(ctx, func(_ context.Context, key uint, counts map[string]int) error {
+		if key == 2 {
+			return errors.New("database is locked")
+		}
+		// Counted while the flush is in progress
+		c.add(key, "accepted", 1)
+		stored[key] = counts
+		return nil
+	})
+	require.Error(t, err)
+	assert.Equal(t, map[uint]map[string]int{1: {"accepted": 2}}, stored)
+	assert.Equal(t, map[uint]map[string]int{1: {"accepted": 1}, 2: {"filtered": 1}}, c.counts)
+
+	require.NoError(t, c.flush(ctx, func(context.Context, uint, map[string]int) error { return nil }))
+	assert.Empty(t, c.counts)
+}
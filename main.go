@@ -1,12 +1,41 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+
+	"github.com/urfave/cli/v3"
 
 	"github.com/georgepsarakis/periscope/service"
 )
 
 func main() {
+	cmd := &cli.Command{
+		Name:  "periscope",
+		Usage: "Self-contained error aggregator",
+		Action: func(context.Context, *cli.Command) error {
+			serve()
+			return nil
+		},
+		Commands: []*cli.Command{
+			{
+				Name:  "serve",
+				Usage: "Run the server, the default command",
+				Action: func(context.Context, *cli.Command) error {
+					serve()
+					return nil
+				},
+			},
+			migrateCommand(),
+		},
+	}
+	if err := cmd.Run(context.Background(), os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func serve() {
 	server, cleanup, onErr := service.NewHTTPService(service.Options{})
 	defer func() {
 		if err := cleanup(); err != nil {
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/georgepsarakis/periscope/app"
+	"github.com/georgepsarakis/periscope/migrations"
+)
+
+func migrateCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "migrate",
+		Usage: "Manage the migrations of the Postgres schema",
+		Commands: []*cli.Command{
+			{
+				Name:   "status",
+				Usage:  "List the applied and pending migrations",
+				Action: withMigrator(migrateStatus),
+			},
+			{
+				Name:  "up",
+				Usage: "Apply the pending migrations",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "to",
+						Usage: "apply the migrations up to and including this version",
+					},
+				},
+				Action: withMigrator(migrateUp),
+			},
+			{
+				Name:  "down",
+				Usage: "Revert the last applied migration",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "to",
+						Usage: "revert the migrations applied after this version",
+					},
+					&cli.BoolFlag{
+						Name:  "all",
+						Usage: "revert all the applied migrations",
+					},
+				},
+				Action: withMigrator(migrateDown),
+			},
+		},
+	}
+}
+
+type migratorAction func(ctx context.Context, cmd *cli.Command, m *migrations.Migrator) error
+
+func withMigrator(action migratorAction) cli.ActionFunc {
+	return func(ctx context.Context, cmd *cli.Command) error {
+		m, closeDB, err := app.NewMigrator()
+		if err != nil {
+			return err
+		}
+		defer closeDB() //nolint:errcheck
+		return action(ctx, cmd, m)
+	}
+}
+
+func migrateStatus(ctx context.Context, cmd *cli.Command, m *migrations.Migrator) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(cmd.Root().Writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tDESCRIPTION\tSTATE\tAPPLIED AT")
+	pending := 0
+	for _, s := range status {
+		appliedAt := "-"
+		if !s.AppliedAt.IsZero() {
+			appliedAt = s.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		if s.State == migrations.StatePending {
+			pending++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Version, s.Description, s.State, appliedAt)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(cmd.Root().Writer, "\n%d migrations, %d pending\n", len(status), pending)
+	return err
+}
+
+func migrateUp(ctx context.Context, cmd *cli.Command, m *migrations.Migrator) error {
+	applied, err := m.Up(ctx, cmd.String("to"))
+	for _, migration := range applied {
+		fmt.Fprintf(cmd.Root().Writer, "applied %s\n", migration.Name)
+	}
+	if err == nil && len(applied) == 0 {
+		fmt.Fprintln(cmd.Root().Writer, "no pending migrations")
+	}
+	return err
+}
+
+func migrateDown(ctx context.Context, cmd *cli.Command, m *migrations.Migrator) error {
+	target := cmd.String("to")
+	if target == "" && !cmd.Bool("all") {
+		revisions, err := m.Applied(ctx)
+		if err != nil {
+			return err
+		}
+		if len(revisions) == 0 {
+			fmt.Fprintln(cmd.Root().Writer, "no applied migrations")
+			return nil
+		}
+		// Revert the last migration only
+		if len(revisions) > 1 {
+			target = revisions[len(revisions)-2].Version
+		}
+	}
+	reverted, err := m.Down(ctx, target)
+	for _, migration := range reverted {
+		fmt.Fprintf(cmd.Root().Writer, "reverted %s\n", migration.Name)
+	}
+	return err
+}
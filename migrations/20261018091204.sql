@@ -0,0 +1,6 @@
+-- Modify "events" table
+ALTER TABLE "public"."events" ADD COLUMN "client_name" text NULL, ADD COLUMN "client_version" text NULL;
+-- Modify "project_ingestion_api_keys" table
+ALTER TABLE "public"."project_ingestion_api_keys" ADD COLUMN "secret" text NULL;
+-- Modify "projects" table
+ALTER TABLE "public"."projects" ADD COLUMN "require_ingestion_secret" boolean NOT NULL DEFAULT false;
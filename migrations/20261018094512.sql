@@ -0,0 +1,2 @@
+-- Modify "events" table
+ALTER TABLE "public"."events" ADD COLUMN "exceptions" json NULL;
@@ -0,0 +1,2 @@
+-- Modify "event_groups" table
+ALTER TABLE "public"."event_groups" ADD COLUMN "grouping_version" text NOT NULL DEFAULT 'legacy';
@@ -0,0 +1,21 @@
+-- Create "project_fingerprint_rules" table
+CREATE TABLE "public"."project_fingerprint_rules" (
+  "id" bigserial NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "project_id" bigint NOT NULL,
+  "priority" bigint NOT NULL DEFAULT 0,
+  "exception_type" text NULL,
+  "message" text NULL,
+  "module" text NULL,
+  "function" text NULL,
+  "level" text NULL,
+  "tags" text NULL,
+  "fingerprint" text NOT NULL,
+  PRIMARY KEY ("id")
+);
+-- Create index "idx_project_fingerprint_rules_deleted_at" to table: "project_fingerprint_rules"
+CREATE INDEX "idx_project_fingerprint_rules_deleted_at" ON "public"."project_fingerprint_rules" ("deleted_at");
+-- Create index "idx_project_fingerprint_rules_project_id" to table: "project_fingerprint_rules"
+CREATE INDEX "idx_project_fingerprint_rules_project_id" ON "public"."project_fingerprint_rules" ("project_id");
@@ -0,0 +1,2 @@
+-- Modify "events" table
+ALTER TABLE "public"."events" ADD COLUMN "tags" json NULL, ADD COLUMN "extra" json NULL, ADD COLUMN "breadcrumbs" json NULL, ADD COLUMN "user" json NULL, ADD COLUMN "request" json NULL, ADD COLUMN "contexts" json NULL, ADD COLUMN "server_name" text NULL, ADD COLUMN "release" text NULL, ADD COLUMN "environment" text NULL, ADD COLUMN "transaction" text NULL;
@@ -0,0 +1,14 @@
+-- Modify "events" table
+ALTER TABLE "public"."events" ADD COLUMN "payload_hash" text NULL;
+-- Create "event_payloads" table
+CREATE TABLE "public"."event_payloads" (
+  "id" bigserial NOT NULL,
+  "created_at" timestamptz NULL,
+  "hash" text NOT NULL,
+  "encoding" text NOT NULL,
+  "size" bigint NOT NULL,
+  "data" bytea NOT NULL,
+  PRIMARY KEY ("id")
+);
+-- Create index "uq_event_payloads_hash" to table: "event_payloads"
+CREATE UNIQUE INDEX "uq_event_payloads_hash" ON "public"."event_payloads" ("hash");
@@ -0,0 +1,4 @@
+-- Modify "events" table
+ALTER TABLE "public"."events" ADD COLUMN "received_at" timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP;
+-- Until client timestamps were stored, "emitted_at" was set to the server time.
+UPDATE "public"."events" SET "received_at" = "emitted_at";
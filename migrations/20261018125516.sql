@@ -0,0 +1,12 @@
+-- Remove events stored more than once and subtract them from the group counters
+WITH "duplicates" AS (
+  DELETE FROM "public"."events" AS "e"
+  USING "public"."events" AS "o"
+  WHERE "e"."project_id" = "o"."project_id" AND "e"."event_id" = "o"."event_id" AND "e"."id" > "o"."id"
+  RETURNING "e"."id", "e"."event_group_id"
+)
+UPDATE "public"."event_groups" AS "g" SET "total_count" = "g"."total_count" - "d"."count"
+FROM (SELECT "event_group_id", COUNT(DISTINCT "id") AS "count" FROM "duplicates" GROUP BY "event_group_id") AS "d"
+WHERE "g"."id" = "d"."event_group_id";
+-- Create index "uq_events_project_id_event_id" to table: "events"
+CREATE UNIQUE INDEX "uq_events_project_id_event_id" ON "public"."events" ("project_id", "event_id");
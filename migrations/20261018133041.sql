@@ -0,0 +1,16 @@
+-- Create "queue_messages" table
+CREATE TABLE "public"."queue_messages" (
+  "id" bigserial NOT NULL,
+  "created_at" timestamptz NULL,
+  "topic" text NOT NULL,
+  "uuid" text NOT NULL,
+  "payload" bytea NOT NULL,
+  "metadata" text NULL,
+  "locked_until" timestamptz NULL,
+  "attempts" bigint NOT NULL DEFAULT 0,
+  PRIMARY KEY ("id")
+);
+-- Create index "idx_queue_messages_topic_locked_until" to table: "queue_messages"
+CREATE INDEX "idx_queue_messages_topic_locked_until" ON "public"."queue_messages" ("topic", "locked_until");
+-- Create index "uq_queue_messages_uuid" to table: "queue_messages"
+CREATE UNIQUE INDEX "uq_queue_messages_uuid" ON "public"."queue_messages" ("uuid");
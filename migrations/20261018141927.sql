@@ -0,0 +1,2 @@
+-- Modify "queue_messages" table
+ALTER TABLE "public"."queue_messages" ADD COLUMN "partition_key" text NULL;
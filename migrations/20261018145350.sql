@@ -0,0 +1,31 @@
+-- Create "project_limits" table
+CREATE TABLE "public"."project_limits" (
+  "id" bigserial NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "project_id" bigint NOT NULL,
+  "events_per_minute" bigint NOT NULL DEFAULT 0,
+  "daily_quota" bigint NOT NULL DEFAULT 0,
+  "monthly_quota" bigint NOT NULL DEFAULT 0,
+  PRIMARY KEY ("id")
+);
+-- Create index "idx_project_limits_deleted_at" to table: "project_limits"
+CREATE INDEX "idx_project_limits_deleted_at" ON "public"."project_limits" ("deleted_at");
+-- Create index "uq_project_limits_project_id" to table: "project_limits"
+CREATE UNIQUE INDEX "uq_project_limits_project_id" ON "public"."project_limits" ("project_id");
+-- Create "project_usages" table
+CREATE TABLE "public"."project_usages" (
+  "id" bigserial NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "project_id" bigint NOT NULL,
+  "day" timestamptz NOT NULL,
+  "accepted" bigint NOT NULL DEFAULT 0,
+  "rate_limited" bigint NOT NULL DEFAULT 0,
+  "over_quota" bigint NOT NULL DEFAULT 0,
+  "filtered" bigint NOT NULL DEFAULT 0,
+  PRIMARY KEY ("id")
+);
+-- Create index "uq_project_usages_project_id_day" to table: "project_usages"
+CREATE UNIQUE INDEX "uq_project_usages_project_id_day" ON "public"."project_usages" ("project_id", "day");
@@ -0,0 +1,17 @@
+-- Create "project_inbound_filters" table
+CREATE TABLE "public"."project_inbound_filters" (
+  "id" bigserial NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "project_id" bigint NOT NULL,
+  "type" text NOT NULL,
+  "pattern" text NULL,
+  "filtered_count" bigint NOT NULL DEFAULT 0,
+  "last_filtered_at" timestamptz NULL,
+  PRIMARY KEY ("id")
+);
+-- Create index "idx_project_inbound_filters_deleted_at" to table: "project_inbound_filters"
+CREATE INDEX "idx_project_inbound_filters_deleted_at" ON "public"."project_inbound_filters" ("deleted_at");
+-- Create index "idx_project_inbound_filters_project_id" to table: "project_inbound_filters"
+CREATE INDEX "idx_project_inbound_filters_project_id" ON "public"."project_inbound_filters" ("project_id");
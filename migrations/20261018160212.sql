@@ -0,0 +1,4 @@
+-- Modify "event_groups" table
+ALTER TABLE "public"."event_groups" ADD COLUMN "stored_count" bigint NOT NULL DEFAULT 0, ADD COLUMN "sample_window_start" timestamptz NULL, ADD COLUMN "sample_window_count" bigint NOT NULL DEFAULT 0;
+-- Count the events stored before sampling was introduced
+UPDATE "public"."event_groups" SET "stored_count" = (SELECT COUNT(*) FROM "public"."events" WHERE "events"."event_group_id" = "event_groups"."id");
@@ -0,0 +1,14 @@
+-- Create "dead_letter_events" table
+CREATE TABLE "public"."dead_letter_events" (
+  "id" bigserial NOT NULL,
+  "created_at" timestamptz NULL,
+  "project_id" bigint NOT NULL,
+  "event_id" text NULL,
+  "stage" text NOT NULL,
+  "error" text NOT NULL,
+  "attempts" bigint NOT NULL DEFAULT 0,
+  "payload" bytea NOT NULL,
+  PRIMARY KEY ("id")
+);
+-- Create index "idx_dead_letter_events_project_id" to table: "dead_letter_events"
+CREATE INDEX "idx_dead_letter_events_project_id" ON "public"."dead_letter_events" ("project_id");
@@ -0,0 +1,29 @@
+-- Merge event groups created more than once for the same aggregation key into the oldest one
+CREATE TEMPORARY TABLE "event_group_duplicates" AS
+SELECT "g"."id", "k"."keep_id" FROM "public"."event_groups" AS "g"
+JOIN (
+  SELECT "project_id", "aggregation_key", MIN("id") AS "keep_id" FROM "public"."event_groups"
+  GROUP BY "project_id", "aggregation_key" HAVING COUNT(*) > 1
+) AS "k" ON "g"."project_id" = "k"."project_id" AND "g"."aggregation_key" = "k"."aggregation_key"
+WHERE "g"."id" <> "k"."keep_id";
+UPDATE "public"."event_groups" AS "g" SET
+  "total_count" = "g"."total_count" + "s"."total_count",
+  "stored_count" = "g"."stored_count" + "s"."stored_count",
+  "event_received_at" = GREATEST("g"."event_received_at", "s"."event_received_at")
+FROM (
+  SELECT "d"."keep_id", SUM("e"."total_count") AS "total_count", SUM("e"."stored_count") AS "stored_count",
+    MAX("e"."event_received_at") AS "event_received_at"
+  FROM "event_group_duplicates" AS "d" JOIN "public"."event_groups" AS "e" ON "e"."id" = "d"."id"
+  GROUP BY "d"."keep_id"
+) AS "s"
+WHERE "g"."id" = "s"."keep_id";
+UPDATE "public"."events" AS "e" SET "event_group_id" = "d"."keep_id"
+FROM "event_group_duplicates" AS "d" WHERE "e"."event_group_id" = "d"."id";
+UPDATE "public"."alerts" AS "a" SET "event_group_id" = "d"."keep_id"
+FROM "event_group_duplicates" AS "d" WHERE "a"."event_group_id" = "d"."id";
+DELETE FROM "public"."event_groups" AS "g" USING "event_group_duplicates" AS "d" WHERE "g"."id" = "d"."id";
+DROP TABLE "event_group_duplicates";
+-- Drop index "idx_proj_aggr_key" from table: "event_groups"
+DROP INDEX "public"."idx_proj_aggr_key";
+-- Create index "uq_event_groups_project_id_aggregation_key" to table: "event_groups"
+CREATE UNIQUE INDEX "uq_event_groups_project_id_aggregation_key" ON "public"."event_groups" ("project_id", "aggregation_key");
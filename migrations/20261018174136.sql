@@ -0,0 +1,21 @@
+-- Modify "event_groups" table
+ALTER TABLE "public"."event_groups" ADD COLUMN "resolved_at" timestamptz NULL;
+-- Create index "idx_events_payload_hash" to table: "events"
+CREATE INDEX "idx_events_payload_hash" ON "public"."events" ("payload_hash");
+-- Create index "idx_events_project_id_received_at" to table: "events"
+CREATE INDEX "idx_events_project_id_received_at" ON "public"."events" ("project_id", "received_at");
+-- Create "project_retentions" table
+CREATE TABLE "public"."project_retentions" (
+  "id" bigserial NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "project_id" bigint NOT NULL,
+  "event_days" bigint NULL,
+  "resolved_group_days" bigint NULL,
+  PRIMARY KEY ("id")
+);
+-- Create index "idx_project_retentions_deleted_at" to table: "project_retentions"
+CREATE INDEX "idx_project_retentions_deleted_at" ON "public"."project_retentions" ("deleted_at");
+-- Create index "uq_project_retentions_project_id" to table: "project_retentions"
+CREATE UNIQUE INDEX "uq_project_retentions_project_id" ON "public"."project_retentions" ("project_id");
@@ -0,0 +1,8 @@
+-- Drop the initial tables
+DROP TABLE "public"."projects";
+DROP TABLE "public"."project_alert_destinations";
+DROP TABLE "public"."events";
+DROP TABLE "public"."event_groups";
+DROP TABLE "public"."alerts";
+DROP TABLE "public"."alert_destination_types";
+DROP TABLE "public"."alert_destination_notifications";
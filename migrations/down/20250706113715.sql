@@ -0,0 +1,8 @@
+-- Drop "ingestion_api_keys" table
+DROP TABLE "public"."ingestion_api_keys";
+-- Modify "projects" table
+ALTER TABLE "public"."projects" ADD COLUMN "api_key_event_forwarding" text NOT NULL DEFAULT '';
+-- Drop index "idx_alert_destination_notifications_completed_at" from table: "alert_destination_notifications"
+DROP INDEX "public"."idx_alert_destination_notifications_completed_at";
+-- Modify "alert_destination_notifications" table
+ALTER TABLE "public"."alert_destination_notifications" DROP COLUMN "completed_at", DROP COLUMN "total_attempts";
@@ -0,0 +1 @@
+DELETE FROM alert_destination_types WHERE key IN ('internal.logger.error', 'external.webhook.post');
@@ -0,0 +1,2 @@
+-- Drop index "uq_project_alert_destination_type_key" from table: "alert_destination_types"
+DROP INDEX "public"."uq_project_alert_destination_type_key";
@@ -0,0 +1,2 @@
+-- Modify "alerts" table
+ALTER TABLE "public"."alerts" DROP COLUMN "project_id";
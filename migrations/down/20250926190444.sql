@@ -0,0 +1 @@
+ALTER TABLE "public"."events" DROP COLUMN "title";
@@ -0,0 +1,23 @@
+-- Create "ingestion_api_keys" table
+CREATE TABLE "public"."ingestion_api_keys" (
+  "id" bigserial NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "key" text NOT NULL,
+  "project_id" bigint NOT NULL,
+  "expires_at" timestamptz NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_projects_ingestion_api_keys" FOREIGN KEY ("project_id") REFERENCES "public"."projects" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION
+);
+CREATE INDEX "idx_ingestion_api_keys_deleted_at" ON "public"."ingestion_api_keys" ("deleted_at");
+CREATE INDEX "idx_project_id" ON "public"."ingestion_api_keys" ("project_id");
+-- Keep the keys created since
+INSERT INTO "public"."ingestion_api_keys" SELECT "id", "created_at", "updated_at", "deleted_at", "key", "project_id", "expires_at"
+FROM "public"."project_ingestion_api_keys";
+-- Drop "project_ingestion_api_keys" table
+DROP TABLE "public"."project_ingestion_api_keys";
+-- Modify "project_alert_destinations" table
+ALTER TABLE "public"."project_alert_destinations" DROP CONSTRAINT "fk_project_alert_destinations_alert_destination_type";
+-- Modify "events" table
+ALTER TABLE "public"."events" ALTER COLUMN "title" DROP NOT NULL;
@@ -0,0 +1,4 @@
+-- Drop index "idx_project_id" from table: "project_ingestion_api_keys"
+DROP INDEX "public"."idx_project_id";
+-- Modify "alerts" table
+ALTER TABLE "public"."alerts" DROP COLUMN "title", DROP COLUMN "description";
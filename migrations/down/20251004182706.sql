@@ -0,0 +1,5 @@
+DELETE FROM alert_destination_types WHERE key = 'external.webhook.slack';
+
+UPDATE alert_destination_types
+SET title = 'Webhook', key='external.webhook.post'
+WHERE key='external.webhook.generic';
@@ -0,0 +1,6 @@
+-- Modify "project_ingestion_api_keys" table
+ALTER TABLE "public"."project_ingestion_api_keys" DROP CONSTRAINT "fk_projects_project_ingestion_api_keys", ADD CONSTRAINT "fk_projects_ingestion_api_keys" FOREIGN KEY ("project_id") REFERENCES "public"."projects" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION;
+-- Drop "alert_destination_notification_webhook_configurations" table
+DROP TABLE "public"."alert_destination_notification_webhook_configurations";
+-- Modify "project_alert_destinations" table
+ALTER TABLE "public"."project_alert_destinations" ADD COLUMN "configuration" json NULL;
@@ -0,0 +1,2 @@
+-- Modify "alert_destination_notifications" table
+ALTER TABLE "public"."alert_destination_notifications" DROP COLUMN "last_error", DROP COLUMN "attempted_at";
@@ -0,0 +1,6 @@
+-- Modify "projects" table
+ALTER TABLE "public"."projects" DROP COLUMN "require_ingestion_secret";
+-- Modify "project_ingestion_api_keys" table
+ALTER TABLE "public"."project_ingestion_api_keys" DROP COLUMN "secret";
+-- Modify "events" table
+ALTER TABLE "public"."events" DROP COLUMN "client_name", DROP COLUMN "client_version";
@@ -0,0 +1,2 @@
+-- Modify "event_groups" table
+ALTER TABLE "public"."event_groups" DROP COLUMN "grouping_version";
@@ -0,0 +1,2 @@
+-- Drop "project_fingerprint_rules" table
+DROP TABLE "public"."project_fingerprint_rules";
@@ -0,0 +1,2 @@
+-- Modify "events" table
+ALTER TABLE "public"."events" DROP COLUMN "tags", DROP COLUMN "extra", DROP COLUMN "breadcrumbs", DROP COLUMN "user", DROP COLUMN "request", DROP COLUMN "contexts", DROP COLUMN "server_name", DROP COLUMN "release", DROP COLUMN "environment", DROP COLUMN "transaction";
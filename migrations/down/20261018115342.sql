@@ -0,0 +1,4 @@
+-- Drop "event_payloads" table
+DROP TABLE "public"."event_payloads";
+-- Modify "events" table
+ALTER TABLE "public"."events" DROP COLUMN "payload_hash";
@@ -0,0 +1,3 @@
+-- Drop index "uq_events_project_id_event_id" from table: "events"
+-- The removed duplicate events are not restored.
+DROP INDEX "public"."uq_events_project_id_event_id";
@@ -0,0 +1,2 @@
+-- Drop "queue_messages" table
+DROP TABLE "public"."queue_messages";
@@ -0,0 +1,2 @@
+-- Modify "queue_messages" table
+ALTER TABLE "public"."queue_messages" DROP COLUMN "partition_key";
@@ -0,0 +1,4 @@
+-- Drop "project_usages" table
+DROP TABLE "public"."project_usages";
+-- Drop "project_limits" table
+DROP TABLE "public"."project_limits";
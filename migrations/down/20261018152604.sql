@@ -0,0 +1,2 @@
+-- Drop "project_inbound_filters" table
+DROP TABLE "public"."project_inbound_filters";
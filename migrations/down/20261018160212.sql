@@ -0,0 +1,2 @@
+-- Modify "event_groups" table
+ALTER TABLE "public"."event_groups" DROP COLUMN "stored_count", DROP COLUMN "sample_window_start", DROP COLUMN "sample_window_count";
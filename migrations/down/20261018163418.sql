@@ -0,0 +1,2 @@
+-- Drop "dead_letter_events" table
+DROP TABLE "public"."dead_letter_events";
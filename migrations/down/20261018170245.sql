@@ -0,0 +1,5 @@
+-- Drop index "uq_event_groups_project_id_aggregation_key" from table: "event_groups"
+-- The merged event groups are not split again.
+DROP INDEX "public"."uq_event_groups_project_id_aggregation_key";
+-- Create index "idx_proj_aggr_key" to table: "event_groups"
+CREATE INDEX "idx_proj_aggr_key" ON "public"."event_groups" ("project_id", "aggregation_key");
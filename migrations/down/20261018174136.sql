@@ -0,0 +1,8 @@
+-- Drop "project_retentions" table
+DROP TABLE "public"."project_retentions";
+-- Drop index "idx_events_project_id_received_at" from table: "events"
+DROP INDEX "public"."idx_events_project_id_received_at";
+-- Drop index "idx_events_payload_hash" from table: "events"
+DROP INDEX "public"."idx_events_payload_hash";
+-- Modify "event_groups" table
+ALTER TABLE "public"."event_groups" DROP COLUMN "resolved_at";
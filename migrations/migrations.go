@@ -0,0 +1,163 @@
+// Package migrations embeds the Atlas migration files of the Postgres schema and applies them.
+package migrations
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+//go:embed *.sql atlas.sum down/*.sql
+var files embed.FS
+
+const (
+	sumFile = "atlas.sum"
+	// downDir holds the scripts reverting each migration, named after its version. The directory is
+	// ignored by Atlas and not covered by atlas.sum.
+	downDir = "down"
+)
+
+// ErrChecksumMismatch is returned when the migration files do not match the checksums of atlas.sum,
+// e.g. a migration was edited without regenerating the sum file with `atlas migrate hash`.
+var ErrChecksumMismatch = errors.New("migration checksum mismatch")
+
+// ErrUnknownVersion is returned for a version that does not match any migration.
+var ErrUnknownVersion = errors.New("unknown migration version")
+
+// ErrIrreversible is returned when reverting a migration that has no down script.
+var ErrIrreversible = errors.New("migration cannot be reverted")
+
+// Migration is a versioned SQL file of the migration directory.
+type Migration struct {
+	Version     string
+	Description string
+	Name        string
+	// Hash is the atlas.sum checksum of the file, which covers all the preceding files as well.
+	Hash string
+	SQL  string
+	// DownSQL reverts the migration, it is empty when the migration cannot be reverted.
+	DownSQL string
+}
+
+// Embedded returns the migrations compiled into the binary.
+func Embedded() ([]Migration, error) {
+	return Load(files)
+}
+
+// Load reads the migrations of the directory in version order and verifies them against atlas.sum.
+func Load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	sum, err := fs.ReadFile(fsys, sumFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", sumFile, err)
+	}
+	total, expected, err := parseSum(sum)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(names))
+	h := sha256.New()
+	for _, name := range names {
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		h.Write([]byte(name))
+		h.Write(content)
+		hash := base64.StdEncoding.EncodeToString(h.Sum(nil))
+		if expected[name] != hash {
+			return nil, fmt.Errorf("%w: %s", ErrChecksumMismatch, name)
+		}
+		version, description, _ := strings.Cut(strings.TrimSuffix(path.Base(name), ".sql"), "_")
+		migrations = append(migrations, Migration{
+			Version:     version,
+			Description: description,
+			Name:        name,
+			Hash:        hash,
+			SQL:         string(content),
+		})
+	}
+	if len(expected) != len(migrations) {
+		return nil, fmt.Errorf("%w: %s lists %d files, found %d", ErrChecksumMismatch, sumFile, len(expected), len(migrations))
+	}
+	if sumOf(migrations) != total {
+		return nil, fmt.Errorf("%w: %s", ErrChecksumMismatch, sumFile)
+	}
+	if err := loadDown(fsys, migrations); err != nil {
+		return nil, err
+	}
+	return migrations, nil
+}
+
+// loadDown reads the down scripts of the migrations.
+func loadDown(fsys fs.FS, migrations []Migration) error {
+	names, err := fs.Glob(fsys, path.Join(downDir, "*.sql"))
+	if err != nil {
+		return err
+	}
+	versions := make(map[string]int, len(migrations))
+	for i, m := range migrations {
+		versions[m.Version] = i
+	}
+	for _, name := range names {
+		version := strings.TrimSuffix(path.Base(name), ".sql")
+		i, ok := versions[version]
+		if !ok {
+			return fmt.Errorf("%w: down script %s", ErrUnknownVersion, name)
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		migrations[i].DownSQL = string(content)
+	}
+	return nil
+}
+
+// parseSum returns the total checksum and the checksum of each file of atlas.sum.
+func parseSum(sum []byte) (string, map[string]string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sum))
+	if !scanner.Scan() {
+		return "", nil, fmt.Errorf("%w: %s is empty", ErrChecksumMismatch, sumFile)
+	}
+	total, ok := strings.CutPrefix(scanner.Text(), "h1:")
+	if !ok {
+		return "", nil, fmt.Errorf("%w: malformed %s", ErrChecksumMismatch, sumFile)
+	}
+	hashes := make(map[string]string)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		name, hash, ok := strings.Cut(line, " h1:")
+		if !ok {
+			return "", nil, fmt.Errorf("%w: malformed %s line %q", ErrChecksumMismatch, sumFile, line)
+		}
+		hashes[name] = hash
+	}
+	return total, hashes, scanner.Err()
+}
+
+// sumOf computes the total checksum of atlas.sum from the file checksums.
+func sumOf(migrations []Migration) string {
+	h := sha256.New()
+	for _, m := range migrations {
+		h.Write([]byte(m.Name))
+		h.Write([]byte(m.Hash))
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,132 @@
+package migrations
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io/fs"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFS returns a migration directory with the atlas.sum of the given files.
+func newTestFS(files map[string]string) fstest.MapFS {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if strings.HasPrefix(name, downDir+"/") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fsys := fstest.MapFS{}
+	for name, content := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	var migrations []Migration
+	lines := strings.Builder{}
+	h := sha256.New()
+	for _, name := range names {
+		h.Write([]byte(name))
+		h.Write([]byte(files[name]))
+		hash := base64.StdEncoding.EncodeToString(h.Sum(nil))
+		migrations = append(migrations, Migration{Name: name, Hash: hash})
+		lines.WriteString(name + " h1:" + hash + "\n")
+	}
+	fsys[sumFile] = &fstest.MapFile{Data: []byte("h1:" + sumOf(migrations) + "\n" + lines.String())}
+	return fsys
+}
+
+func TestEmbedded(t *testing.T) {
+	migrations, err := Embedded()
+	require.NoError(t, err)
+
+	names, err := fs.Glob(files, "*.sql")
+	require.NoError(t, err)
+	require.Len(t, migrations, len(names))
+	assert.Equal(t, "20250706045724", migrations[0].Version)
+	assert.Empty(t, migrations[0].Description)
+	assert.Equal(t, "20250713183743", migrations[2].Version)
+	assert.Equal(t, "add_default_alert_destination_types", migrations[2].Description)
+	for i := 1; i < len(migrations); i++ {
+		assert.Less(t, migrations[i-1].Version, migrations[i].Version)
+	}
+	for _, m := range migrations {
+		assert.NotEmpty(t, m.DownSQL, m.Name)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	valid := map[string]string{
+		"20260101000000.sql":          "CREATE TABLE a (id INTEGER);",
+		"20260102000000_add_b.sql":    "CREATE TABLE b (id INTEGER);",
+		"20260103000000_insert_a.sql": "INSERT INTO a VALUES (1);",
+		"down/20260102000000.sql":     "DROP TABLE b;",
+	}
+	tests := []struct {
+		name   string
+		tamper func(fsys fstest.MapFS)
+		err    error
+	}{
+		{
+			name: "modified file",
+			tamper: func(fsys fstest.MapFS) {
+				fsys["20260102000000_add_b.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE c (id INTEGER);")}
+			},
+		},
+		{
+			name: "file missing from the sum",
+			tamper: func(fsys fstest.MapFS) {
+				fsys["20260104000000.sql"] = &fstest.MapFile{Data: []byte("DROP TABLE a;")}
+			},
+		},
+		{
+			name: "deleted file",
+			tamper: func(fsys fstest.MapFS) {
+				delete(fsys, "20260103000000_insert_a.sql")
+			},
+		},
+		{
+			name: "modified total",
+			tamper: func(fsys fstest.MapFS) {
+				sum := string(fsys[sumFile].Data)
+				fsys[sumFile] = &fstest.MapFile{Data: []byte("h1:AAAA" + strings.TrimPrefix(sum, "h1:"))}
+			},
+		},
+		{
+			name: "down script of an unknown version",
+			tamper: func(fsys fstest.MapFS) {
+				fsys["down/20260104000000.sql"] = &fstest.MapFile{Data: []byte("DROP TABLE a;")}
+			},
+			err: ErrUnknownVersion,
+		},
+		{
+			name: "malformed sum",
+			tamper: func(fsys fstest.MapFS) {
+				fsys[sumFile] = &fstest.MapFile{Data: []byte("20260101000000.sql\n")}
+			},
+		},
+	}
+	migrations, err := Load(newTestFS(valid))
+	require.NoError(t, err)
+	require.Len(t, migrations, 3)
+	assert.Equal(t, "add_b", migrations[1].Description)
+	assert.Equal(t, "DROP TABLE b;", migrations[1].DownSQL)
+	assert.Empty(t, migrations[2].DownSQL)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := newTestFS(valid)
+			tt.tamper(fsys)
+			_, err := Load(fsys)
+			if tt.err == nil {
+				tt.err = ErrChecksumMismatch
+			}
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
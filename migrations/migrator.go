@@ -0,0 +1,281 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// advisoryLockID serializes migrations of processes starting concurrently against the same Postgres database.
+const advisoryLockID = 4_170_230_511
+
+// atlasRevisionsTable is where the Atlas CLI records the applied migrations.
+const atlasRevisionsTable = "atlas_schema_revisions.atlas_schema_revisions"
+
+// Revision is a migration applied to the database. The table is not part of the rdbms models, so that it
+// is left out of the schema that Atlas compares the migrations with.
+type Revision struct {
+	Version       string `gorm:"primaryKey;size:64"`
+	Description   string `gorm:"not null"`
+	Hash          string `gorm:"not null"`
+	AppliedAt     time.Time
+	ExecutionTime time.Duration
+}
+
+func (Revision) TableName() string {
+	return "schema_revisions"
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *gorm.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Applied returns the revisions recorded in the database in version order.
+func (m *Migrator) Applied(ctx context.Context) ([]Revision, error) {
+	db := m.db.WithContext(ctx)
+	if !db.Migrator().HasTable(&Revision{}) {
+		return nil, nil
+	}
+	var revisions []Revision
+	if err := db.Order("version").Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// Pending returns the migrations that are not applied yet.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	revisions, err := m.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[string]struct{}, len(revisions))
+	for _, r := range revisions {
+		applied[r.Version] = struct{}{}
+	}
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Migration states reported by Status.
+const (
+	StateApplied = "applied"
+	StatePending = "pending"
+	// StateUnknown is a revision of the database without a migration, e.g. applied by a newer release.
+	StateUnknown = "unknown"
+)
+
+type Status struct {
+	Version     string
+	Description string
+	State       string
+	AppliedAt   time.Time
+}
+
+// Status lists the migrations and the unknown revisions of the database in version order.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	revisions, err := m.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[string]Revision, len(revisions))
+	for _, r := range revisions {
+		applied[r.Version] = r
+	}
+	status := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		s := Status{Version: migration.Version, Description: migration.Description, State: StatePending}
+		if r, ok := applied[migration.Version]; ok {
+			s.State = StateApplied
+			s.AppliedAt = r.AppliedAt
+			delete(applied, migration.Version)
+		}
+		status = append(status, s)
+	}
+	for _, r := range applied {
+		status = append(status, Status{
+			Version:     r.Version,
+			Description: r.Description,
+			State:       StateUnknown,
+			AppliedAt:   r.AppliedAt,
+		})
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Version < status[j].Version
+	})
+	return status, nil
+}
+
+// Up applies the pending migrations in version order up to and including the target version, each one in
+// its own transaction, and returns them. An empty target applies all of them.
+// Applied migrations that were modified afterwards fail with ErrChecksumMismatch.
+func (m *Migrator) Up(ctx context.Context, target string) ([]Migration, error) {
+	if err := m.checkTarget(target); err != nil {
+		return nil, err
+	}
+	var applied []Migration
+	for _, migration := range m.migrations {
+		if target != "" && migration.Version > target {
+			break
+		}
+		ok, err := m.apply(ctx, migration)
+		if err != nil {
+			return applied, fmt.Errorf("migration %s: %w", migration.Name, err)
+		}
+		if ok {
+			applied = append(applied, migration)
+		}
+	}
+	return applied, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, migration Migration) (bool, error) {
+	applied := false
+	err := m.transaction(ctx, func(tx *gorm.DB) error {
+		var revision Revision
+		res := tx.Where("version = ?", migration.Version).Limit(1).Find(&revision)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected > 0 {
+			if revision.Hash != migration.Hash {
+				return fmt.Errorf("%w: modified after it was applied", ErrChecksumMismatch)
+			}
+			return nil
+		}
+		start := time.Now()
+		if err := tx.Exec(migration.SQL).Error; err != nil {
+			return err
+		}
+		applied = true
+		return tx.Create(&Revision{
+			Version:       migration.Version,
+			Description:   migration.Description,
+			Hash:          migration.Hash,
+			AppliedAt:     time.Now().UTC(),
+			ExecutionTime: time.Since(start),
+		}).Error
+	})
+	return applied, err
+}
+
+// Down reverts the applied migrations after the target version in reverse order, each one in its own
+// transaction, and returns them. An empty target reverts all of them.
+func (m *Migrator) Down(ctx context.Context, target string) ([]Migration, error) {
+	if err := m.checkTarget(target); err != nil {
+		return nil, err
+	}
+	revisions, err := m.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	migrations := make(map[string]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		migrations[migration.Version] = migration
+	}
+	var reverted []Migration
+	for i := len(revisions) - 1; i >= 0 && revisions[i].Version > target; i-- {
+		migration, ok := migrations[revisions[i].Version]
+		if !ok {
+			return reverted, fmt.Errorf("revision %s: %w", revisions[i].Version, ErrUnknownVersion)
+		}
+		if migration.DownSQL == "" {
+			return reverted, fmt.Errorf("migration %s: %w", migration.Name, ErrIrreversible)
+		}
+		if err := m.revert(ctx, migration); err != nil {
+			return reverted, fmt.Errorf("migration %s: %w", migration.Name, err)
+		}
+		reverted = append(reverted, migration)
+	}
+	return reverted, nil
+}
+
+func (m *Migrator) revert(ctx context.Context, migration Migration) error {
+	return m.transaction(ctx, func(tx *gorm.DB) error {
+		var revision Revision
+		res := tx.Where("version = ?", migration.Version).Limit(1).Find(&revision)
+		if res.Error != nil {
+			return res.Error
+		}
+		// Reverted concurrently
+		if res.RowsAffected == 0 {
+			return nil
+		}
+		if revision.Hash != migration.Hash {
+			return fmt.Errorf("%w: modified after it was applied", ErrChecksumMismatch)
+		}
+		if err := tx.Exec(migration.DownSQL).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&revision).Error
+	})
+}
+
+func (m *Migrator) checkTarget(target string) error {
+	if target == "" {
+		return nil
+	}
+	for _, migration := range m.migrations {
+		if migration.Version == target {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownVersion, target)
+}
+
+// transaction runs the callback holding the migration lock, once the revisions table exists. The statement
+// timeout of the connection does not apply, since data migrations of large tables can take longer.
+func (m *Migrator) transaction(ctx context.Context, callback func(tx *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec("SET LOCAL statement_timeout = 0").Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", advisoryLockID).Error; err != nil {
+				return err
+			}
+		}
+		if !tx.Migrator().HasTable(&Revision{}) {
+			if err := tx.Migrator().CreateTable(&Revision{}); err != nil {
+				return err
+			}
+			if err := importAtlasRevisions(tx); err != nil {
+				return err
+			}
+		}
+		return callback(tx)
+	})
+}
+
+// importAtlasRevisions records the migrations that were applied with the Atlas CLI, so that databases
+// migrated with `atlas migrate apply` are not migrated again.
+func importAtlasRevisions(tx *gorm.DB) error {
+	if !tx.Migrator().HasTable(atlasRevisionsTable) {
+		return nil
+	}
+	var revisions []Revision
+	if err := tx.Table(atlasRevisionsTable).
+		Select("version, description, hash, executed_at AS applied_at, execution_time").
+		Where("applied = total").
+		Find(&revisions).Error; err != nil {
+		return err
+	}
+	if len(revisions) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&revisions).Error
+}
@@ -0,0 +1,172 @@
+package migrations
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "periscope.db")), &gorm.Config{
+		Logger: logger.Discard,
+	})
+	require.NoError(t, err)
+	return db
+}
+
+func TestMigrator_Up(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	files := map[string]string{
+		"20260101000000.sql":          "CREATE TABLE a (id INTEGER PRIMARY KEY);",
+		"20260102000000_insert_a.sql": "INSERT INTO a VALUES (1); INSERT INTO a VALUES (2);",
+	}
+	migrations, err := Load(newTestFS(files))
+	require.NoError(t, err)
+
+	m := NewMigrator(db, migrations)
+	pending, err := m.Pending(ctx)
+	require.NoError(t, err)
+	assert.Len(t, pending, 2)
+
+	applied, err := m.Up(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+	var count int64
+	require.NoError(t, db.Table("a").Count(&count).Error)
+	assert.EqualValues(t, 2, count)
+
+	revisions, err := m.Applied(ctx)
+	require.NoError(t, err)
+	require.Len(t, revisions, 2)
+	assert.Equal(t, "20260102000000", revisions[1].Version)
+	assert.Equal(t, "insert_a", revisions[1].Description)
+	assert.Equal(t, migrations[1].Hash, revisions[1].Hash)
+
+	applied, err = m.Up(ctx, "")
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	// A failed migration is rolled back and not recorded
+	files["20260103000000.sql"] = "INSERT INTO a VALUES (3); INSERT INTO missing VALUES (1);"
+	migrations, err = Load(newTestFS(files))
+	require.NoError(t, err)
+	m = NewMigrator(db, migrations)
+	_, err = m.Up(ctx, "")
+	require.Error(t, err)
+	require.NoError(t, db.Table("a").Count(&count).Error)
+	assert.EqualValues(t, 2, count)
+	pending, err = m.Pending(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+
+	files["20260103000000.sql"] = "INSERT INTO a VALUES (3);"
+	migrations, err = Load(newTestFS(files))
+	require.NoError(t, err)
+	applied, err = NewMigrator(db, migrations).Up(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	assert.Equal(t, "20260103000000", applied[0].Version)
+
+	// Applied migrations cannot change
+	files["20260101000000.sql"] = "CREATE TABLE a (id INTEGER PRIMARY KEY, name TEXT);"
+	migrations, err = Load(newTestFS(files))
+	require.NoError(t, err)
+	_, err = NewMigrator(db, migrations).Up(ctx, "")
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+}
+
+func TestMigrator_Down(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	migrations, err := Load(newTestFS(map[string]string{
+		"20260101000000.sql":          "CREATE TABLE a (id INTEGER PRIMARY KEY);",
+		"down/20260101000000.sql":     "DROP TABLE a;",
+		"20260102000000_add_b.sql":    "CREATE TABLE b (id INTEGER PRIMARY KEY);",
+		"down/20260102000000.sql":     "DROP TABLE b;",
+		"20260103000000_insert_a.sql": "INSERT INTO a VALUES (1);",
+		"down/20260103000000.sql":     "DELETE FROM a WHERE id = 1;",
+	}))
+	require.NoError(t, err)
+	m := NewMigrator(db, migrations)
+
+	_, err = m.Up(ctx, "20260104000000")
+	require.ErrorIs(t, err, ErrUnknownVersion)
+	applied, err := m.Up(ctx, "20260102000000")
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{StateApplied, StateApplied, StatePending}, states(status))
+	assert.Equal(t, "add_b", status[1].Description)
+	assert.False(t, status[1].AppliedAt.IsZero())
+
+	_, err = m.Up(ctx, "")
+	require.NoError(t, err)
+	reverted, err := m.Down(ctx, "20260101000000")
+	require.NoError(t, err)
+	require.Len(t, reverted, 2)
+	assert.Equal(t, "20260103000000", reverted[0].Version)
+	assert.Equal(t, "20260102000000", reverted[1].Version)
+	assert.True(t, db.Migrator().HasTable("a"))
+	assert.False(t, db.Migrator().HasTable("b"))
+	var count int64
+	require.NoError(t, db.Table("a").Count(&count).Error)
+	assert.Zero(t, count)
+
+	reverted, err = m.Down(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, reverted, 1)
+	assert.False(t, db.Migrator().HasTable("a"))
+	status, err = m.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{StatePending, StatePending, StatePending}, states(status))
+}
+
+func TestMigrator_Down_Irreversible(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	files := map[string]string{
+		"20260101000000.sql":      "CREATE TABLE a (id INTEGER PRIMARY KEY);",
+		"down/20260101000000.sql": "DROP TABLE a;",
+		"20260102000000.sql":      "INSERT INTO a VALUES (1);",
+	}
+	migrations, err := Load(newTestFS(files))
+	require.NoError(t, err)
+	_, err = NewMigrator(db, migrations).Up(ctx, "")
+	require.NoError(t, err)
+
+	_, err = NewMigrator(db, migrations).Down(ctx, "")
+	require.ErrorIs(t, err, ErrIrreversible)
+
+	// A revision applied by a newer release is reported, but cannot be reverted
+	migrations, err = Load(newTestFS(map[string]string{
+		"20260101000000.sql":      files["20260101000000.sql"],
+		"down/20260101000000.sql": files["down/20260101000000.sql"],
+	}))
+	require.NoError(t, err)
+	m := NewMigrator(db, migrations)
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{StateApplied, StateUnknown}, states(status))
+	_, err = m.Down(ctx, "")
+	require.ErrorIs(t, err, ErrUnknownVersion)
+	pending, err := m.Pending(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func states(status []Status) []string {
+	s := make([]string, 0, len(status))
+	for _, st := range status {
+		s = append(s, st.State)
+	}
+	return s
+}
@@ -2,6 +2,7 @@ package notification
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/georgepsarakis/periscope/repository"
@@ -15,10 +16,14 @@ type Event struct {
 }
 
 type EventDetails struct {
-	AlertID      string `json:"alert_id"`
-	Title        string `json:"title"`
-	ProjectID    string `json:"project_id"`
-	EventGroupID string `json:"event_group_id"`
+	AlertID      string          `json:"alert_id"`
+	Title        string          `json:"title"`
+	ProjectID    string          `json:"project_id"`
+	EventGroupID string          `json:"event_group_id"`
+	Exceptions   json.RawMessage `json:"exceptions,omitempty"`
+	Release      string          `json:"release,omitempty"`
+	Environment  string          `json:"environment,omitempty"`
+	Tags         json.RawMessage `json:"tags,omitempty"`
 }
 
 type Channel interface {
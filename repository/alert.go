@@ -71,12 +71,19 @@ func (r *Repository) FindAlerts(ctx context.Context, projectID uint, options Lis
 	return ra, nil
 }
 
+// AlertUpdateNotifiedAt claims the alert for notification. Only the first caller updates the alert,
+// any later call returns ErrRecordNotFound, so that concurrent alerting processes notify once.
 func (r *Repository) AlertUpdateNotifiedAt(ctx context.Context, id uint, ts time.Time) (Alert, error) {
 	tx := r.dbExecutor(ctx)
-	res := tx.Model(&rdbms.Alert{}).Where("id = ?", id).Updates(map[string]any{"notified_at": ts})
+	res := tx.Model(&rdbms.Alert{}).
+		Where("id = ? AND notified_at IS NULL", id).
+		Updates(map[string]any{"notified_at": ts})
 	if res.Error != nil {
 		return Alert{}, res.Error
 	}
+	if res.RowsAffected == 0 {
+		return Alert{}, ErrRecordNotFound
+	}
 	return Alert{}, nil
 }
 
@@ -111,29 +118,40 @@ func (r *Repository) CreateAlertDestinationNotification(ctx context.Context, ale
 
 const maxAttempts = 10
 
+// notificationClaimTimeout is how long an attempted notification is left to the process that claimed
+// it, before it is retried by any process.
+const notificationClaimTimeout = time.Minute
+
+// FindAlertDestinationNotificationByNonCompleted claims the next pending notification. The claim is
+// conditional on the notification not having been attempted by another process in the meantime.
 func (r *Repository) FindAlertDestinationNotificationByNonCompleted(ctx context.Context) (AlertDestinationNotification, error) {
 	db := r.dbExecutor(ctx)
 	n := AlertDestinationNotification{}
 	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := r.now()
+		claimable := "completed_at IS NULL AND total_attempts < ? AND (attempted_at IS NULL OR attempted_at < ?)"
 		res := tx.
-			Where("completed_at IS NULL").
-			Where("total_attempts < ?", maxAttempts).
+			Where(claimable, maxAttempts, now.Add(-notificationClaimTimeout)).
 			Order("updated_at").Take(&n)
 		if res.Error != nil {
-			if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
-				return nil
+			if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+				return ErrRecordNotFound
 			}
+			return res.Error
 		}
-		if n.ID == 0 {
-			return ErrRecordNotFound
-		}
-		res = tx.Model(&n).Updates(map[string]any{
-			"total_attempts": gorm.Expr("total_attempts + ?", 1),
-			"attempted_at":   r.now(),
-		})
+		res = tx.Model(&rdbms.AlertDestinationNotification{}).
+			Where("id = ?", n.ID).
+			Where(claimable, maxAttempts, now.Add(-notificationClaimTimeout)).
+			Updates(map[string]any{
+				"total_attempts": gorm.Expr("total_attempts + ?", 1),
+				"attempted_at":   now,
+			})
 		if res.Error != nil {
 			return res.Error
 		}
+		if res.RowsAffected == 0 {
+			return ErrRecordNotFound
+		}
 		return nil
 	})
 	if err != nil {
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/georgepsarakis/periscope/repository/rdbms"
+)
+
+func TestRepository_AlertUpdateNotifiedAt_Claim(t *testing.T) {
+	r, db := newTestRepository(t)
+	ctx := context.Background()
+	alert := rdbms.Alert{ProjectID: 1, EventGroupID: 1, TriggeredAt: UTCNow(), Title: "disk full"}
+	require.NoError(t, db.Create(&alert).Error)
+
+	_, err := r.AlertUpdateNotifiedAt(ctx, alert.ID, UTCNow())
+	require.NoError(t, err)
+	_, err = r.AlertUpdateNotifiedAt(ctx, alert.ID, UTCNow())
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestRepository_FindAlertDestinationNotificationByNonCompleted_Claim(t *testing.T) {
+	r, db := newTestRepository(t)
+	require.NoError(t, db.AutoMigrate(&rdbms.AlertDestinationNotification{}))
+	ctx := context.Background()
+	now := UTCNow()
+	r.now = func() time.Time { return now }
+	require.NoError(t, db.Create(&rdbms.AlertDestinationNotification{AlertID: 1, ProjectAlertDestinationID: 1}).Error)
+
+	n, err := r.FindAlertDestinationNotificationByNonCompleted(ctx)
+	require.NoError(t, err)
+	assert.NotZero(t, n.ID)
+
+	// Claimed by the first call
+	_, err = r.FindAlertDestinationNotificationByNonCompleted(ctx)
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+
+	// Retried once the claim has expired
+	now = now.Add(notificationClaimTimeout + time.Second)
+	retried, err := r.FindAlertDestinationNotificationByNonCompleted(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, n.ID, retried.ID)
+
+	_, err = r.AlertDestinationNotificationUpdateCompletedAt(ctx, n.ID, now)
+	require.NoError(t, err)
+	now = now.Add(notificationClaimTimeout + time.Second)
+	_, err = r.FindAlertDestinationNotificationByNonCompleted(ctx)
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"encoding/json"
+
+	"go.uber.org/zap"
+)
+
+// settingsCacheTTLSeconds bounds the staleness of cached project settings in other processes, writes
+// delete the key of the process that handled them.
+const settingsCacheTTLSeconds = 60
+
+// cachedLookup returns the value cached under the key, otherwise the value returned by load, which is then
+// cached for the given number of seconds. Project settings that are read for every ingested event, such as
+// fingerprint rules, limits and inbound filters, are looked up through the cache so that ingestion does not
+// query the database for each event. Values that cannot be cached, e.g. because they exceed the maximum
+// entry size of the cache, are returned as loaded.
+func cachedLookup[T any](r *Repository, key string, ttlSeconds int, load func() (T, error)) (T, error) {
+	cacheKey := []byte(key)
+	if v, err := r.cache.Get(cacheKey); err == nil {
+		var value T
+		if err := json.Unmarshal(v, &value); err == nil {
+			return value, nil
+		}
+	}
+	value, err := load()
+	if err != nil {
+		return value, err
+	}
+	s, err := json.Marshal(value)
+	if err == nil {
+		err = r.cache.Set(cacheKey, s, ttlSeconds)
+	}
+	if err != nil {
+		r.logger.Warn("failed to cache value", zap.String("key", key), zap.Int("size", len(s)), zap.Error(err))
+	}
+	return value, nil
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/georgepsarakis/periscope/repository/rdbms"
+)
+
+func TestRepository_FingerprintRulesByProjectID_LargeEntry(t *testing.T) {
+	r, db := newTestRepository(t)
+	require.NoError(t, db.AutoMigrate(&rdbms.ProjectFingerprintRule{}))
+	ctx := context.Background()
+	for i := range 8 {
+		_, err := r.FingerprintRuleCreate(ctx, FingerprintRule{
+			ProjectID:     1,
+			Priority:      i,
+			ExceptionType: "ConnectionError",
+			Message:       fmt.Sprintf("connection to database replica %d refused", i),
+			Fingerprint:   []string{"database-connection", fmt.Sprintf("replica-%d", i)},
+		})
+		require.NoError(t, err)
+	}
+
+	// Values over the maximum entry size of the cache are returned without being cached
+	for range 2 {
+		rules, err := r.FingerprintRulesByProjectID(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, rules, 8)
+		b, err := json.Marshal(rules)
+		require.NoError(t, err)
+		assert.Greater(t, len(b), 1024)
+	}
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/georgepsarakis/periscope/repository/rdbms"
+)
+
+func newDeadLetterEvent(e rdbms.DeadLetterEvent) DeadLetterEvent {
+	return DeadLetterEvent{
+		ID:        e.ID,
+		CreatedAt: e.CreatedAt,
+		ProjectID: e.ProjectID,
+		EventID:   e.EventID,
+		Stage:     e.Stage,
+		Error:     e.Error,
+		Attempts:  e.Attempts,
+		Payload:   string(e.Payload),
+	}
+}
+
+func (r *Repository) DeadLetterEventsCreate(ctx context.Context, events []DeadLetterEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	dbEvents := make([]rdbms.DeadLetterEvent, 0, len(events))
+	for _, e := range events {
+		dbEvents = append(dbEvents, rdbms.DeadLetterEvent{
+			ProjectID: e.ProjectID,
+			EventID:   e.EventID,
+			Stage:     e.Stage,
+			Error:     e.Error,
+			Attempts:  e.Attempts,
+			Payload:   []byte(e.Payload),
+		})
+	}
+	return r.dbExecutor(ctx).Create(&dbEvents).Error
+}
+
+// DeadLetterEventsList returns the most recent dead letters of a project, without their payload.
+func (r *Repository) DeadLetterEventsList(ctx context.Context, projectID uint, limit int) ([]DeadLetterEvent, error) {
+	var dbEvents []rdbms.DeadLetterEvent
+	res := r.dbExecutor(ctx).Model(&rdbms.DeadLetterEvent{}).
+		Select("id", "created_at", "project_id", "event_id", "stage", "error", "attempts").
+		Where("project_id = ?", projectID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&dbEvents)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	events := make([]DeadLetterEvent, 0, len(dbEvents))
+	for _, e := range dbEvents {
+		events = append(events, newDeadLetterEvent(e))
+	}
+	return events, nil
+}
+
+func (r *Repository) DeadLetterEventFindByID(ctx context.Context, projectID, id uint) (DeadLetterEvent, error) {
+	var e rdbms.DeadLetterEvent
+	res := r.dbExecutor(ctx).Where("project_id = ?", projectID).First(&e, id)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return DeadLetterEvent{}, ErrRecordNotFound
+		}
+		return DeadLetterEvent{}, res.Error
+	}
+	return newDeadLetterEvent(e), nil
+}
+
+func (r *Repository) DeadLetterEventDelete(ctx context.Context, projectID, id uint) error {
+	res := r.dbExecutor(ctx).Where("project_id = ?", projectID).Delete(&rdbms.DeadLetterEvent{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeadLetterEventsPurge deletes all dead letters of a project and returns their number.
+func (r *Repository) DeadLetterEventsPurge(ctx context.Context, projectID uint) (int, error) {
+	res := r.dbExecutor(ctx).Where("project_id = ?", projectID).Delete(&rdbms.DeadLetterEvent{})
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return int(res.RowsAffected), nil
+}
@@ -2,119 +2,484 @@ package repository
 
 import (
 	"context"
-	"database/sql"
 	"errors"
+	"slices"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
+	"github.com/georgepsarakis/periscope/newcontext"
 	"github.com/georgepsarakis/periscope/repository/rdbms"
 )
 
-func (r *Repository) CreateEvents(ctx context.Context, project Project, events []Event) (EventGroup, []*Event, error) {
-	if len(events) == 0 {
-		return EventGroup{}, nil, nil
-	}
-	var dbGroup rdbms.EventGroup
-	groupKey := events[0].Fingerprint
-	tx := r.database.WithContext(ctx).Where(
-		&EventGroup{ProjectID: project.ID, AggregationKey: groupKey},
-	).First(&dbGroup)
-	if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
-		return EventGroup{}, nil, tx.Error
-	}
-	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
-		if err := r.database.Transaction(func(tx *gorm.DB) error {
-			dbGroup = rdbms.EventGroup{
-				EventReceivedAt:  r.now(),
-				ProjectID:        project.ID,
-				AggregationKey:   groupKey,
-				TotalCount:       1,
-				AlertTriggeredAt: sql.NullTime{Time: r.now(), Valid: true},
+// EventBatch holds the events of a single group, identified by the fingerprint of the events.
+type EventBatch struct {
+	Project Project
+	Events  []Event
+}
+
+// EventBatchResult is the group of an EventBatch along with the stored events. Created reports whether the
+// group was created by the batch, in which case an alert was triggered. The group is empty when every event
+// of the batch was already stored.
+type EventBatchResult struct {
+	Group   EventGroup
+	Events  []*Event
+	Created bool
+}
+
+// errConcurrentEventInsert rolls back a flush when some events were stored concurrently after the duplicate
+// check, retrying the batches skips them.
+var errConcurrentEventInsert = errors.New("events were stored concurrently")
+
+// eventGroupChunkSize bounds the groups of a single statement, keeping the statement parameters within
+// the database limits.
+const eventGroupChunkSize = 1000
+
+// CreateEvents stores the events of a group, see CreateEventBatches.
+func (r *Repository) CreateEvents(ctx context.Context, project Project, events []Event, sampling EventSampling) (EventGroup, []*Event, error) {
+	results, err := r.CreateEventBatches(ctx, []EventBatch{{Project: project, Events: events}}, sampling)
+	if err != nil {
+		return EventGroup{}, nil, err
+	}
+	return results[0].Group, results[0].Events, nil
+}
+
+// CreateEventBatches stores the events of several groups in a single transaction. All groups are upserted by
+// one statement on their unique aggregation key, creating each group and its alert on its first occurrence.
+// Events that were already stored for the project, identified by their event ID, are skipped and not counted.
+// Events that are not sampled are counted in the group but not stored, so they cannot be recognized as
+// duplicates if they are delivered again. Results are in the order of the batches.
+func (r *Repository) CreateEventBatches(ctx context.Context, batches []EventBatch, sampling EventSampling) ([]EventBatchResult, error) {
+	var results []EventBatchResult
+	err := r.dbExecutor(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		results, err = r.createEventBatches(newcontext.WithDBTransaction(ctx, tx), batches, sampling)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+type eventGroupKey struct {
+	projectID      uint
+	aggregationKey string
+}
+
+// pendingEventGroup collects the events of the batches of a group while they are stored.
+type pendingEventGroup struct {
+	key            eventGroupKey
+	batches        []int
+	events         []Event
+	lastReceivedAt time.Time
+	existing       *rdbms.EventGroup
+	window         sampleWindow
+	sampled        []Event
+	dropped        int
+	stored         []*rdbms.Event
+	result         upsertedEventGroup
+	created        bool
+}
+
+// upsertedEventGroup is a row returned by the event group upsert.
+type upsertedEventGroup struct {
+	ID             uint
+	ProjectID      uint
+	AggregationKey string
+	TotalCount     int
+	StoredCount    int
+}
+
+func (r *Repository) createEventBatches(ctx context.Context, batches []EventBatch, sampling EventSampling) ([]EventBatchResult, error) {
+	results := make([]EventBatchResult, len(batches))
+	groups, err := r.pendingEventGroups(ctx, batches)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return results, nil
+	}
+	if err := r.findEventGroups(ctx, groups); err != nil {
+		return nil, err
+	}
+	now := r.now()
+	for _, g := range groups {
+		if g.existing != nil {
+			g.window.count = g.existing.SampleWindowCount
+			if g.existing.SampleWindowStart != nil {
+				g.window.start = *g.existing.SampleWindowStart
 			}
-			if tx := tx.WithContext(ctx).Create(&dbGroup); tx.Error != nil {
-				return tx.Error
+		}
+		total := 0
+		if g.existing != nil {
+			total = g.existing.TotalCount
+		}
+		g.sampled = make([]Event, 0, len(g.events))
+		for i, event := range g.events {
+			if sampling.keep(total+i, &g.window, now) {
+				g.sampled = append(g.sampled, event)
 			}
-			alert := rdbms.Alert{
-				EventGroupID: dbGroup.ID,
-				ProjectID:    project.ID,
-				TriggeredAt:  r.now(),
-				Title:        events[0].Title,
-				Description:  events[0].Fingerprint + "\n" + string(events[0].StackTrace),
+		}
+		g.dropped = len(g.events) - len(g.sampled)
+	}
+	if err := r.upsertEventGroups(ctx, groups, sampling, now); err != nil {
+		return nil, err
+	}
+	if err := r.insertGroupEvents(ctx, groups); err != nil {
+		return nil, err
+	}
+	if err := r.createGroupAlerts(ctx, groups, now); err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		group := EventGroup{
+			BaseModel:       BaseModel{ID: g.result.ID, CreatedAt: now, UpdatedAt: now},
+			TotalCount:      g.result.TotalCount,
+			StoredCount:     g.result.StoredCount,
+			EventReceivedAt: g.lastReceivedAt,
+			ProjectID:       g.key.projectID,
+			AggregationKey:  g.key.aggregationKey,
+			GroupingVersion: g.events[0].GroupingVersion,
+		}
+		if g.existing != nil {
+			group.CreatedAt = g.existing.CreatedAt
+			group.GroupingVersion = g.existing.GroupingVersion
+			if g.existing.EventReceivedAt.After(group.EventReceivedAt) {
+				group.EventReceivedAt = g.existing.EventReceivedAt
+			}
+		}
+		events := make([]*Event, 0, len(g.stored))
+		for _, event := range g.stored {
+			events = append(events, &Event{
+				EventID:       event.EventID,
+				Title:         event.Title,
+				StackTrace:    event.StackTrace,
+				Exceptions:    event.Exceptions,
+				Fingerprint:   event.Fingerprint,
+				EventGroupID:  event.EventGroupID,
+				ProjectID:     event.ProjectID,
+				EmittedAt:     event.EmittedAt,
+				ReceivedAt:    event.ReceivedAt,
+				ClientName:    event.ClientName,
+				ClientVersion: event.ClientVersion,
+				Tags:          event.Tags,
+				Extra:         event.Extra,
+				Breadcrumbs:   event.Breadcrumbs,
+				User:          event.User,
+				Request:       event.Request,
+				Contexts:      event.Contexts,
+				ServerName:    event.ServerName,
+				Release:       event.Release,
+				Dist:          event.Dist,
+				Environment:   event.Environment,
+				Transaction:   event.Transaction,
+			})
+		}
+		for _, i := range g.batches {
+			results[i] = EventBatchResult{Group: group, Events: events, Created: g.created}
+		}
+	}
+	return results, nil
+}
+
+// pendingEventGroups merges the batches by group and removes the events that are repeated or already stored.
+func (r *Repository) pendingEventGroups(ctx context.Context, batches []EventBatch) ([]*pendingEventGroup, error) {
+	seen := make(map[uint]map[string]struct{})
+	for _, batch := range batches {
+		if _, ok := seen[batch.Project.ID]; ok || len(batch.Events) == 0 {
+			continue
+		}
+		var ids []string
+		for _, b := range batches {
+			if b.Project.ID != batch.Project.ID {
+				continue
 			}
-			if tx := tx.WithContext(ctx).Create(&alert); tx.Error != nil {
-				return tx.Error
+			for _, event := range b.Events {
+				ids = append(ids, event.EventID)
 			}
-			return nil
-		}); err != nil {
-			return EventGroup{}, nil, err
 		}
-	} else {
-		u := map[string]any{
-			"total_count":       gorm.Expr("total_count + ?", len(events)),
-			"event_received_at": r.now(),
+		existing, err := r.existingEventIDs(ctx, batch.Project.ID, ids)
+		if err != nil {
+			return nil, err
 		}
-		if tx := r.database.WithContext(ctx).Model(&dbGroup).Updates(u); tx.Error != nil {
-			return EventGroup{}, nil, tx.Error
+		seen[batch.Project.ID] = existing
+	}
+	now := r.now()
+	var groups []*pendingEventGroup
+	byKey := make(map[eventGroupKey]*pendingEventGroup)
+	for i, batch := range batches {
+		for _, event := range batch.Events {
+			if _, ok := seen[batch.Project.ID][event.EventID]; ok {
+				continue
+			}
+			seen[batch.Project.ID][event.EventID] = struct{}{}
+			if event.ReceivedAt.IsZero() {
+				event.ReceivedAt = now
+			}
+			if event.EmittedAt.IsZero() {
+				event.EmittedAt = event.ReceivedAt
+			}
+			key := eventGroupKey{projectID: batch.Project.ID, aggregationKey: event.Fingerprint}
+			g, ok := byKey[key]
+			if !ok {
+				g = &pendingEventGroup{key: key}
+				byKey[key] = g
+				groups = append(groups, g)
+			}
+			if len(g.batches) == 0 || g.batches[len(g.batches)-1] != i {
+				g.batches = append(g.batches, i)
+			}
+			g.events = append(g.events, event)
+			if event.ReceivedAt.After(g.lastReceivedAt) {
+				g.lastReceivedAt = event.ReceivedAt
+			}
 		}
 	}
-	group := EventGroup{
-		BaseModel: BaseModel{
-			ID:        dbGroup.ID,
-			CreatedAt: dbGroup.CreatedAt,
-			UpdatedAt: dbGroup.UpdatedAt,
-		},
-		TotalCount:      dbGroup.TotalCount,
-		EventReceivedAt: dbGroup.EventReceivedAt,
-		ProjectID:       dbGroup.ProjectID,
-		AggregationKey:  dbGroup.AggregationKey,
-	}
-	var newEvents []*rdbms.Event
-	for _, event := range events {
-		newEvents = append(newEvents, &rdbms.Event{
-			EventID:      event.EventID,
-			EventGroupID: dbGroup.ID,
-			Fingerprint:  event.Fingerprint,
-			ProjectID:    project.ID,
-			Title:        event.Title,
-			EmittedAt:    r.now(), // TODO: replace with client event timestamp
-		})
+	return groups, nil
+}
+
+// findEventGroups loads the groups that already exist, their counters decide which events are sampled.
+func (r *Repository) findEventGroups(ctx context.Context, groups []*pendingEventGroup) error {
+	byKey := make(map[eventGroupKey]*pendingEventGroup, len(groups))
+	for _, g := range groups {
+		byKey[g.key] = g
+	}
+	for chunk := range slices.Chunk(groups, eventGroupChunkSize) {
+		keys := make([][]any, 0, len(chunk))
+		for _, g := range chunk {
+			keys = append(keys, []any{g.key.projectID, g.key.aggregationKey})
+		}
+		var existing []rdbms.EventGroup
+		res := r.dbExecutor(ctx).Where("(project_id, aggregation_key) IN ?", keys).Find(&existing)
+		if res.Error != nil {
+			return res.Error
+		}
+		for i := range existing {
+			byKey[eventGroupKey{projectID: existing[i].ProjectID, aggregationKey: existing[i].AggregationKey}].existing = &existing[i]
+		}
+	}
+	return nil
+}
+
+// upsertEventGroups creates the missing groups and increments the counters of all groups in one statement.
+// A group is created by this flush when it was not found before and its total count is the one of the
+// flush, otherwise a concurrent flush created it and triggered its alert.
+func (r *Repository) upsertEventGroups(ctx context.Context, groups []*pendingEventGroup, sampling EventSampling, now time.Time) error {
+	byKey := make(map[eventGroupKey]*pendingEventGroup, len(groups))
+	for _, g := range groups {
+		byKey[g.key] = g
+	}
+	for chunk := range slices.Chunk(groups, eventGroupChunkSize) {
+		values := make([]string, 0, len(chunk))
+		args := make([]any, 0, 11*len(chunk))
+		for _, g := range chunk {
+			var windowStart *time.Time
+			if sampling.MaxPerHour > 0 && !g.window.start.IsZero() {
+				windowStart = &g.window.start
+			}
+			values = append(values, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+			args = append(args, now, now, g.key.projectID, g.key.aggregationKey, g.events[0].GroupingVersion,
+				len(g.events), len(g.sampled), g.lastReceivedAt, now, windowStart, g.window.count)
+		}
+		var rows []upsertedEventGroup
+		res := r.dbExecutor(ctx).Raw(`INSERT INTO event_groups (created_at, updated_at, project_id, aggregation_key,
+			grouping_version, total_count, stored_count, event_received_at, alert_triggered_at,
+			sample_window_start, sample_window_count)
+			VALUES `+strings.Join(values, ", ")+`
+			ON CONFLICT (project_id, aggregation_key) DO UPDATE SET
+				updated_at = excluded.updated_at,
+				total_count = event_groups.total_count + excluded.total_count,
+				stored_count = event_groups.stored_count + excluded.stored_count,
+				resolved_at = NULL,
+				event_received_at = CASE WHEN event_groups.event_received_at < excluded.event_received_at
+					THEN excluded.event_received_at ELSE event_groups.event_received_at END,
+				sample_window_start = COALESCE(excluded.sample_window_start, event_groups.sample_window_start),
+				sample_window_count = CASE WHEN excluded.sample_window_start IS NULL
+					THEN event_groups.sample_window_count ELSE excluded.sample_window_count END
+			RETURNING id, project_id, aggregation_key, total_count, stored_count`, args...).Scan(&rows)
+		if res.Error != nil {
+			return res.Error
+		}
+		for _, row := range rows {
+			g := byKey[eventGroupKey{projectID: row.ProjectID, aggregationKey: row.AggregationKey}]
+			g.result = row
+			g.created = g.existing == nil && row.TotalCount == len(g.events)
+		}
+	}
+	return nil
+}
+
+// insertGroupEvents stores the sampled events of all groups.
+func (r *Repository) insertGroupEvents(ctx context.Context, groups []*pendingEventGroup) error {
+	var events []Event
+	for _, g := range groups {
+		events = append(events, g.sampled...)
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	payloadHashes, err := r.storeEventPayloads(ctx, events)
+	if err != nil {
+		return err
+	}
+	newEvents := make([]*rdbms.Event, 0, len(events))
+	i := 0
+	for _, g := range groups {
+		for _, event := range g.sampled {
+			e := &rdbms.Event{
+				EventID:       event.EventID,
+				EventGroupID:  g.result.ID,
+				Fingerprint:   event.Fingerprint,
+				ProjectID:     g.key.projectID,
+				Title:         event.Title,
+				StackTrace:    event.StackTrace,
+				Exceptions:    event.Exceptions,
+				EmittedAt:     event.EmittedAt,
+				ReceivedAt:    event.ReceivedAt,
+				ClientName:    event.ClientName,
+				ClientVersion: event.ClientVersion,
+				Tags:          event.Tags,
+				Extra:         event.Extra,
+				Breadcrumbs:   event.Breadcrumbs,
+				User:          event.User,
+				Request:       event.Request,
+				Contexts:      event.Contexts,
+				ServerName:    event.ServerName,
+				Release:       event.Release,
+				Dist:          event.Dist,
+				Environment:   event.Environment,
+				Transaction:   event.Transaction,
+				PayloadHash:   payloadHashes[i],
+			}
+			i++
+			newEvents = append(newEvents, e)
+			g.stored = append(g.stored, e)
+		}
+	}
+	// Concurrent flushes may insert the same event ID, in which case the unique index rejects the duplicate
+	// and the flush is retried, since the group counters already include the event.
+	res := r.dbExecutor(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "project_id"}, {Name: "event_id"}},
+		DoNothing: true,
+	}).CreateInBatches(&newEvents, eventGroupChunkSize)
+	if res.Error != nil {
+		return res.Error
+	}
+	if int(res.RowsAffected) != len(newEvents) {
+		return errConcurrentEventInsert
 	}
-	if tx := r.database.WithContext(ctx).Create(&newEvents); tx.Error != nil {
-		return EventGroup{}, nil, tx.Error
-	}
-	re := make([]*Event, 0, len(newEvents))
-	for _, event := range newEvents {
-		re = append(re, &Event{
-			EventID:      event.EventID,
-			Title:        event.Title,
-			Fingerprint:  event.Fingerprint,
-			EventGroupID: event.EventGroupID,
-			ProjectID:    event.ProjectID,
-			EmittedAt:    event.EmittedAt,
+	return nil
+}
+
+// createGroupAlerts triggers an alert for each group created by the flush.
+func (r *Repository) createGroupAlerts(ctx context.Context, groups []*pendingEventGroup, now time.Time) error {
+	var alerts []rdbms.Alert
+	for _, g := range groups {
+		if !g.created {
+			continue
+		}
+		alerts = append(alerts, rdbms.Alert{
+			EventGroupID: g.result.ID,
+			ProjectID:    g.key.projectID,
+			TriggeredAt:  now,
+			Title:        g.events[0].Title,
+			Description:  g.events[0].Fingerprint + "\n" + string(g.events[0].StackTrace),
 		})
 	}
-	return group, re, nil
+	if len(alerts) == 0 {
+		return nil
+	}
+	return r.dbExecutor(ctx).CreateInBatches(&alerts, eventGroupChunkSize).Error
 }
 
 func (r *Repository) EventFindLatestByProjectAndEventGroup(ctx context.Context, projectID, eventGroupID uint) (Event, error) {
 	tx := r.dbExecutor(ctx)
 	ev := rdbms.Event{}
 	res := tx.Model(&ev).Where("project_id = ? AND event_group_id = ?", projectID, eventGroupID).
+		Order("emitted_at DESC, id DESC").First(&ev)
+	if res.Error != nil {
+		return Event{}, res.Error
+	}
+	return newEvent(ev), nil
+}
+
+// existingEventIDs returns the IDs of the given events that are already stored for the project.
+func (r *Repository) existingEventIDs(ctx context.Context, projectID uint, ids []string) (map[string]struct{}, error) {
+	existing := make(map[string]struct{}, len(ids))
+	for chunk := range slices.Chunk(ids, eventGroupChunkSize) {
+		var found []string
+		res := r.dbExecutor(ctx).Model(&rdbms.Event{}).
+			Where("project_id = ? AND event_id IN ?", projectID, chunk).
+			Pluck("event_id", &found)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		for _, id := range found {
+			existing[id] = struct{}{}
+		}
+	}
+	return existing, nil
+}
+
+// EventFindByProjectAndEventID returns the event along with its raw payload.
+func (r *Repository) EventFindByProjectAndEventID(ctx context.Context, projectID uint, eventID string) (Event, error) {
+	tx := r.dbExecutor(ctx)
+	ev := rdbms.Event{}
+	res := tx.Model(&ev).Where("project_id = ? AND event_id = ?", projectID, eventID).
 		Order("created_at DESC").First(&ev)
 	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return Event{}, ErrRecordNotFound
+		}
 		return Event{}, res.Error
 	}
+	event := newEvent(ev)
+	if ev.PayloadHash != "" {
+		payload, err := r.eventPayloadFindByHash(ctx, ev.PayloadHash)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return Event{}, err
+		}
+		if len(payload) > 0 {
+			if payload, err = withEventID(payload, ev.EventID); err != nil {
+				return Event{}, err
+			}
+		}
+		event.Payload = payload
+	}
+	return event, nil
+}
+
+func newEvent(ev rdbms.Event) Event {
 	return Event{
 		BaseModel: BaseModel{
 			ID:        ev.ID,
 			CreatedAt: ev.CreatedAt,
 			UpdatedAt: ev.UpdatedAt,
 		},
-		EventID:      ev.EventID,
-		ProjectID:    ev.ProjectID,
-		EventGroupID: ev.EventGroupID,
-		EmittedAt:    ev.EmittedAt,
-		Fingerprint:  ev.Fingerprint,
-		StackTrace:   ev.StackTrace,
-	}, nil
+		EventID:       ev.EventID,
+		Title:         ev.Title,
+		ProjectID:     ev.ProjectID,
+		EventGroupID:  ev.EventGroupID,
+		EmittedAt:     ev.EmittedAt,
+		ReceivedAt:    ev.ReceivedAt,
+		Fingerprint:   ev.Fingerprint,
+		StackTrace:    ev.StackTrace,
+		Exceptions:    ev.Exceptions,
+		ClientName:    ev.ClientName,
+		ClientVersion: ev.ClientVersion,
+		Tags:          ev.Tags,
+		Extra:         ev.Extra,
+		Breadcrumbs:   ev.Breadcrumbs,
+		User:          ev.User,
+		Request:       ev.Request,
+		Contexts:      ev.Contexts,
+		ServerName:    ev.ServerName,
+		Release:       ev.Release,
+		Dist:          ev.Dist,
+		Environment:   ev.Environment,
+		Transaction:   ev.Transaction,
+	}
 }
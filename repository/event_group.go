@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/georgepsarakis/periscope/repository/rdbms"
+)
+
+func newEventGroup(g rdbms.EventGroup) EventGroup {
+	return EventGroup{
+		BaseModel: BaseModel{
+			ID:        g.ID,
+			CreatedAt: g.CreatedAt,
+			UpdatedAt: g.UpdatedAt,
+		},
+		TotalCount:      g.TotalCount,
+		StoredCount:     g.StoredCount,
+		EventReceivedAt: g.EventReceivedAt,
+		ProjectID:       g.ProjectID,
+		AggregationKey:  g.AggregationKey,
+		GroupingVersion: g.GroupingVersion,
+		ResolvedAt:      g.ResolvedAt,
+	}
+}
+
+func (r *Repository) EventGroupFindByID(ctx context.Context, projectID, id uint) (EventGroup, error) {
+	var g rdbms.EventGroup
+	res := r.dbExecutor(ctx).Where("project_id = ?", projectID).First(&g, id)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return EventGroup{}, ErrRecordNotFound
+		}
+		return EventGroup{}, res.Error
+	}
+	return newEventGroup(g), nil
+}
+
+// EventGroupUpdateResolved resolves the group or reopens it. A resolved group is reopened as well when
+// new events of the group are stored.
+func (r *Repository) EventGroupUpdateResolved(ctx context.Context, projectID, id uint, resolved bool) (EventGroup, error) {
+	var resolvedAt any
+	if resolved {
+		resolvedAt = r.now()
+	}
+	res := r.dbExecutor(ctx).Model(&rdbms.EventGroup{}).
+		Where("id = ? AND project_id = ?", id, projectID).
+		Updates(map[string]any{"resolved_at": resolvedAt, "updated_at": r.now()})
+	if res.Error != nil {
+		return EventGroup{}, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return EventGroup{}, ErrRecordNotFound
+	}
+	return r.EventGroupFindByID(ctx, projectID, id)
+}
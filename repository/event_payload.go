@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gorm.io/gorm/clause"
+
+	"github.com/georgepsarakis/periscope/repository/rdbms"
+)
+
+const payloadEncodingGzip = "gzip"
+
+// payloadHash is the content address of a raw event payload. The event ID is left out, so that events
+// with the same content share the stored payload.
+func payloadHash(payload []byte) string {
+	content := payload
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err == nil {
+		delete(fields, "event_id")
+		if b, err := json.Marshal(fields); err == nil {
+			content = b
+		}
+	}
+	h := sha256.Sum256(content)
+	return hex.EncodeToString(h[:])
+}
+
+// withEventID sets the event ID of a stored payload, which carries the ID of the first event stored with
+// the same content, or no ID when the SDK sent it in the envelope header only.
+func withEventID(payload json.RawMessage, eventID string) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+	var storedID string
+	if err := json.Unmarshal(fields["event_id"], &storedID); err == nil && storedID == eventID {
+		return payload, nil
+	}
+	id, err := json.Marshal(eventID)
+	if err != nil {
+		return nil, err
+	}
+	fields["event_id"] = id
+	return json.Marshal(fields)
+}
+
+func compressPayload(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompressPayload(p rdbms.EventPayload) (json.RawMessage, error) {
+	if p.Encoding != payloadEncodingGzip {
+		return nil, fmt.Errorf("unsupported event payload encoding %q", p.Encoding)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(p.Data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close() //nolint:errcheck
+	return io.ReadAll(zr)
+}
+
+// storeEventPayloads compresses the raw payloads of the events and stores each distinct payload once.
+// It returns the payload hash of every event, or an empty string for events without a payload.
+func (r *Repository) storeEventPayloads(ctx context.Context, events []Event) ([]string, error) {
+	hashes := make([]string, len(events))
+	seen := make(map[string]struct{}, len(events))
+	var payloads []rdbms.EventPayload
+	for i, event := range events {
+		if len(event.Payload) == 0 {
+			continue
+		}
+		hashes[i] = payloadHash(event.Payload)
+		if _, ok := seen[hashes[i]]; ok {
+			continue
+		}
+		seen[hashes[i]] = struct{}{}
+		data, err := compressPayload(event.Payload)
+		if err != nil {
+			return nil, err
+		}
+		payloads = append(payloads, rdbms.EventPayload{
+			Hash:     hashes[i],
+			Encoding: payloadEncodingGzip,
+			Size:     len(event.Payload),
+			Data:     data,
+		})
+	}
+	if len(payloads) == 0 {
+		return hashes, nil
+	}
+	tx := r.dbExecutor(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "hash"}},
+		DoNothing: true,
+	}).Create(&payloads)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return hashes, nil
+}
+
+func (r *Repository) eventPayloadFindByHash(ctx context.Context, hash string) (json.RawMessage, error) {
+	p := rdbms.EventPayload{}
+	if tx := r.dbExecutor(ctx).Where("hash = ?", hash).First(&p); tx.Error != nil {
+		return nil, tx.Error
+	}
+	return decompressPayload(p)
+}
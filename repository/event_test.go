@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/georgepsarakis/periscope/repository/rdbms"
+)
+
+func newTestRepository(t *testing.T) (*Repository, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "periscope.db")), &gorm.Config{
+		Logger: logger.Discard,
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&rdbms.EventGroup{}, &rdbms.Event{}, &rdbms.Alert{}, &rdbms.EventPayload{}))
+	return New(db, zap.NewNop()), db
+}
+
+func TestRepository_CreateEventBatches(t *testing.T) {
+	r, db := newTestRepository(t)
+	ctx := context.Background()
+	project := Project{BaseModel: BaseModel{ID: 1}}
+	other := Project{BaseModel: BaseModel{ID: 2}}
+
+	results, err := r.CreateEventBatches(ctx, []EventBatch{
+		{Project: project, Events: []Event{
+			{EventID: "a1", Fingerprint: "a", Title: "disk full"},
+			{EventID: "a2", Fingerprint: "a", Title: "disk full"},
+		}},
+		{Project: project, Events: []Event{{EventID: "b1", Fingerprint: "b"}}},
+		// The same fingerprint in another project is a different group
+		{Project: other, Events: []Event{{EventID: "a1", Fingerprint: "a"}}},
+	}, EventSampling{})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	for _, res := range results {
+		assert.True(t, res.Created)
+		assert.NotZero(t, res.Group.ID)
+	}
+	assert.Equal(t, 2, results[0].Group.TotalCount)
+	assert.Len(t, results[0].Events, 2)
+	assert.NotEqual(t, results[0].Group.ID, results[2].Group.ID)
+
+	// Stored events are skipped and existing groups do not trigger alerts again
+	results, err = r.CreateEventBatches(ctx, []EventBatch{
+		{Project: project, Events: []Event{
+			{EventID: "a2", Fingerprint: "a"},
+			{EventID: "a3", Fingerprint: "a"},
+		}},
+		{Project: project, Events: []Event{{EventID: "b1", Fingerprint: "b"}}},
+	}, EventSampling{})
+	require.NoError(t, err)
+	assert.False(t, results[0].Created)
+	assert.Equal(t, 3, results[0].Group.TotalCount)
+	assert.Equal(t, 3, results[0].Group.StoredCount)
+	assert.Len(t, results[0].Events, 1)
+	assert.Zero(t, results[1].Group.ID)
+
+	var groups, alerts, events int64
+	require.NoError(t, db.Model(&rdbms.EventGroup{}).Count(&groups).Error)
+	require.NoError(t, db.Model(&rdbms.Alert{}).Count(&alerts).Error)
+	require.NoError(t, db.Model(&rdbms.Event{}).Count(&events).Error)
+	assert.Equal(t, int64(3), groups)
+	assert.Equal(t, int64(3), alerts)
+	assert.Equal(t, int64(5), events)
+}
+
+func TestRepository_CreateEventBatches_Sampling(t *testing.T) {
+	r, _ := newTestRepository(t)
+	ctx := context.Background()
+	project := Project{BaseModel: BaseModel{ID: 1}}
+	sampling := EventSampling{KeepFirst: 1, Rate: 2}
+
+	group, events, err := r.CreateEvents(ctx, project, []Event{
+		{EventID: "1", Fingerprint: "a"},
+		{EventID: "2", Fingerprint: "a"},
+		{EventID: "3", Fingerprint: "a"},
+	}, sampling)
+	require.NoError(t, err)
+	assert.Equal(t, 3, group.TotalCount)
+	assert.Equal(t, 2, group.StoredCount)
+	require.Len(t, events, 2)
+	assert.Equal(t, "1", events[0].EventID)
+	assert.Equal(t, "2", events[1].EventID)
+
+	group, _, err = r.CreateEvents(ctx, project, []Event{{EventID: "4", Fingerprint: "a"}}, sampling)
+	require.NoError(t, err)
+	// After the first event, one in two events is stored
+	assert.Equal(t, 4, group.TotalCount)
+	assert.Equal(t, 3, group.StoredCount)
+}
+
+func TestRepository_EventPayloads(t *testing.T) {
+	r, db := newTestRepository(t)
+	ctx := context.Background()
+	project := Project{BaseModel: BaseModel{ID: 1}}
+
+	_, _, err := r.CreateEvents(ctx, project, []Event{
+		{EventID: "a1", Fingerprint: "a", Payload: []byte(`{"event_id": "a1", "message": "disk full", "sdk_field": 1}`)},
+		{EventID: "a2", Fingerprint: "a", Payload: []byte(`{"event_id":"a2","message":"disk full","sdk_field":1}`)},
+		// Event ID sent in the envelope header only
+		{EventID: "a3", Fingerprint: "a", Payload: []byte(`{"message": "disk full", "sdk_field": 1}`)},
+		{EventID: "b1", Fingerprint: "b", Payload: []byte(`{"event_id": "b1", "message": "disk corrupted"}`)},
+	}, EventSampling{})
+	require.NoError(t, err)
+
+	// Events with the same content share the payload
+	var payloads int64
+	require.NoError(t, db.Model(&rdbms.EventPayload{}).Count(&payloads).Error)
+	assert.Equal(t, int64(2), payloads)
+
+	for _, eventID := range []string{"a1", "a2", "a3"} {
+		ev, err := r.EventFindByProjectAndEventID(ctx, project.ID, eventID)
+		require.NoError(t, err)
+		assert.JSONEq(t, fmt.Sprintf(`{"event_id": %q, "message": "disk full", "sdk_field": 1}`, eventID), string(ev.Payload))
+	}
+	ev, err := r.EventFindByProjectAndEventID(ctx, project.ID, "a1")
+	require.NoError(t, err)
+	// The payload of the first event is returned as received
+	assert.Equal(t, `{"event_id": "a1", "message": "disk full", "sdk_field": 1}`, string(ev.Payload))
+}
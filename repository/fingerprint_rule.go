@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/georgepsarakis/periscope/repository/rdbms"
+)
+
+func cacheKeyFingerprintRules(projectID uint) string {
+	return fmt.Sprintf("fingerprint_rules:%d", projectID)
+}
+
+func newFingerprintRule(rule rdbms.ProjectFingerprintRule) FingerprintRule {
+	return FingerprintRule{
+		BaseModel: BaseModel{
+			ID:        rule.ID,
+			CreatedAt: rule.CreatedAt,
+			UpdatedAt: rule.UpdatedAt,
+		},
+		ProjectID:     rule.ProjectID,
+		Priority:      rule.Priority,
+		ExceptionType: rule.ExceptionType,
+		Message:       rule.Message,
+		Module:        rule.Module,
+		Function:      rule.Function,
+		Level:         rule.Level,
+		Tags:          rule.Tags,
+		Fingerprint:   rule.Fingerprint,
+	}
+}
+
+func (r *Repository) FingerprintRuleCreate(ctx context.Context, rule FingerprintRule) (FingerprintRule, error) {
+	tx := r.dbExecutor(ctx)
+	dbRule := rdbms.ProjectFingerprintRule{
+		ProjectID:     rule.ProjectID,
+		Priority:      rule.Priority,
+		ExceptionType: rule.ExceptionType,
+		Message:       rule.Message,
+		Module:        rule.Module,
+		Function:      rule.Function,
+		Level:         rule.Level,
+		Tags:          rule.Tags,
+		Fingerprint:   rule.Fingerprint,
+	}
+	if res := tx.Create(&dbRule); res.Error != nil {
+		return FingerprintRule{}, res.Error
+	}
+	r.cache.Del([]byte(cacheKeyFingerprintRules(rule.ProjectID)))
+	return newFingerprintRule(dbRule), nil
+}
+
+// FingerprintRulesByProjectID returns the fingerprint rules of a project in evaluation order.
+func (r *Repository) FingerprintRulesByProjectID(ctx context.Context, projectID uint) ([]FingerprintRule, error) {
+	return cachedLookup(r, cacheKeyFingerprintRules(projectID), settingsCacheTTLSeconds, func() ([]FingerprintRule, error) {
+		var dbRules []rdbms.ProjectFingerprintRule
+		res := r.dbExecutor(ctx).Model(&rdbms.ProjectFingerprintRule{}).
+			Where("project_id = ?", projectID).
+			Order("priority, id").
+			Find(&dbRules)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		rules := make([]FingerprintRule, 0, len(dbRules))
+		for _, rule := range dbRules {
+			rules = append(rules, newFingerprintRule(rule))
+		}
+		return rules, nil
+	})
+}
+
+func (r *Repository) FingerprintRuleDelete(ctx context.Context, projectID, id uint) error {
+	tx := r.dbExecutor(ctx)
+	res := tx.Where("project_id = ?", projectID).Delete(&rdbms.ProjectFingerprintRule{}, id)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return ErrRecordNotFound
+		}
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	r.cache.Del([]byte(cacheKeyFingerprintRules(projectID)))
+	return nil
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/georgepsarakis/periscope/repository/rdbms"
+)
+
+func cacheKeyInboundFilters(projectID uint) string {
+	return fmt.Sprintf("inbound_filters:%d", projectID)
+}
+
+func newInboundFilter(f rdbms.ProjectInboundFilter) InboundFilter {
+	return InboundFilter{
+		BaseModel: BaseModel{
+			ID:        f.ID,
+			CreatedAt: f.CreatedAt,
+			UpdatedAt: f.UpdatedAt,
+		},
+		ProjectID:      f.ProjectID,
+		Type:           f.Type,
+		Pattern:        f.Pattern,
+		FilteredCount:  f.FilteredCount,
+		LastFilteredAt: f.LastFilteredAt,
+	}
+}
+
+func (r *Repository) InboundFilterCreate(ctx context.Context, filter InboundFilter) (InboundFilter, error) {
+	dbFilter := rdbms.ProjectInboundFilter{
+		ProjectID: filter.ProjectID,
+		Type:      filter.Type,
+		Pattern:   filter.Pattern,
+	}
+	if res := r.dbExecutor(ctx).Create(&dbFilter); res.Error != nil {
+		return InboundFilter{}, res.Error
+	}
+	r.cache.Del([]byte(cacheKeyInboundFilters(filter.ProjectID)))
+	return newInboundFilter(dbFilter), nil
+}
+
+// InboundFiltersByProjectID returns the cached inbound filters of a project in creation order. The counters
+// of cached filters are not current, use InboundFiltersList to read them.
+func (r *Repository) InboundFiltersByProjectID(ctx context.Context, projectID uint) ([]InboundFilter, error) {
+	return cachedLookup(r, cacheKeyInboundFilters(projectID), settingsCacheTTLSeconds, func() ([]InboundFilter, error) {
+		return r.InboundFiltersList(ctx, projectID)
+	})
+}
+
+// InboundFiltersList returns the inbound filters of a project in creation order, along with their counters.
+func (r *Repository) InboundFiltersList(ctx context.Context, projectID uint) ([]InboundFilter, error) {
+	var dbFilters []rdbms.ProjectInboundFilter
+	res := r.dbExecutor(ctx).Model(&rdbms.ProjectInboundFilter{}).
+		Where("project_id = ?", projectID).
+		Order("id").
+		Find(&dbFilters)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	filters := make([]InboundFilter, 0, len(dbFilters))
+	for _, f := range dbFilters {
+		filters = append(filters, newInboundFilter(f))
+	}
+	return filters, nil
+}
+
+func (r *Repository) InboundFilterDelete(ctx context.Context, projectID, id uint) error {
+	res := r.dbExecutor(ctx).Where("project_id = ?", projectID).Delete(&rdbms.ProjectInboundFilter{}, id)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return ErrRecordNotFound
+		}
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	r.cache.Del([]byte(cacheKeyInboundFilters(projectID)))
+	return nil
+}
+
+// InboundFilterCountersIncrement adds the number of events dropped by each filter of the project and sets the
+// time of its last match, both keyed by filter ID.
+func (r *Repository) InboundFilterCountersIncrement(ctx context.Context, projectID uint, counts map[uint]int, filteredAt map[uint]time.Time) error {
+	return r.dbExecutor(ctx).Transaction(func(tx *gorm.DB) error {
+		for id, n := range counts {
+			res := tx.Model(&rdbms.ProjectInboundFilter{}).
+				Where("id = ? AND project_id = ?", id, projectID).
+				Updates(map[string]any{
+					"filtered_count":   gorm.Expr("filtered_count + ?", n),
+					"last_filtered_at": filteredAt[id],
+				})
+			if res.Error != nil {
+				return res.Error
+			}
+		}
+		return nil
+	})
+}
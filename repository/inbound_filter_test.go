@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/georgepsarakis/periscope/repository/rdbms"
+)
+
+func TestRepository_InboundFiltersByProjectID_LargeEntry(t *testing.T) {
+	r, db := newTestRepository(t)
+	require.NoError(t, db.AutoMigrate(&rdbms.ProjectInboundFilter{}))
+	ctx := context.Background()
+	for i := range 8 {
+		_, err := r.InboundFilterCreate(ctx, InboundFilter{
+			ProjectID: 1,
+			Type:      "message",
+			Pattern:   fmt.Sprintf("*connection to database replica %d refused*", i),
+		})
+		require.NoError(t, err)
+	}
+
+	for range 2 {
+		filters, err := r.InboundFiltersByProjectID(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, filters, 8)
+		b, err := json.Marshal(filters)
+		require.NoError(t, err)
+		assert.Greater(t, len(b), 1024)
+	}
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"crypto/subtle"
 	"database/sql"
 	"encoding/json"
 	"time"
@@ -14,19 +15,38 @@ type BaseModel struct {
 
 type Event struct {
 	BaseModel
-	EventID      string          `json:"event_id"`
-	Title        string          `json:"title"`
-	Fingerprint  string          `json:"fingerprint"`
-	StackTrace   json.RawMessage `json:"stack_trace"`
-	EventGroupID uint            `json:"event_group_id"`
-	ProjectID    uint            `json:"project_id"`
-	EmittedAt    time.Time       `json:"emitted_at"`
+	EventID         string          `json:"event_id"`
+	Title           string          `json:"title"`
+	Fingerprint     string          `json:"fingerprint"`
+	GroupingVersion string          `json:"grouping_version"`
+	StackTrace      json.RawMessage `json:"stack_trace"`
+	Exceptions      json.RawMessage `json:"exceptions"`
+	EventGroupID    uint            `json:"event_group_id"`
+	ProjectID       uint            `json:"project_id"`
+	EmittedAt       time.Time       `json:"emitted_at"`
+	ReceivedAt      time.Time       `json:"received_at"`
+	ClientName      string          `json:"client_name"`
+	ClientVersion   string          `json:"client_version"`
+	Tags            json.RawMessage `json:"tags,omitempty"`
+	Extra           json.RawMessage `json:"extra,omitempty"`
+	Breadcrumbs     json.RawMessage `json:"breadcrumbs,omitempty"`
+	User            json.RawMessage `json:"user,omitempty"`
+	Request         json.RawMessage `json:"request,omitempty"`
+	Contexts        json.RawMessage `json:"contexts,omitempty"`
+	ServerName      string          `json:"server_name,omitempty"`
+	Release         string          `json:"release,omitempty"`
+	Dist            string          `json:"dist,omitempty"`
+	Environment     string          `json:"environment,omitempty"`
+	Transaction     string          `json:"transaction,omitempty"`
+	// Payload is the normalized event as received, only loaded when retrieving a single event.
+	Payload json.RawMessage `json:"payload,omitempty"`
 }
 
 type Project struct {
 	BaseModel
 	Name                    string                   `json:"name"`
 	PublicID                string                   `json:"public_id"`
+	RequireIngestionSecret  bool                     `json:"require_ingestion_secret"`
 	ProjectIngestionAPIKeys []ProjectIngestionAPIKey `json:"project_ingestion_api_keys"`
 }
 
@@ -45,19 +65,134 @@ func (p Project) HasAccess(key string) bool {
 	return false
 }
 
+// HasSecretAccess verifies both the public key and the secret of a non-expired ingestion API key.
+func (p Project) HasSecretAccess(key, secret string) bool {
+	if secret == "" {
+		return false
+	}
+	for _, apiKey := range p.ProjectIngestionAPIKeys {
+		if apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(time.Now()) {
+			continue
+		}
+		if key == apiKey.Key && apiKey.Secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(apiKey.Secret)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
 type ProjectIngestionAPIKey struct {
 	BaseModel
 	Key       string     `json:"key"`
+	Secret    string     `json:"secret"`
 	ProjectID uint       `json:"project_id"`
 	ExpiresAt *time.Time `json:"expires_at"`
 }
 
 type EventGroup struct {
 	BaseModel
-	TotalCount      int       `json:"total_count"`
-	EventReceivedAt time.Time `json:"event_received_at"`
-	ProjectID       uint      `json:"project_id"`
-	AggregationKey  string    `json:"aggregation_key"`
+	TotalCount      int        `json:"total_count"`
+	StoredCount     int        `json:"stored_count"`
+	EventReceivedAt time.Time  `json:"event_received_at"`
+	ProjectID       uint       `json:"project_id"`
+	AggregationKey  string     `json:"aggregation_key"`
+	GroupingVersion string     `json:"grouping_version"`
+	ResolvedAt      *time.Time `json:"resolved_at"`
+}
+
+// FingerprintRule overrides the grouping of the events of a project. All non-empty matchers must match
+// for the rule to apply. ExceptionType, Module, Function and tag values are glob patterns, Message is a
+// regular expression.
+type FingerprintRule struct {
+	BaseModel
+	ProjectID     uint              `json:"project_id"`
+	Priority      int               `json:"priority"`
+	ExceptionType string            `json:"exception_type,omitempty"`
+	Message       string            `json:"message,omitempty"`
+	Module        string            `json:"module,omitempty"`
+	Function      string            `json:"function,omitempty"`
+	Level         string            `json:"level,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
+	Fingerprint   []string          `json:"fingerprint"`
+}
+
+// InboundFilter drops the matching events of a project before they are queued. FilteredCount is the number
+// of events dropped by the filter.
+// Processing stages after which an event is dead-lettered.
+const (
+	DeadLetterStageDecode  = "decode"
+	DeadLetterStageExtract = "extract"
+	DeadLetterStagePersist = "persist"
+)
+
+// DeadLetterEvent is an ingested event that failed at the given stage. The payload is the queued event
+// message, it is only returned when reading a single dead letter.
+type DeadLetterEvent struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ProjectID uint      `json:"project_id"`
+	EventID   string    `json:"event_id,omitempty"`
+	Stage     string    `json:"stage"`
+	Error     string    `json:"error"`
+	Attempts  int       `json:"attempts"`
+	Payload   string    `json:"payload,omitempty"`
+}
+
+type InboundFilter struct {
+	BaseModel
+	ProjectID      uint       `json:"project_id"`
+	Type           string     `json:"type"`
+	Pattern        string     `json:"pattern,omitempty"`
+	FilteredCount  int        `json:"filtered_count"`
+	LastFilteredAt *time.Time `json:"last_filtered_at,omitempty"`
+}
+
+// ProjectLimits are the ingestion limits of a project, zero values are not enforced.
+type ProjectLimits struct {
+	ProjectID       uint `json:"project_id"`
+	EventsPerMinute int  `json:"events_per_minute"`
+	DailyQuota      int  `json:"daily_quota"`
+	MonthlyQuota    int  `json:"monthly_quota"`
+}
+
+// ProjectRetention overrides the global retention of a project. Nil values apply the global default,
+// zero keeps the data forever.
+type ProjectRetention struct {
+	ProjectID         uint `json:"project_id"`
+	EventDays         *int `json:"event_days"`
+	ResolvedGroupDays *int `json:"resolved_group_days"`
+}
+
+// Outcome is the reason an ingested event was accepted or rejected.
+type Outcome string
+
+const (
+	OutcomeAccepted    Outcome = "accepted"
+	OutcomeRateLimited Outcome = "rate_limited"
+	OutcomeOverQuota   Outcome = "over_quota"
+	OutcomeFiltered    Outcome = "filtered"
+)
+
+// ProjectUsage counts the ingested events of a project during a day (UTC) by outcome.
+type ProjectUsage struct {
+	ProjectID   uint      `json:"project_id"`
+	Day         time.Time `json:"day"`
+	Accepted    int       `json:"accepted"`
+	RateLimited int       `json:"rate_limited"`
+	OverQuota   int       `json:"over_quota"`
+	Filtered    int       `json:"filtered"`
+}
+
+// QueueMessage is a message of the durable ingestion queue.
+type QueueMessage struct {
+	ID           uint              `json:"id"`
+	CreatedAt    time.Time         `json:"created_at"`
+	Topic        string            `json:"topic"`
+	UUID         string            `json:"uuid"`
+	PartitionKey string            `json:"partition_key,omitempty"`
+	Payload      []byte            `json:"payload"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	Attempts     int               `json:"attempts"`
 }
 
 type Alert struct {
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -28,20 +30,35 @@ func RandomString(charset string, length uint) string {
 	return string(b)
 }
 
-func (r *Repository) ProjectCreate(ctx context.Context, name string) (Project, error) {
+// RandomSecret returns 32 bytes from a cryptographically secure source, hex-encoded.
+func RandomSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := cryptorand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (r *Repository) ProjectCreate(ctx context.Context, name string, requireIngestionSecret bool) (Project, error) {
+	secret, err := RandomSecret()
+	if err != nil {
+		return Project{}, err
+	}
 	project := Project{
-		Name:     name,
-		PublicID: RandomString(CharsetLettersLowercase, 8),
+		Name:                   name,
+		PublicID:               RandomString(CharsetLettersLowercase, 8),
+		RequireIngestionSecret: requireIngestionSecret,
 	}
 	key := ProjectIngestionAPIKey{
-		Key: RandomString(CharsetAlphanumeric, 36),
+		Key:    RandomString(CharsetAlphanumeric, 36),
+		Secret: secret,
 	}
-	err := r.database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		if res := r.database.WithContext(ctx).Create(&project); res.Error != nil {
+	err = r.database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if res := tx.Create(&project); res.Error != nil {
 			return res.Error
 		}
 		key.ProjectID = project.ID
-		if res := r.database.WithContext(ctx).Create(&key); res.Error != nil {
+		if res := tx.Create(&key); res.Error != nil {
 			return res.Error
 		}
 		project.ProjectIngestionAPIKeys = []ProjectIngestionAPIKey{key}
@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRandomSecret(t *testing.T) {
+	secret, err := RandomSecret()
+	require.NoError(t, err)
+	b, err := hex.DecodeString(secret)
+	require.NoError(t, err)
+	assert.Len(t, b, 32)
+
+	other, err := RandomSecret()
+	require.NoError(t, err)
+	assert.NotEqual(t, secret, other)
+}
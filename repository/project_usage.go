@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/georgepsarakis/periscope/repository/rdbms"
+)
+
+func cacheKeyProjectLimits(projectID uint) string {
+	return fmt.Sprintf("project_limits:%d", projectID)
+}
+
+// ProjectLimitsFindByProjectID returns the ingestion limits of a project, which are not enforced when
+// they have not been configured.
+func (r *Repository) ProjectLimitsFindByProjectID(ctx context.Context, projectID uint) (ProjectLimits, error) {
+	return cachedLookup(r, cacheKeyProjectLimits(projectID), settingsCacheTTLSeconds, func() (ProjectLimits, error) {
+		var dbLimit rdbms.ProjectLimit
+		res := r.dbExecutor(ctx).Where("project_id = ?", projectID).First(&dbLimit)
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return ProjectLimits{ProjectID: projectID}, nil
+		}
+		if res.Error != nil {
+			return ProjectLimits{}, res.Error
+		}
+		return newProjectLimits(dbLimit), nil
+	})
+}
+
+// ProjectLimitsUpdate creates or replaces the ingestion limits of a project.
+func (r *Repository) ProjectLimitsUpdate(ctx context.Context, limits ProjectLimits) (ProjectLimits, error) {
+	dbLimit := rdbms.ProjectLimit{
+		ProjectID:       limits.ProjectID,
+		EventsPerMinute: limits.EventsPerMinute,
+		DailyQuota:      limits.DailyQuota,
+		MonthlyQuota:    limits.MonthlyQuota,
+	}
+	res := r.dbExecutor(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "project_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"events_per_minute", "daily_quota", "monthly_quota", "updated_at"}),
+	}).Create(&dbLimit)
+	if res.Error != nil {
+		return ProjectLimits{}, res.Error
+	}
+	r.cache.Del([]byte(cacheKeyProjectLimits(limits.ProjectID)))
+	return newProjectLimits(dbLimit), nil
+}
+
+func newProjectLimits(l rdbms.ProjectLimit) ProjectLimits {
+	return ProjectLimits{
+		ProjectID:       l.ProjectID,
+		EventsPerMinute: l.EventsPerMinute,
+		DailyQuota:      l.DailyQuota,
+		MonthlyQuota:    l.MonthlyQuota,
+	}
+}
+
+// ProjectUsageIncrement adds the given number of events per outcome to the usage of the project on the day.
+func (r *Repository) ProjectUsageIncrement(ctx context.Context, projectID uint, day time.Time, counts map[Outcome]int) error {
+	usage := rdbms.ProjectUsage{
+		ProjectID:   projectID,
+		Day:         day.UTC().Truncate(24 * time.Hour),
+		Accepted:    counts[OutcomeAccepted],
+		RateLimited: counts[OutcomeRateLimited],
+		OverQuota:   counts[OutcomeOverQuota],
+		Filtered:    counts[OutcomeFiltered],
+	}
+	return r.dbExecutor(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "project_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"accepted":     gorm.Expr("project_usages.accepted + ?", usage.Accepted),
+			"rate_limited": gorm.Expr("project_usages.rate_limited + ?", usage.RateLimited),
+			"over_quota":   gorm.Expr("project_usages.over_quota + ?", usage.OverQuota),
+			"filtered":     gorm.Expr("project_usages.filtered + ?", usage.Filtered),
+			"updated_at":   r.now(),
+		}),
+	}).Create(&usage).Error
+}
+
+// ProjectUsageAccepted counts the accepted events of the project on the days in [from, to).
+func (r *Repository) ProjectUsageAccepted(ctx context.Context, projectID uint, from, to time.Time) (int, error) {
+	var accepted int
+	res := r.dbExecutor(ctx).Model(&rdbms.ProjectUsage{}).
+		Select("COALESCE(SUM(accepted), 0)").
+		Where("project_id = ? AND day >= ? AND day < ?", projectID, from.UTC(), to.UTC()).
+		Scan(&accepted)
+	return accepted, res.Error
+}
+
+// ProjectUsageList returns the daily usage of the project since the given day, most recent first.
+func (r *Repository) ProjectUsageList(ctx context.Context, projectID uint, since time.Time) ([]ProjectUsage, error) {
+	var rows []rdbms.ProjectUsage
+	res := r.dbExecutor(ctx).
+		Where("project_id = ? AND day >= ?", projectID, since.UTC()).
+		Order("day DESC").
+		Find(&rows)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	usage := make([]ProjectUsage, 0, len(rows))
+	for _, row := range rows {
+		usage = append(usage, ProjectUsage{
+			ProjectID:   row.ProjectID,
+			Day:         row.Day,
+			Accepted:    row.Accepted,
+			RateLimited: row.RateLimited,
+			OverQuota:   row.OverQuota,
+			Filtered:    row.Filtered,
+		})
+	}
+	return usage, nil
+}
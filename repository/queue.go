@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/georgepsarakis/periscope/repository/rdbms"
+)
+
+// QueueMessagesCreate appends messages to the durable queue of a topic.
+func (r *Repository) QueueMessagesCreate(ctx context.Context, topic string, messages []QueueMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	rows := make([]rdbms.QueueMessage, 0, len(messages))
+	for _, m := range messages {
+		rows = append(rows, rdbms.QueueMessage{
+			Topic:        topic,
+			UUID:         m.UUID,
+			PartitionKey: m.PartitionKey,
+			Payload:      m.Payload,
+			Metadata:     m.Metadata,
+		})
+	}
+	return r.dbExecutor(ctx).Create(&rows).Error
+}
+
+// QueueMessagesLease returns up to limit messages of the topic in publishing order, locking them for the
+// lease duration. Messages that are neither deleted nor released before the lease expires are delivered again,
+// so that messages leased by a consumer that crashed are not lost.
+func (r *Repository) QueueMessagesLease(ctx context.Context, topic string, limit int, lease time.Duration) ([]QueueMessage, error) {
+	tx := r.dbExecutor(ctx)
+	now := r.now()
+	var candidates []rdbms.QueueMessage
+	res := tx.Where("topic = ? AND (locked_until IS NULL OR locked_until < ?)", topic, now).
+		Order("id").Limit(limit).Find(&candidates)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	leased := make([]QueueMessage, 0, len(candidates))
+	for _, m := range candidates {
+		// Another consumer may have leased the message in the meantime
+		res := tx.Model(&rdbms.QueueMessage{}).
+			Where("id = ? AND (locked_until IS NULL OR locked_until < ?)", m.ID, now).
+			Updates(map[string]any{
+				"locked_until": now.Add(lease),
+				"attempts":     gorm.Expr("attempts + 1"),
+			})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			continue
+		}
+		leased = append(leased, QueueMessage{
+			ID:           m.ID,
+			CreatedAt:    m.CreatedAt,
+			Topic:        m.Topic,
+			UUID:         m.UUID,
+			PartitionKey: m.PartitionKey,
+			Payload:      m.Payload,
+			Metadata:     m.Metadata,
+			Attempts:     m.Attempts + 1,
+		})
+	}
+	return leased, nil
+}
+
+// QueueMessagesDepth counts the messages of the topic, including the leased ones, by partition key.
+func (r *Repository) QueueMessagesDepth(ctx context.Context, topic string) (map[string]int, error) {
+	var rows []struct {
+		PartitionKey string
+		Count        int
+	}
+	res := r.dbExecutor(ctx).Model(&rdbms.QueueMessage{}).
+		Select("COALESCE(partition_key, '') AS partition_key, COUNT(*) AS count").
+		Where("topic = ?", topic).
+		Group("COALESCE(partition_key, '')").
+		Scan(&rows)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	depth := make(map[string]int, len(rows))
+	for _, row := range rows {
+		depth[row.PartitionKey] = row.Count
+	}
+	return depth, nil
+}
+
+// QueueMessageDelete removes a message once it has been processed.
+func (r *Repository) QueueMessageDelete(ctx context.Context, id uint) error {
+	return r.dbExecutor(ctx).Delete(&rdbms.QueueMessage{}, id).Error
+}
+
+// QueueMessagesExtendLease locks the leased messages for the lease duration from now.
+func (r *Repository) QueueMessagesExtendLease(ctx context.Context, ids []uint, lease time.Duration) error {
+	return r.dbExecutor(ctx).Model(&rdbms.QueueMessage{}).Where("id IN ?", ids).
+		Update("locked_until", r.now().Add(lease)).Error
+}
+
+// QueueMessageRelease makes a leased message available again from the given time.
+func (r *Repository) QueueMessageRelease(ctx context.Context, id uint, availableAt time.Time) error {
+	return r.dbExecutor(ctx).Model(&rdbms.QueueMessage{}).Where("id = ?", id).
+		Update("locked_until", availableAt).Error
+}
@@ -10,25 +10,53 @@ import (
 
 type Event struct {
 	gorm.Model
-	EventID      string          `json:"event_id" gorm:"not null"`
-	Title        string          `json:"title" gorm:"not null"`
-	Fingerprint  string          `gorm:"not null"`
-	StackTrace   json.RawMessage `gorm:"type:json"`
-	EventGroupID uint            `gorm:"not null;index:idx_event_group_id"`
-	ProjectID    uint            `gorm:"not null;index:idx_project_id_emitted_at,priority:1"`
-	EmittedAt    time.Time       `gorm:"not null;index:idx_project_id_emitted_at,priority:2"`
+	EventID       string          `json:"event_id" gorm:"not null;index:uq_events_project_id_event_id,unique,priority:2"`
+	Title         string          `json:"title" gorm:"not null"`
+	Fingerprint   string          `gorm:"not null"`
+	StackTrace    json.RawMessage `gorm:"type:json"`
+	Exceptions    json.RawMessage `gorm:"type:json"`
+	EventGroupID  uint            `gorm:"not null;index:idx_event_group_id"`
+	ProjectID     uint            `gorm:"not null;index:idx_project_id_emitted_at,priority:1;index:uq_events_project_id_event_id,unique,priority:1;index:idx_events_project_id_received_at,priority:1"`
+	EmittedAt     time.Time       `gorm:"not null;index:idx_project_id_emitted_at,priority:2"`
+	ReceivedAt    time.Time       `gorm:"not null;default:CURRENT_TIMESTAMP;index:idx_events_project_id_received_at,priority:2"`
+	ClientName    string          `gorm:"null"`
+	ClientVersion string          `gorm:"null"`
+	Tags          json.RawMessage `gorm:"type:json"`
+	Extra         json.RawMessage `gorm:"type:json"`
+	Breadcrumbs   json.RawMessage `gorm:"type:json"`
+	User          json.RawMessage `gorm:"type:json"`
+	Request       json.RawMessage `gorm:"type:json"`
+	Contexts      json.RawMessage `gorm:"type:json"`
+	ServerName    string          `gorm:"null"`
+	Release       string          `gorm:"null"`
+	Dist          string          `gorm:"null"`
+	Environment   string          `gorm:"null"`
+	Transaction   string          `gorm:"null"`
+	PayloadHash   string          `gorm:"null;index:idx_events_payload_hash"`
+}
+
+// EventPayload is the compressed raw payload of one or more events, addressed by the SHA-256 of its content.
+type EventPayload struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Hash      string `gorm:"not null;index:uq_event_payloads_hash,unique"`
+	Encoding  string `gorm:"not null"`
+	Size      int    `gorm:"not null"`
+	Data      []byte `gorm:"not null"`
 }
 
 type Project struct {
 	gorm.Model
 	Name                    string `gorm:"not null;index:uq_project_name,unique"`
 	PublicID                string `gorm:"not null;index:uq_project_public_id,unique"`
+	RequireIngestionSecret  bool   `gorm:"not null;default:false"`
 	ProjectIngestionAPIKeys []ProjectIngestionAPIKey
 }
 
 type ProjectIngestionAPIKey struct {
 	gorm.Model
 	Key       string     `gorm:"not null"`
+	Secret    string     `gorm:"null"`
 	ProjectID uint       `gorm:"not null;index:idx_project_id"`
 	ExpiresAt *time.Time `gorm:"null"`
 }
@@ -37,9 +65,43 @@ type EventGroup struct {
 	gorm.Model
 	TotalCount       int          `gorm:"not null"`
 	EventReceivedAt  time.Time    `gorm:"not null"`
-	ProjectID        uint         `gorm:"not null;index:idx_proj_aggr_key,priority:1"`
-	AggregationKey   string       `gorm:"not null;index:idx_proj_aggr_key,priority:2"`
+	ProjectID        uint         `gorm:"not null;index:uq_event_groups_project_id_aggregation_key,unique,priority:1"`
+	AggregationKey   string       `gorm:"not null;index:uq_event_groups_project_id_aggregation_key,unique,priority:2"`
+	GroupingVersion  string       `gorm:"not null;default:legacy"`
 	AlertTriggeredAt sql.NullTime `gorm:"null"`
+	// StoredCount is the number of events of the group that were stored, when sampling applies it is lower
+	// than TotalCount. The sample window counts the events sampled during the current hour.
+	StoredCount       int        `gorm:"not null;default:0"`
+	SampleWindowStart *time.Time `gorm:"null"`
+	SampleWindowCount int        `gorm:"not null;default:0"`
+	// ResolvedAt is set when the group is resolved and cleared when a new event of the group is stored.
+	ResolvedAt *time.Time `gorm:"null"`
+}
+
+type ProjectFingerprintRule struct {
+	gorm.Model
+	ProjectID     uint              `gorm:"not null;index:idx_project_fingerprint_rules_project_id"`
+	Priority      int               `gorm:"not null;default:0"`
+	ExceptionType string            `gorm:"null"`
+	Message       string            `gorm:"null"`
+	Module        string            `gorm:"null"`
+	Function      string            `gorm:"null"`
+	Level         string            `gorm:"null"`
+	Tags          map[string]string `gorm:"null;serializer:json"`
+	Fingerprint   []string          `gorm:"not null;serializer:json"`
+}
+
+// QueueMessage is a message of the durable ingestion queue. Messages are deleted once acknowledged.
+type QueueMessage struct {
+	ID           uint `gorm:"primarykey"`
+	CreatedAt    time.Time
+	Topic        string            `gorm:"not null;index:idx_queue_messages_topic_locked_until,priority:1"`
+	UUID         string            `gorm:"not null;index:uq_queue_messages_uuid,unique"`
+	PartitionKey string            `gorm:"null"`
+	Payload      []byte            `gorm:"not null"`
+	Metadata     map[string]string `gorm:"null;serializer:json"`
+	LockedUntil  *time.Time        `gorm:"null;index:idx_queue_messages_topic_locked_until,priority:2"`
+	Attempts     int               `gorm:"not null;default:0"`
 }
 
 type ProjectAlertDestination struct {
@@ -90,3 +152,56 @@ type AlertDestinationNotificationWebhookConfiguration struct {
 	HTTPMethod                string            `gorm:"not null"`
 	Headers                   map[string]string `gorm:"null;serializer:json"`
 }
+
+// ProjectLimit holds the ingestion limits of a project, zero values are not enforced.
+type ProjectLimit struct {
+	gorm.Model
+	ProjectID       uint `gorm:"not null;index:uq_project_limits_project_id,unique"`
+	EventsPerMinute int  `gorm:"not null;default:0"`
+	DailyQuota      int  `gorm:"not null;default:0"`
+	MonthlyQuota    int  `gorm:"not null;default:0"`
+}
+
+// ProjectRetention overrides the global retention of a project. Null values apply the global default,
+// zero keeps the data forever.
+type ProjectRetention struct {
+	gorm.Model
+	ProjectID         uint `gorm:"not null;index:uq_project_retentions_project_id,unique"`
+	EventDays         *int `gorm:"null"`
+	ResolvedGroupDays *int `gorm:"null"`
+}
+
+// ProjectUsage counts the ingested events of a project per day and outcome.
+type ProjectUsage struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	ProjectID   uint      `gorm:"not null;index:uq_project_usages_project_id_day,unique,priority:1"`
+	Day         time.Time `gorm:"not null;index:uq_project_usages_project_id_day,unique,priority:2"`
+	Accepted    int       `gorm:"not null;default:0"`
+	RateLimited int       `gorm:"not null;default:0"`
+	OverQuota   int       `gorm:"not null;default:0"`
+	Filtered    int       `gorm:"not null;default:0"`
+}
+
+// DeadLetterEvent is an ingested event that could not be processed or persisted, kept for inspection and replay.
+type DeadLetterEvent struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	ProjectID uint   `gorm:"not null;index:idx_dead_letter_events_project_id"`
+	EventID   string `gorm:"null"`
+	Stage     string `gorm:"not null"`
+	Error     string `gorm:"not null"`
+	Attempts  int    `gorm:"not null;default:0"`
+	Payload   []byte `gorm:"not null"`
+}
+
+// ProjectInboundFilter drops matching events of the project before they are queued.
+type ProjectInboundFilter struct {
+	gorm.Model
+	ProjectID      uint       `gorm:"not null;index:idx_project_inbound_filters_project_id"`
+	Type           string     `gorm:"not null"`
+	Pattern        string     `gorm:"null"`
+	FilteredCount  int        `gorm:"not null;default:0"`
+	LastFilteredAt *time.Time `gorm:"null"`
+}
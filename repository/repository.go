@@ -4,12 +4,14 @@ import (
 	"time"
 
 	"github.com/coocood/freecache"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
 type Repository struct {
 	cache    *freecache.Cache
 	database *gorm.DB
+	logger   *zap.Logger
 	now      func() time.Time
 }
 
@@ -19,9 +21,10 @@ func UTCNow() time.Time {
 	return time.Now().UTC()
 }
 
-func New(database *gorm.DB) *Repository {
+func New(database *gorm.DB, logger *zap.Logger) *Repository {
 	return &Repository{
 		database: database,
+		logger:   logger,
 		cache:    freecache.NewCache(megabyte),
 		now:      UTCNow,
 	}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/georgepsarakis/periscope/repository/rdbms"
+)
+
+func newProjectRetention(r rdbms.ProjectRetention) ProjectRetention {
+	return ProjectRetention{
+		ProjectID:         r.ProjectID,
+		EventDays:         r.EventDays,
+		ResolvedGroupDays: r.ResolvedGroupDays,
+	}
+}
+
+// ProjectRetentionFindByProjectID returns the retention overrides of a project, which are empty when
+// they have not been configured.
+func (r *Repository) ProjectRetentionFindByProjectID(ctx context.Context, projectID uint) (ProjectRetention, error) {
+	var dbRetention rdbms.ProjectRetention
+	res := r.dbExecutor(ctx).Where("project_id = ?", projectID).First(&dbRetention)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return ProjectRetention{ProjectID: projectID}, nil
+		}
+		return ProjectRetention{}, res.Error
+	}
+	return newProjectRetention(dbRetention), nil
+}
+
+// ProjectRetentionUpdate creates or replaces the retention overrides of a project.
+func (r *Repository) ProjectRetentionUpdate(ctx context.Context, retention ProjectRetention) (ProjectRetention, error) {
+	dbRetention := rdbms.ProjectRetention{
+		ProjectID:         retention.ProjectID,
+		EventDays:         retention.EventDays,
+		ResolvedGroupDays: retention.ResolvedGroupDays,
+	}
+	res := r.dbExecutor(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "project_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"event_days", "resolved_group_days", "updated_at"}),
+	}).Create(&dbRetention)
+	if res.Error != nil {
+		return ProjectRetention{}, res.Error
+	}
+	return newProjectRetention(dbRetention), nil
+}
+
+// ProjectRetentionList returns the retention overrides of all the projects, projects without overrides
+// are included with nil values.
+func (r *Repository) ProjectRetentionList(ctx context.Context) ([]ProjectRetention, error) {
+	var rows []struct {
+		ID                uint
+		EventDays         *int
+		ResolvedGroupDays *int
+	}
+	res := r.dbExecutor(ctx).Model(&rdbms.Project{}).
+		Select("projects.id, project_retentions.event_days, project_retentions.resolved_group_days").
+		Joins("LEFT JOIN project_retentions ON project_retentions.project_id = projects.id AND project_retentions.deleted_at IS NULL").
+		Order("projects.id").
+		Scan(&rows)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	retentions := make([]ProjectRetention, 0, len(rows))
+	for _, row := range rows {
+		retentions = append(retentions, ProjectRetention{
+			ProjectID:         row.ID,
+			EventDays:         row.EventDays,
+			ResolvedGroupDays: row.ResolvedGroupDays,
+		})
+	}
+	return retentions, nil
+}
+
+// purge permanently deletes up to limit rows of the table that match the condition, which refers to the
+// table as "t". The condition is repeated on the deleted rows, so that Postgres evaluates it again on rows
+// updated while the statement waited for their lock, e.g. a group that received new events.
+func (r *Repository) purge(ctx context.Context, table, condition string, limit int, args ...any) (int64, error) {
+	query := fmt.Sprintf(`DELETE FROM %[1]s AS t WHERE %[2]s AND t.id IN (
+		SELECT t.id FROM %[1]s AS t WHERE %[2]s LIMIT %[3]d)`, table, condition, limit)
+	res := r.dbExecutor(ctx).Exec(query, slices.Concat(args, args)...)
+	return res.RowsAffected, res.Error
+}
+
+// purgeEvents deletes up to limit events that match the condition like purge, and decrements the stored
+// count of their groups in the same transaction.
+func (r *Repository) purgeEvents(ctx context.Context, condition string, limit int, args ...any) (int64, error) {
+	query := fmt.Sprintf(`DELETE FROM events AS t WHERE %[1]s AND t.id IN (
+		SELECT t.id FROM events AS t WHERE %[1]s LIMIT %[2]d) RETURNING event_group_id`, condition, limit)
+	var groupIDs []uint
+	err := r.dbExecutor(ctx).Transaction(func(tx *gorm.DB) error {
+		if res := tx.Raw(query, slices.Concat(args, args)...).Scan(&groupIDs); res.Error != nil {
+			return res.Error
+		}
+		deleted := make(map[uint]int)
+		for _, id := range groupIDs {
+			deleted[id]++
+		}
+		for id, n := range deleted {
+			res := tx.Model(&rdbms.EventGroup{}).Where("id = ?", id).
+				UpdateColumn("stored_count", gorm.Expr("stored_count - ?", n))
+			if res.Error != nil {
+				return res.Error
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(groupIDs)), nil
+}
+
+// EventsPurge deletes up to limit events of the project received before the given time.
+func (r *Repository) EventsPurge(ctx context.Context, projectID uint, receivedBefore time.Time, limit int) (int64, error) {
+	return r.purgeEvents(ctx, "t.project_id = ? AND t.received_at < ?", limit, projectID, receivedBefore)
+}
+
+// ResolvedEventGroupEventsPurge deletes up to limit events of the groups of the project resolved before
+// the given time.
+func (r *Repository) ResolvedEventGroupEventsPurge(ctx context.Context, projectID uint, resolvedBefore time.Time, limit int) (int64, error) {
+	return r.purgeEvents(ctx, `t.project_id = ? AND t.event_group_id IN (
+		SELECT g.id FROM event_groups g WHERE g.project_id = ? AND g.resolved_at < ?)`,
+		limit, projectID, projectID, resolvedBefore)
+}
+
+// EventGroupsPurge deletes up to limit groups of the project without stored events, which either did not
+// receive events since receivedBefore or were resolved before resolvedBefore. A nil time disables the
+// respective condition.
+func (r *Repository) EventGroupsPurge(ctx context.Context, projectID uint, receivedBefore, resolvedBefore *time.Time, limit int) (int64, error) {
+	if receivedBefore == nil && resolvedBefore == nil {
+		return 0, nil
+	}
+	condition := "t.project_id = ? AND NOT EXISTS (SELECT 1 FROM events e WHERE e.event_group_id = t.id) AND ("
+	args := []any{projectID}
+	if receivedBefore != nil {
+		condition += "t.event_received_at < ?"
+		args = append(args, *receivedBefore)
+	}
+	if resolvedBefore != nil {
+		if receivedBefore != nil {
+			condition += " OR "
+		}
+		condition += "t.resolved_at < ?"
+		args = append(args, *resolvedBefore)
+	}
+	return r.purge(ctx, "event_groups", condition+")", limit, args...)
+}
+
+// AlertsPurgeOrphaned deletes up to limit alerts of deleted groups.
+func (r *Repository) AlertsPurgeOrphaned(ctx context.Context, limit int) (int64, error) {
+	return r.purge(ctx, "alerts", "NOT EXISTS (SELECT 1 FROM event_groups g WHERE g.id = t.event_group_id)", limit)
+}
+
+// AlertDestinationNotificationsPurgeOrphaned deletes up to limit notifications of deleted alerts.
+func (r *Repository) AlertDestinationNotificationsPurgeOrphaned(ctx context.Context, limit int) (int64, error) {
+	return r.purge(ctx, "alert_destination_notifications",
+		"NOT EXISTS (SELECT 1 FROM alerts a WHERE a.id = t.alert_id)", limit)
+}
+
+// EventPayloadsPurgeOrphaned deletes up to limit raw payloads that are not referenced by any event.
+func (r *Repository) EventPayloadsPurgeOrphaned(ctx context.Context, limit int) (int64, error) {
+	return r.purge(ctx, "event_payloads", "NOT EXISTS (SELECT 1 FROM events e WHERE e.payload_hash = t.hash)", limit)
+}
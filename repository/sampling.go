@@ -0,0 +1,44 @@
+package repository
+
+import "time"
+
+// EventSampling limits the events stored for each group, while the group still counts all of them.
+// The first KeepFirst events are always stored, then one in every Rate events, up to MaxPerHour sampled
+// events per hour. The zero value stores every event.
+type EventSampling struct {
+	KeepFirst  int
+	Rate       int
+	MaxPerHour int
+}
+
+func (s EventSampling) Enabled() bool {
+	return s.KeepFirst > 0 || s.Rate > 1 || s.MaxPerHour > 0
+}
+
+// sampleWindow is the number of events sampled during an hour.
+type sampleWindow struct {
+	start time.Time
+	count int
+}
+
+// keep decides whether the n-th event of a group, counting from zero, is stored.
+func (s EventSampling) keep(n int, window *sampleWindow, now time.Time) bool {
+	if !s.Enabled() || n == 0 || n < s.KeepFirst {
+		return true
+	}
+	if s.Rate > 1 && (n-s.KeepFirst)%s.Rate != 0 {
+		return false
+	}
+	if s.MaxPerHour <= 0 {
+		return true
+	}
+	if hour := now.Truncate(time.Hour); !window.start.Equal(hour) {
+		window.start = hour
+		window.count = 0
+	}
+	if window.count >= s.MaxPerHour {
+		return false
+	}
+	window.count++
+	return true
+}
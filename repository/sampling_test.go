@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventSampling_Keep(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		sampling EventSampling
+		events   int
+		want     []int
+	}{
+		{
+			name:     "disabled",
+			sampling: EventSampling{},
+			events:   4,
+			want:     []int{0, 1, 2, 3},
+		},
+		{
+			name:     "first events then one in three",
+			sampling: EventSampling{KeepFirst: 2, Rate: 3},
+			events:   10,
+			want:     []int{0, 1, 2, 5, 8},
+		},
+		{
+			name:     "hourly cap",
+			sampling: EventSampling{KeepFirst: 1, Rate: 2, MaxPerHour: 2},
+			events:   10,
+			want:     []int{0, 1, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window := &sampleWindow{}
+			var kept []int
+			for n := range tt.events {
+				if tt.sampling.keep(n, window, now) {
+					kept = append(kept, n)
+				}
+			}
+			assert.Equal(t, tt.want, kept)
+		})
+	}
+}
+
+func TestEventSampling_Keep_WindowReset(t *testing.T) {
+	sampling := EventSampling{MaxPerHour: 1}
+	now := time.Date(2026, 10, 18, 12, 30, 0, 0, time.UTC)
+	window := &sampleWindow{}
+
+	assert.True(t, sampling.keep(1, window, now))
+	assert.False(t, sampling.keep(2, window, now.Add(10*time.Minute)))
+	assert.True(t, sampling.keep(3, window, now.Add(time.Hour)))
+}
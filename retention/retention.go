@@ -0,0 +1,225 @@
+// Package retention deletes the data of the projects that is older than their retention.
+package retention
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/georgepsarakis/periscope/app"
+	"github.com/georgepsarakis/periscope/repository"
+)
+
+// Options configures Retention, zero durations and sizes are replaced with the defaults.
+type Options struct {
+	// EventDays is the number of days events are kept, unless the project overrides it. Zero keeps them forever.
+	EventDays int
+	// ResolvedGroupDays is the number of days resolved groups and their events are kept, unless the
+	// project overrides it. Zero keeps them until their events expire.
+	ResolvedGroupDays int
+	// Interval is the time between purges.
+	Interval time.Duration
+	// BatchSize is the maximum number of rows deleted by each statement.
+	BatchSize int
+	// Timeout bounds each purge, the remaining rows are deleted by the next one.
+	Timeout time.Duration
+}
+
+const (
+	DefaultInterval  = time.Hour
+	DefaultBatchSize = 1000
+	DefaultTimeout   = 10 * time.Minute
+)
+
+func (o Options) withDefaults() Options {
+	if o.Interval <= 0 {
+		o.Interval = DefaultInterval
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = DefaultBatchSize
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultTimeout
+	}
+	return o
+}
+
+// Report counts the rows deleted by a purge.
+type Report struct {
+	StartedAt          time.Time `json:"started_at"`
+	DurationMs         int64     `json:"duration_ms"`
+	Events             int64     `json:"events"`
+	EventGroups        int64     `json:"event_groups"`
+	Alerts             int64     `json:"alerts"`
+	AlertNotifications int64     `json:"alert_notifications"`
+	EventPayloads      int64     `json:"event_payloads"`
+	Error              string    `json:"error,omitempty"`
+}
+
+type Retention struct {
+	application app.App
+	options     Options
+	now         func() time.Time
+
+	lock       sync.Mutex
+	lastReport *Report
+}
+
+func New(application app.App, opts Options) *Retention {
+	return &Retention{
+		application: application,
+		options:     opts.withDefaults(),
+		now:         repository.UTCNow,
+	}
+}
+
+// Policy returns the retention that applies to the project, in days.
+func (r *Retention) Policy(retention repository.ProjectRetention) (eventDays, resolvedGroupDays int) {
+	eventDays, resolvedGroupDays = r.options.EventDays, r.options.ResolvedGroupDays
+	if retention.EventDays != nil {
+		eventDays = *retention.EventDays
+	}
+	if retention.ResolvedGroupDays != nil {
+		resolvedGroupDays = *retention.ResolvedGroupDays
+	}
+	return eventDays, resolvedGroupDays
+}
+
+// LastReport returns the report of the most recent purge of the process.
+func (r *Retention) LastReport() (Report, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.lastReport == nil {
+		return Report{}, false
+	}
+	return *r.lastReport, true
+}
+
+// Scheduler purges the expired data each time the interval elapses.
+func (r *Retention) Scheduler(ctx context.Context) func() error {
+	return func() error {
+		ticker := time.NewTicker(r.options.Interval)
+		defer ticker.Stop()
+		logger := r.application.Logger
+
+		logger.Info("retention ticker started", zap.Duration("interval", r.options.Interval))
+
+		for {
+			select {
+			case <-ticker.C:
+				purgeCtx, cancel := context.WithTimeout(ctx, r.options.Timeout)
+				if _, err := r.Purge(purgeCtx); err != nil {
+					logger.Error("retention purge failed", zap.Error(err))
+				}
+				cancel()
+			case <-ctx.Done():
+				logger.Info("retention ticker stopped")
+				return nil
+			}
+		}
+	}
+}
+
+// Purge deletes in batches the expired events of each project, then the groups left without events, and
+// finally the alerts, notifications and raw payloads of the deleted rows.
+func (r *Retention) Purge(ctx context.Context) (Report, error) {
+	report := Report{StartedAt: r.now()}
+	err := r.purge(ctx, &report)
+	report.DurationMs = r.now().Sub(report.StartedAt).Milliseconds()
+	if err != nil {
+		report.Error = err.Error()
+	}
+	r.lock.Lock()
+	r.lastReport = &report
+	r.lock.Unlock()
+
+	r.application.Logger.Info("retention purge completed",
+		zap.Int64("events", report.Events),
+		zap.Int64("event_groups", report.EventGroups),
+		zap.Int64("alerts", report.Alerts),
+		zap.Int64("alert_notifications", report.AlertNotifications),
+		zap.Int64("event_payloads", report.EventPayloads),
+		zap.Int64("duration_ms", report.DurationMs))
+	return report, err
+}
+
+func (r *Retention) purge(ctx context.Context, report *Report) error {
+	repo := r.application.Repository
+	retentions, err := repo.ProjectRetentionList(ctx)
+	if err != nil {
+		return err
+	}
+	now := r.now()
+	for _, retention := range retentions {
+		projectID := retention.ProjectID
+		eventDays, resolvedGroupDays := r.Policy(retention)
+		var receivedBefore, resolvedBefore *time.Time
+		if eventDays > 0 {
+			t := now.AddDate(0, 0, -eventDays)
+			receivedBefore = &t
+			n, err := r.batches(ctx, func(limit int) (int64, error) {
+				return repo.EventsPurge(ctx, projectID, t, limit)
+			})
+			report.Events += n
+			if err != nil {
+				return err
+			}
+		}
+		if resolvedGroupDays > 0 {
+			t := now.AddDate(0, 0, -resolvedGroupDays)
+			resolvedBefore = &t
+			n, err := r.batches(ctx, func(limit int) (int64, error) {
+				return repo.ResolvedEventGroupEventsPurge(ctx, projectID, t, limit)
+			})
+			report.Events += n
+			if err != nil {
+				return err
+			}
+		}
+		n, err := r.batches(ctx, func(limit int) (int64, error) {
+			return repo.EventGroupsPurge(ctx, projectID, receivedBefore, resolvedBefore, limit)
+		})
+		report.EventGroups += n
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := r.batches(ctx, func(limit int) (int64, error) {
+		return repo.AlertsPurgeOrphaned(ctx, limit)
+	})
+	report.Alerts += n
+	if err != nil {
+		return err
+	}
+	n, err = r.batches(ctx, func(limit int) (int64, error) {
+		return repo.AlertDestinationNotificationsPurgeOrphaned(ctx, limit)
+	})
+	report.AlertNotifications += n
+	if err != nil {
+		return err
+	}
+	n, err = r.batches(ctx, func(limit int) (int64, error) {
+		return repo.EventPayloadsPurgeOrphaned(ctx, limit)
+	})
+	report.EventPayloads += n
+	return err
+}
+
+// batches runs the delete statement until it deletes less than a full batch, checking for cancellation
+// between batches, so that concurrent writes are not blocked for long.
+func (r *Retention) batches(ctx context.Context, purge func(limit int) (int64, error)) (int64, error) {
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		n, err := purge(r.options.BatchSize)
+		total += n
+		if err != nil || n < int64(r.options.BatchSize) {
+			return total, err
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package retention
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/georgepsarakis/periscope/app"
+	"github.com/georgepsarakis/periscope/repository"
+	"github.com/georgepsarakis/periscope/repository/rdbms"
+)
+
+func newTestApp(t *testing.T) (app.App, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "periscope.db")), &gorm.Config{
+		Logger: logger.Discard,
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&rdbms.Project{}, &rdbms.ProjectRetention{}, &rdbms.EventGroup{},
+		&rdbms.Event{}, &rdbms.EventPayload{}, &rdbms.Alert{}, &rdbms.AlertDestinationNotification{}))
+	return app.App{Logger: zap.NewNop(), Repository: repository.New(db, zap.NewNop())}, db
+}
+
+func createProject(t *testing.T, db *gorm.DB, name string) rdbms.Project {
+	t.Helper()
+	project := rdbms.Project{Name: name, PublicID: name}
+	require.NoError(t, db.Create(&project).Error)
+	return project
+}
+
+// createGroup stores the events of a new group received at the given times, along with an alert, a
+// notification and the raw payload of each event.
+func createGroup(t *testing.T, db *gorm.DB, project rdbms.Project, key string, receivedAt ...time.Time) rdbms.EventGroup {
+	t.Helper()
+	group := rdbms.EventGroup{
+		ProjectID:       project.ID,
+		AggregationKey:  key,
+		TotalCount:      len(receivedAt),
+		StoredCount:     len(receivedAt),
+		EventReceivedAt: receivedAt[len(receivedAt)-1],
+	}
+	require.NoError(t, db.Create(&group).Error)
+	alert := rdbms.Alert{ProjectID: project.ID, EventGroupID: group.ID, TriggeredAt: receivedAt[0], Title: key}
+	require.NoError(t, db.Create(&alert).Error)
+	require.NoError(t, db.Create(&rdbms.AlertDestinationNotification{AlertID: alert.ID, ProjectAlertDestinationID: 1}).Error)
+	for i, at := range receivedAt {
+		hash := key + "-" + at.Format(time.RFC3339Nano)
+		require.NoError(t, db.Create(&rdbms.EventPayload{Hash: hash, Encoding: "identity", Size: 2, Data: []byte("{}")}).Error)
+		require.NoError(t, db.Create(&rdbms.Event{
+			EventID:      hash,
+			Title:        key,
+			Fingerprint:  key,
+			EventGroupID: group.ID,
+			ProjectID:    project.ID,
+			EmittedAt:    at,
+			ReceivedAt:   at,
+			PayloadHash:  hash,
+		}).Error, "event %d", i)
+	}
+	return group
+}
+
+func count(t *testing.T, db *gorm.DB, model any) int64 {
+	t.Helper()
+	var n int64
+	require.NoError(t, db.Model(model).Count(&n).Error)
+	return n
+}
+
+func TestRetention_Purge(t *testing.T) {
+	application, db := newTestApp(t)
+	ctx := context.Background()
+	now := repository.UTCNow()
+	days := func(n int) time.Time { return now.AddDate(0, 0, -n) }
+
+	project := createProject(t, db, "default")
+	expired := createGroup(t, db, project, "expired", days(40), days(35))
+	partial := createGroup(t, db, project, "partial", days(40), days(1))
+	resolved := createGroup(t, db, project, "resolved", days(10))
+	recentlyResolved := createGroup(t, db, project, "recently-resolved", days(10))
+	require.NoError(t, db.Model(&resolved).Update("resolved_at", days(8)).Error)
+	require.NoError(t, db.Model(&recentlyResolved).Update("resolved_at", days(2)).Error)
+
+	// Keeps its events forever
+	overridden := createProject(t, db, "overridden")
+	kept := createGroup(t, db, overridden, "kept", days(400))
+	_, err := application.Repository.ProjectRetentionUpdate(ctx, repository.ProjectRetention{
+		ProjectID: overridden.ID,
+		EventDays: new(int),
+	})
+	require.NoError(t, err)
+
+	r := New(application, Options{EventDays: 30, ResolvedGroupDays: 7, BatchSize: 1})
+	_, ok := r.LastReport()
+	assert.False(t, ok)
+
+	report, err := r.Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), report.Events)
+	assert.Equal(t, int64(2), report.EventGroups)
+	assert.Equal(t, int64(2), report.Alerts)
+	assert.Equal(t, int64(2), report.AlertNotifications)
+	assert.Equal(t, int64(4), report.EventPayloads)
+	assert.Empty(t, report.Error)
+	last, ok := r.LastReport()
+	require.True(t, ok)
+	assert.Equal(t, report, last)
+
+	var groupIDs []uint
+	require.NoError(t, db.Model(&rdbms.EventGroup{}).Order("id").Pluck("id", &groupIDs).Error)
+	assert.Equal(t, []uint{partial.ID, recentlyResolved.ID, kept.ID}, groupIDs)
+	assert.Equal(t, int64(3), count(t, db, &rdbms.Event{}))
+	assert.Equal(t, int64(3), count(t, db, &rdbms.Alert{}))
+	assert.Equal(t, int64(3), count(t, db, &rdbms.AlertDestinationNotification{}))
+	assert.Equal(t, int64(3), count(t, db, &rdbms.EventPayload{}))
+	var remaining int64
+	require.NoError(t, db.Model(&rdbms.Event{}).Where("event_group_id = ?", expired.ID).Count(&remaining).Error)
+	assert.Zero(t, remaining)
+	// The stored count of groups that are kept follows their purged events
+	require.NoError(t, db.First(&partial, partial.ID).Error)
+	assert.Equal(t, 1, partial.StoredCount)
+	assert.Equal(t, 2, partial.TotalCount)
+
+	// Nothing is left to purge
+	report, err = r.Purge(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, report.Events+report.EventGroups+report.Alerts+report.AlertNotifications+report.EventPayloads)
+}
+
+func TestRetention_Purge_Canceled(t *testing.T) {
+	application, db := newTestApp(t)
+	project := createProject(t, db, "default")
+	createGroup(t, db, project, "expired", repository.UTCNow().AddDate(0, 0, -2))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := New(application, Options{EventDays: 1})
+	report, err := r.Purge(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, context.Canceled.Error(), report.Error)
+	assert.Equal(t, int64(1), count(t, db, &rdbms.Event{}))
+}
+
+func TestRetention_Policy(t *testing.T) {
+	r := New(app.App{}, Options{EventDays: 30, ResolvedGroupDays: 7})
+	zero, days := 0, 90
+	tests := []struct {
+		name              string
+		retention         repository.ProjectRetention
+		eventDays         int
+		resolvedGroupDays int
+	}{
+		{name: "defaults", eventDays: 30, resolvedGroupDays: 7},
+		{name: "overrides", retention: repository.ProjectRetention{EventDays: &days, ResolvedGroupDays: &zero},
+			eventDays: 90, resolvedGroupDays: 0},
+		{name: "partial override", retention: repository.ProjectRetention{EventDays: &zero},
+			eventDays: 0, resolvedGroupDays: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eventDays, resolvedGroupDays := r.Policy(tt.retention)
+			assert.Equal(t, tt.eventDays, eventDays)
+			assert.Equal(t, tt.resolvedGroupDays, resolvedGroupDays)
+		})
+	}
+}
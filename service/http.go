@@ -20,6 +20,7 @@ import (
 	"github.com/georgepsarakis/periscope/ingestion"
 	"github.com/georgepsarakis/periscope/newcontext"
 	"github.com/georgepsarakis/periscope/repository"
+	"github.com/georgepsarakis/periscope/retention"
 )
 
 type OnShutdownErrorFunc func(error)
@@ -43,29 +44,105 @@ func NewHTTPService(opts Options) (*periscopeHttp.Server, CleanupFunc, OnShutdow
 	ctx := newcontext.WithLogger(context.Background(), application.Logger)
 	ctx, cancel := context.WithCancel(ctx)
 
-	aggr := ingestion.NewAggregator(application.Logger)
-	if err := aggr.Subscribe(ctx); err != nil {
-		application.Logger.Fatal("aggregator subscribe failed", zap.Error(err))
+	application.Logger.Info("starting process", zap.Strings("roles", application.Roles()))
+	runsIngest, runsWorker := application.HasRole(app.RoleIngest), application.HasRole(app.RoleWorker)
+	if runsIngest != runsWorker && application.IngestionQueueDriver() != ingestion.QueueDriverDatabase {
+		application.Logger.Fatal("running the ingest and worker roles in separate processes requires the database ingestion queue",
+			zap.Strings("roles", application.Roles()),
+			zap.String("driver", application.IngestionQueueDriver()))
 	}
 
+	var queue ingestion.Queue
+	switch application.IngestionQueueDriver() {
+	case ingestion.QueueDriverMemory:
+	case ingestion.QueueDriverDatabase:
+		queue = ingestion.NewDatabaseQueue(application.Repository, application.Logger, ingestion.DatabaseQueueOptions{
+			LeaseDuration: application.IngestionQueueLeaseDuration(),
+			PollInterval:  application.IngestionQueuePollInterval(),
+		})
+	default:
+		application.Logger.Fatal("unsupported ingestion queue driver",
+			zap.String("driver", application.IngestionQueueDriver()))
+	}
+	aggr := ingestion.NewAggregator(application.Logger, application.Repository, ingestion.AggregatorOptions{
+		MaxFutureSkew:              application.EventMaxFutureSkew(),
+		MaxEventAge:                application.EventMaxAge(),
+		DeduplicationWindow:        application.EventDeduplicationWindow(),
+		Queue:                      queue,
+		MaxPendingEvents:           application.IngestionMaxPendingEvents(),
+		MaxPendingEventsPerProject: application.IngestionMaxPendingEventsPerProject(),
+		Consumers:                  application.IngestionConsumers(),
+		FlushMaxEvents:             application.PersistenceFlushMaxEvents(),
+		FlushMaxGroupEvents:        application.PersistenceFlushMaxGroupEvents(),
+		DeadLetters:                application.Repository,
+		RetryMaxAttempts:           application.PersistenceRetryMaxAttempts(),
+		RetryBackoff:               application.PersistenceRetryBackoff(),
+		RetryMaxBackoff:            application.PersistenceRetryMaxBackoff(),
+	})
+	if runsWorker {
+		if err := aggr.Subscribe(ctx); err != nil {
+			application.Logger.Fatal("aggregator subscribe failed", zap.Error(err))
+		}
+	}
+
+	quotas := ingestion.NewQuotas(application.Logger, application.Repository, application.ProjectUsageFlushInterval())
+	filters := ingestion.NewInboundFilters(application.Logger, application.Repository, application.ProjectUsageFlushInterval())
+
 	grp, ctx := errgroup.WithContext(ctx)
-	grp.Go(aggr.Consumer(ctx))
 	grp.Go(httpServer.ShutdownHandler(!opts.OSSignalListenerDisabled, func() error {
 		application.Logger.Info("running shutdown callback")
 		cancel()
 		return nil
 	}))
-	grp.Go(ingestion.NewPersistence(application, time.Second, aggr).Scheduler(ctx))
-	grp.Go(alerting.NewAlerting(application, time.Second).Scheduler(ctx))
-	httpServer.OnShutdown(grp.Wait)
+	if runsIngest {
+		grp.Go(quotas.Scheduler(ctx))
+		grp.Go(filters.Scheduler(ctx))
+	}
+	if runsWorker {
+		grp.Go(aggr.Consumer(ctx))
+		grp.Go(ingestion.NewPersistence(application, aggr, ingestion.PersistenceOptions{
+			Interval:     application.PersistenceFlushInterval(),
+			Timeout:      application.PersistenceFlushTimeout(),
+			DrainTimeout: application.PersistenceDrainTimeout(),
+		}).Scheduler(ctx))
+	}
+	purger := retention.New(application, retention.Options{
+		EventDays:         application.RetentionEventDays(),
+		ResolvedGroupDays: application.RetentionResolvedGroupDays(),
+		Interval:          application.RetentionPurgeInterval(),
+		BatchSize:         application.RetentionPurgeBatchSize(),
+		Timeout:           application.RetentionPurgeTimeout(),
+	})
+	if runsWorker {
+		grp.Go(purger.Scheduler(ctx))
+	}
+	if application.HasRole(app.RoleAlerting) {
+		grp.Go(alerting.NewAlerting(application, time.Second).Scheduler(ctx))
+	}
+	httpServer.OnShutdown(func() error {
+		// The queue is closed after the final flush, so that persisted events are acknowledged
+		return errors.Join(grp.Wait(), aggr.Close())
+	})
 
-	eventHandler := periscopeHttp.NewEventHandler(application, aggr)
+	eventHandler := periscopeHttp.NewEventHandler(application, aggr, quotas, filters)
 	adtHandler := periscopeHttp.NewAlertDestinationHandler(application)
 
 	r := periscopeHttp.NewRouter(application)
-	r.Post("/api/{project_id}/envelope", eventHandler.IngestionHandler())
+	if runsIngest {
+		r.Post("/api/{project_id}/envelope", eventHandler.IngestionHandler())
+		r.Post("/api/{project_id}/store", eventHandler.StoreHandler())
+	}
 	prjHandler := periscopeHttp.NewProjectHandler(application)
 	alertHandler := periscopeHttp.NewAlertHandler(application)
+	projectEventHandler := periscopeHttp.NewProjectEventHandler(application)
+	fingerprintRuleHandler := periscopeHttp.NewFingerprintRuleHandler(application)
+	ingestionStatsHandler := periscopeHttp.NewIngestionStatsHandler(application, aggr)
+	projectLimitsHandler := periscopeHttp.NewProjectLimitsHandler(application)
+	inboundFilterHandler := periscopeHttp.NewInboundFilterHandler(application)
+	deadLetterHandler := periscopeHttp.NewDeadLetterHandler(application, aggr)
+	eventGroupHandler := periscopeHttp.NewEventGroupHandler(application)
+	retentionHandler := periscopeHttp.NewRetentionHandler(application, purger)
+	// The administration API is served by every process
 	r.Route("/api/admin", func(r chi.Router) {
 		apiKeyOpts := apikey.Options{
 			SecretProvider: &apikey.EnvironmentSecretProvider{
@@ -76,6 +153,8 @@ func NewHTTPService(opts Options) (*periscopeHttp.Server, CleanupFunc, OnShutdow
 		r.Use(apikey.Authorize(apiKeyOpts))
 		r.Post("/projects", prjHandler.Create)
 		r.Get("/projects/{id}", prjHandler.Read)
+		r.Get("/ingestion/stats", ingestionStatsHandler.Read)
+		r.Get("/retention/report", retentionHandler.Report)
 		r.Group(func(r chi.Router) {
 			r.Use(func(next http.Handler) http.Handler {
 				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -102,7 +181,26 @@ func NewHTTPService(opts Options) (*periscopeHttp.Server, CleanupFunc, OnShutdow
 				})
 			})
 			r.Get("/projects/{project_id}/alerts", alertHandler.List)
+			r.Get("/projects/{project_id}/events/{event_id}", projectEventHandler.Read)
 			r.Post("/projects/{project_id}/alert_notification_destinations", adtHandler.Create)
+			r.Get("/projects/{project_id}/fingerprint_rules", fingerprintRuleHandler.List)
+			r.Post("/projects/{project_id}/fingerprint_rules", fingerprintRuleHandler.Create)
+			r.Delete("/projects/{project_id}/fingerprint_rules/{id}", fingerprintRuleHandler.Delete)
+			r.Get("/projects/{project_id}/limits", projectLimitsHandler.Read)
+			r.Put("/projects/{project_id}/limits", projectLimitsHandler.Update)
+			r.Get("/projects/{project_id}/usage", projectLimitsHandler.Usage)
+			r.Get("/projects/{project_id}/inbound_filters", inboundFilterHandler.List)
+			r.Post("/projects/{project_id}/inbound_filters", inboundFilterHandler.Create)
+			r.Delete("/projects/{project_id}/inbound_filters/{id}", inboundFilterHandler.Delete)
+			r.Get("/projects/{project_id}/dead_letters", deadLetterHandler.List)
+			r.Delete("/projects/{project_id}/dead_letters", deadLetterHandler.Purge)
+			r.Get("/projects/{project_id}/dead_letters/{id}", deadLetterHandler.Read)
+			r.Post("/projects/{project_id}/dead_letters/{id}/replay", deadLetterHandler.Replay)
+			r.Delete("/projects/{project_id}/dead_letters/{id}", deadLetterHandler.Delete)
+			r.Get("/projects/{project_id}/event_groups/{id}", eventGroupHandler.Read)
+			r.Patch("/projects/{project_id}/event_groups/{id}", eventGroupHandler.Update)
+			r.Get("/projects/{project_id}/retention", retentionHandler.Read)
+			r.Put("/projects/{project_id}/retention", retentionHandler.Update)
 		})
 	})
 	httpServer.SetHandler(r)
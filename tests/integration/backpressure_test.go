@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/georgepsarakis/go-httpclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	periscopeHttp "github.com/georgepsarakis/periscope/http"
+	"github.com/georgepsarakis/periscope/repository"
+)
+
+func TestEventForwarding_Backpressure(t *testing.T) {
+	t.Setenv("API_SECRET_KEY_ADMIN",
+		repository.RandomString(repository.CharsetAlphanumeric, 10))
+	t.Setenv("INGESTION_QUEUE_DRIVER", "database")
+	t.Setenv("INGESTION_MAX_PENDING_EVENTS_PER_PROJECT", "1")
+	t.Setenv("INGESTION_BACKPRESSURE_RETRY_AFTER", "30s")
+	// Without a worker, accepted events remain pending
+	t.Setenv("PERISCOPE_ROLES", "ingest")
+	s := startTestServer(t, newSQLitePath(t))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	p := s.createProject(ctx, t, "backpressure project")
+
+	send := func(eventID string) *http.Response {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			fmt.Sprintf("http://%s/api/%s/store/", s.server.Address(), p.PublicID),
+			strings.NewReader(fmt.Sprintf(`{"event_id": %q, "message": "disk full"}`, eventID)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Sentry-Auth", fmt.Sprintf(
+			"Sentry sentry_version=7, sentry_client=sentry.python/2.0.0, sentry_key=%s", p.IngestionAPIKeys[0]))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp
+	}
+	require.Equal(t, http.StatusOK, send("0f8fad5bd9cb469fa16570867728950e").StatusCode)
+
+	// The depth of the shared queue is refreshed periodically
+	time.Sleep(1500 * time.Millisecond)
+	resp := send("7c9e6679742540de944be07fc1f90ae7")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "30", resp.Header.Get("Retry-After"))
+	assert.Equal(t, "30::project:backpressure", resp.Header.Get("X-Sentry-Rate-Limits"))
+
+	statsResp, err := s.adminAPIClient.Get(ctx, "ingestion/stats")
+	require.NoError(t, err)
+	stats := periscopeHttp.IngestionStatsResponse{}
+	require.NoError(t, httpclient.DeserializeJSON(statsResp, &stats))
+	assert.Equal(t, 1, stats.Stats.Pending.Total)
+	assert.Equal(t, map[uint]int{p.ID: 1}, stats.Stats.Pending.Projects)
+	assert.Equal(t, 1, stats.Stats.MaxPendingEventsPerProject)
+}
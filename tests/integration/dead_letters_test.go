@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/georgepsarakis/go-httpclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	periscopeHttp "github.com/georgepsarakis/periscope/http"
+	"github.com/georgepsarakis/periscope/repository"
+	"github.com/georgepsarakis/periscope/repository/rdbms"
+)
+
+func TestDeadLetters(t *testing.T) {
+	t.Setenv("API_SECRET_KEY_ADMIN",
+		repository.RandomString(repository.CharsetAlphanumeric, 10))
+	sqlitePath := newSQLitePath(t)
+	s := startTestServer(t, sqlitePath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	p := s.createProject(ctx, t, "dead letters project")
+	db, err := gorm.Open(sqlite.Open(sqlitePath), &gorm.Config{})
+	require.NoError(t, err)
+	eventID := "0f8fad5bd9cb469fa16570867728950e"
+	replayable := rdbms.DeadLetterEvent{
+		ProjectID: p.ID,
+		EventID:   eventID,
+		Stage:     repository.DeadLetterStagePersist,
+		Error:     "database is locked",
+		Attempts:  5,
+		Payload: []byte(fmt.Sprintf(`{"project_id": %d, "event": {"event_id": %q, "message": "disk full"}, "received_at": %q}`,
+			p.ID, eventID, time.Now().UTC().Format(time.RFC3339))),
+	}
+	malformed := rdbms.DeadLetterEvent{
+		ProjectID: p.ID,
+		Stage:     repository.DeadLetterStageDecode,
+		Error:     "unexpected end of JSON input",
+		Attempts:  1,
+		Payload:   []byte(`{"project_id": `),
+	}
+	require.NoError(t, db.Create(&replayable).Error)
+	require.NoError(t, db.Create(&malformed).Error)
+
+	resp, err := s.adminAPIClient.Get(ctx, fmt.Sprintf("projects/%d/dead_letters", p.ID))
+	require.NoError(t, err)
+	list := periscopeHttp.DeadLetterListResponse{}
+	require.NoError(t, httpclient.DeserializeJSON(resp, &list))
+	require.Len(t, list.DeadLetters, 2)
+	assert.Equal(t, malformed.ID, list.DeadLetters[0].ID)
+	assert.Equal(t, repository.DeadLetterStageDecode, list.DeadLetters[0].Stage)
+	assert.Empty(t, list.DeadLetters[0].Payload)
+
+	resp, err = s.adminAPIClient.Get(ctx, fmt.Sprintf("projects/%d/dead_letters/%d", p.ID, replayable.ID))
+	require.NoError(t, err)
+	deadLetter := repository.DeadLetterEvent{}
+	require.NoError(t, httpclient.DeserializeJSON(resp, &deadLetter))
+	assert.Equal(t, eventID, deadLetter.EventID)
+	assert.Equal(t, "database is locked", deadLetter.Error)
+	assert.Equal(t, 5, deadLetter.Attempts)
+	assert.Equal(t, string(replayable.Payload), deadLetter.Payload)
+
+	resp, err = s.adminAPIClient.Post(ctx, fmt.Sprintf("projects/%d/dead_letters/%d/replay", p.ID, malformed.ID), strings.NewReader(""))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	resp, err = s.adminAPIClient.Post(ctx, fmt.Sprintf("projects/%d/dead_letters/%d/replay", p.ID, replayable.ID), strings.NewReader(""))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	time.Sleep(2 * time.Second)
+	ev := s.readEvent(ctx, t, p.ID, eventID)
+	assert.Equal(t, eventID, ev.EventID)
+
+	resp, err = s.adminAPIClient.Get(ctx, fmt.Sprintf("projects/%d/dead_letters/%d", p.ID, replayable.ID))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = s.adminAPIClient.Delete(ctx, fmt.Sprintf("projects/%d/dead_letters", p.ID))
+	require.NoError(t, err)
+	purge := periscopeHttp.DeadLetterPurgeResponse{}
+	require.NoError(t, httpclient.DeserializeJSON(resp, &purge))
+	assert.Equal(t, 1, purge.Purged)
+
+	resp, err = s.adminAPIClient.Delete(ctx, fmt.Sprintf("projects/%d/dead_letters/%d", p.ID, malformed.ID))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestDeadLetters_ReplayWithoutWorker(t *testing.T) {
+	t.Setenv("API_SECRET_KEY_ADMIN",
+		repository.RandomString(repository.CharsetAlphanumeric, 10))
+	t.Setenv("PERISCOPE_ROLES", "alerting")
+	sqlitePath := newSQLitePath(t)
+	s := startTestServer(t, sqlitePath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	p := s.createProject(ctx, t, "dead letters project")
+	db, err := gorm.Open(sqlite.Open(sqlitePath), &gorm.Config{})
+	require.NoError(t, err)
+	deadLetter := rdbms.DeadLetterEvent{
+		ProjectID: p.ID,
+		EventID:   "0f8fad5bd9cb469fa16570867728950e",
+		Stage:     repository.DeadLetterStagePersist,
+		Error:     "database is locked",
+		Attempts:  5,
+		Payload: []byte(fmt.Sprintf(`{"project_id": %d, "event": {"event_id": "0f8fad5bd9cb469fa16570867728950e"}}`,
+			p.ID)),
+	}
+	require.NoError(t, db.Create(&deadLetter).Error)
+
+	// Nothing consumes the in-memory queue of this process, so the dead letter is kept
+	resp, err := s.adminAPIClient.Post(ctx, fmt.Sprintf("projects/%d/dead_letters/%d/replay", p.ID, deadLetter.ID), strings.NewReader(""))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	resp, err = s.adminAPIClient.Get(ctx, fmt.Sprintf("projects/%d/dead_letters/%d", p.ID, deadLetter.ID))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventForwarding_DatabaseQueue(t *testing.T) {
+	t.Setenv("INGESTION_QUEUE_DRIVER", "database")
+	t.Setenv("INGESTION_QUEUE_POLL_INTERVAL", "50ms")
+	s := newTestServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	p := s.createProject(ctx, t, "durable project")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("http://%s/api/%s/store/", s.server.Address(), p.PublicID),
+		strings.NewReader(`{
+			"event_id": "5d1e5c7ab3b04fd2bd1a1bfcb9ea7a59",
+			"level": "error",
+			"exception": [{"type": "KeyError", "value": "'order_id'"}]
+		}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf(
+		"Sentry sentry_version=7, sentry_client=sentry.python/2.0.0, sentry_key=%s", p.IngestionAPIKeys[0]))
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	time.Sleep(2 * time.Second)
+	ev := s.readEvent(ctx, t, p.ID, "5d1e5c7ab3b04fd2bd1a1bfcb9ea7a59")
+	assert.Equal(t, "'order_id'", ev.Title)
+}
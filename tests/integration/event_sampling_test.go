@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/georgepsarakis/periscope/repository"
+	"github.com/georgepsarakis/periscope/repository/rdbms"
+)
+
+func TestEventForwarding_Sampling(t *testing.T) {
+	t.Setenv("API_SECRET_KEY_ADMIN",
+		repository.RandomString(repository.CharsetAlphanumeric, 10))
+	t.Setenv("EVENT_SAMPLING_KEEP_FIRST", "2")
+	t.Setenv("EVENT_SAMPLING_RATE", "2")
+	sqlitePath := newSQLitePath(t)
+	s := startTestServer(t, sqlitePath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	p := s.createProject(ctx, t, "sampled project")
+
+	eventIDs := make([]string, 6)
+	for n := range eventIDs {
+		eventIDs[n] = fmt.Sprintf("%032x", n+1)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			fmt.Sprintf("http://%s/api/%s/store/", s.server.Address(), p.PublicID),
+			strings.NewReader(fmt.Sprintf(`{"event_id": %q, "fingerprint": ["sampled"], "message": "disk full"}`, eventIDs[n])))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Sentry-Auth", fmt.Sprintf(
+			"Sentry sentry_version=7, sentry_client=sentry.python/2.0.0, sentry_key=%s", p.IngestionAPIKeys[0]))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	time.Sleep(2 * time.Second)
+	// The first two events are stored, then one in two
+	for n, eventID := range eventIDs {
+		resp, err := s.adminAPIClient.Get(ctx, fmt.Sprintf("projects/%d/events/%s", p.ID, eventID))
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		if n == 3 || n == 5 {
+			assert.Equal(t, http.StatusNotFound, resp.StatusCode, "event %d", n)
+		} else {
+			assert.Equal(t, http.StatusOK, resp.StatusCode, "event %d", n)
+		}
+	}
+
+	db, err := gorm.Open(sqlite.Open(sqlitePath), &gorm.Config{})
+	require.NoError(t, err)
+	var group rdbms.EventGroup
+	require.NoError(t, db.Where("project_id = ?", p.ID).First(&group).Error)
+	assert.Equal(t, 6, group.TotalCount)
+	assert.Equal(t, 4, group.StoredCount)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/georgepsarakis/go-httpclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	periscopeHttp "github.com/georgepsarakis/periscope/http"
+	"github.com/georgepsarakis/periscope/repository"
+)
+
+func TestEventForwarding_InboundFilters(t *testing.T) {
+	t.Setenv("PROJECT_USAGE_FLUSH_INTERVAL", "100ms")
+	s := newTestServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	p := s.createProject(ctx, t, "filtered project")
+	resp, err := s.adminAPIClient.Post(ctx, fmt.Sprintf("projects/%d/inbound_filters", p.ID),
+		strings.NewReader(`{"type": "environment", "pattern": "staging"}`))
+	require.NoError(t, err)
+	filter := repository.InboundFilter{}
+	require.NoError(t, httpclient.DeserializeJSON(resp, &filter))
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, err = s.adminAPIClient.Post(ctx, fmt.Sprintf("projects/%d/inbound_filters", p.ID),
+		strings.NewReader(`{"type": "message", "pattern": "("}`))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	send := func(eventID, environment string) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			fmt.Sprintf("http://%s/api/%s/store/", s.server.Address(), p.PublicID),
+			strings.NewReader(fmt.Sprintf(`{"event_id": %q, "environment": %q, "message": "disk full"}`, eventID, environment)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Sentry-Auth", fmt.Sprintf(
+			"Sentry sentry_version=7, sentry_client=sentry.python/2.0.0, sentry_key=%s", p.IngestionAPIKeys[0]))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		// Filtered events are acknowledged, so that clients do not retry them
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	send("0f8fad5bd9cb469fa16570867728950e", "staging")
+	send("7c9e6679742540de944be07fc1f90ae7", "production")
+
+	time.Sleep(2 * time.Second)
+	ev := s.readEvent(ctx, t, p.ID, "7c9e6679742540de944be07fc1f90ae7")
+	assert.Equal(t, "production", ev.Environment)
+	resp, err = s.adminAPIClient.Get(ctx, fmt.Sprintf("projects/%d/events/%s", p.ID, "0f8fad5bd9cb469fa16570867728950e"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = s.adminAPIClient.Get(ctx, fmt.Sprintf("projects/%d/inbound_filters", p.ID))
+	require.NoError(t, err)
+	filters := periscopeHttp.InboundFilterListResponse{}
+	require.NoError(t, httpclient.DeserializeJSON(resp, &filters))
+	require.Len(t, filters.Filters, 1)
+	assert.Equal(t, filter.ID, filters.Filters[0].ID)
+	assert.Equal(t, 1, filters.Filters[0].FilteredCount)
+	assert.NotNil(t, filters.Filters[0].LastFilteredAt)
+
+	resp, err = s.adminAPIClient.Get(ctx, fmt.Sprintf("projects/%d/usage", p.ID))
+	require.NoError(t, err)
+	usage := periscopeHttp.ProjectUsageResponse{}
+	require.NoError(t, httpclient.DeserializeJSON(resp, &usage))
+	require.Len(t, usage.Usage, 1)
+	assert.Equal(t, 1, usage.Usage[0].Accepted)
+	assert.Equal(t, 1, usage.Usage[0].Filtered)
+
+	resp, err = s.adminAPIClient.Delete(ctx, fmt.Sprintf("projects/%d/inbound_filters/%d", p.ID, filter.ID))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/georgepsarakis/go-httpclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	periscopeHttp "github.com/georgepsarakis/periscope/http"
+	"github.com/georgepsarakis/periscope/ingestion"
+	"github.com/georgepsarakis/periscope/repository"
+)
+
+func TestEventForwarding_GroupSizeFlush(t *testing.T) {
+	t.Setenv("API_SECRET_KEY_ADMIN",
+		repository.RandomString(repository.CharsetAlphanumeric, 10))
+	// Only the group threshold can trigger the flush within the test
+	t.Setenv("PERSISTENCE_FLUSH_INTERVAL", "1h")
+	t.Setenv("PERSISTENCE_FLUSH_MAX_GROUP_EVENTS", "3")
+	s := startTestServer(t, newSQLitePath(t))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	p := s.createProject(ctx, t, "flushed project")
+	eventIDs := []string{
+		"0f8fad5bd9cb469fa16570867728950e",
+		"7c9e6679742540de944be07fc1f90ae7",
+		"9a2f1ad0c2e84d5a8c7d6e1f2a3b4c5d",
+	}
+	for _, eventID := range eventIDs {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			fmt.Sprintf("http://%s/api/%s/store/", s.server.Address(), p.PublicID),
+			strings.NewReader(fmt.Sprintf(`{"event_id": %q, "message": "disk full"}`, eventID)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Sentry-Auth", fmt.Sprintf(
+			"Sentry sentry_version=7, sentry_client=sentry.python/2.0.0, sentry_key=%s", p.IngestionAPIKeys[0]))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	require.Eventually(t, func() bool {
+		resp, err := s.adminAPIClient.Get(ctx, fmt.Sprintf("projects/%d/events/%s", p.ID, eventIDs[2]))
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode == http.StatusOK
+	}, 10*time.Second, 100*time.Millisecond)
+
+	statsResp, err := s.adminAPIClient.Get(ctx, "ingestion/stats")
+	require.NoError(t, err)
+	stats := periscopeHttp.IngestionStatsResponse{}
+	require.NoError(t, httpclient.DeserializeJSON(statsResp, &stats))
+	// Events still processed by a consumer are flushed separately
+	assert.GreaterOrEqual(t, stats.Stats.Flush.Flushes[ingestion.FlushTriggerSize], 1)
+	assert.Zero(t, stats.Stats.Flush.Flushes[ingestion.FlushTriggerInterval])
+	assert.Equal(t, 3, stats.Stats.Flush.Events)
+	assert.Equal(t, 1, stats.Stats.Flush.LastBatchGroups)
+	assert.NotNil(t, stats.Stats.Flush.LastFlushedAt)
+}
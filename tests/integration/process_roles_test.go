@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/georgepsarakis/periscope/repository"
+)
+
+func TestEventForwarding_SeparateProcessRoles(t *testing.T) {
+	t.Setenv("API_SECRET_KEY_ADMIN",
+		repository.RandomString(repository.CharsetAlphanumeric, 10))
+	t.Setenv("INGESTION_QUEUE_DRIVER", "database")
+	t.Setenv("INGESTION_QUEUE_POLL_INTERVAL", "50ms")
+	sqlitePath := newSQLitePath(t)
+
+	t.Setenv("PERISCOPE_ROLES", "ingest")
+	ingest := startTestServer(t, sqlitePath)
+	t.Setenv("PORT", "8001")
+	t.Setenv("PERISCOPE_ROLES", "worker,alerting")
+	worker := startTestServer(t, sqlitePath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	p := ingest.createProject(ctx, t, "roles project")
+
+	send := func(s testServer) int {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			fmt.Sprintf("http://%s/api/%s/store/", s.server.Address(), p.PublicID),
+			strings.NewReader(`{"event_id": "0f8fad5bd9cb469fa16570867728950e", "message": "disk full"}`))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Sentry-Auth", fmt.Sprintf(
+			"Sentry sentry_version=7, sentry_client=sentry.python/2.0.0, sentry_key=%s", p.IngestionAPIKeys[0]))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+	// Only the ingest process serves the ingestion endpoints
+	assert.Equal(t, http.StatusNotFound, send(worker))
+	require.Equal(t, http.StatusOK, send(ingest))
+
+	time.Sleep(2 * time.Second)
+	ev := worker.readEvent(ctx, t, p.ID, "0f8fad5bd9cb469fa16570867728950e")
+	assert.Equal(t, "disk full", ev.Title)
+	assert.NotEmpty(t, worker.listAlerts(ctx, t, p.ID).Alerts)
+}
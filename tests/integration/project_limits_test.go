@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/georgepsarakis/go-httpclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	periscopeHttp "github.com/georgepsarakis/periscope/http"
+)
+
+func TestEventForwarding_ProjectRateLimit(t *testing.T) {
+	t.Setenv("PROJECT_USAGE_FLUSH_INTERVAL", "100ms")
+	s := newTestServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	p := s.createProject(ctx, t, "rate limited project")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut,
+		fmt.Sprintf("%sprojects/%d/limits", s.adminAPIClient.BaseURL(), p.ID),
+		strings.NewReader(`{"events_per_minute": 1, "daily_quota": 100}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", os.Getenv("API_SECRET_KEY_ADMIN")))
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	limits := periscopeHttp.ProjectLimitsResponse{}
+	require.NoError(t, httpclient.DeserializeJSON(resp, &limits))
+	assert.Equal(t, 1, limits.Limits.EventsPerMinute)
+	assert.Equal(t, 100, limits.Limits.DailyQuota)
+
+	send := func(eventID string) *http.Response {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			fmt.Sprintf("http://%s/api/%s/store/", s.server.Address(), p.PublicID),
+			strings.NewReader(fmt.Sprintf(`{"event_id": %q, "message": "disk full"}`, eventID)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Sentry-Auth", fmt.Sprintf(
+			"Sentry sentry_version=7, sentry_client=sentry.python/2.0.0, sentry_key=%s", p.IngestionAPIKeys[0]))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp
+	}
+	require.Equal(t, http.StatusOK, send("0f8fad5bd9cb469fa16570867728950e").StatusCode)
+	resp = send("7c9e6679742540de944be07fc1f90ae7")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+	assert.Regexp(t, `^\d+:error:project:rate_limited$`, resp.Header.Get("X-Sentry-Rate-Limits"))
+
+	time.Sleep(500 * time.Millisecond)
+	resp, err = s.adminAPIClient.Get(ctx, fmt.Sprintf("projects/%d/usage", p.ID))
+	require.NoError(t, err)
+	usage := periscopeHttp.ProjectUsageResponse{}
+	require.NoError(t, httpclient.DeserializeJSON(resp, &usage))
+	require.Len(t, usage.Usage, 1)
+	assert.Equal(t, 1, usage.Usage[0].Accepted)
+	assert.Equal(t, 1, usage.Usage[0].RateLimited)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/georgepsarakis/go-httpclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	periscopeHttp "github.com/georgepsarakis/periscope/http"
+	"github.com/georgepsarakis/periscope/repository"
+	"github.com/georgepsarakis/periscope/repository/rdbms"
+)
+
+func TestRetention(t *testing.T) {
+	t.Setenv("API_SECRET_KEY_ADMIN",
+		repository.RandomString(repository.CharsetAlphanumeric, 10))
+	t.Setenv("RETENTION_EVENT_DAYS", "30")
+	t.Setenv("RETENTION_PURGE_INTERVAL", "200ms")
+	sqlitePath := newSQLitePath(t)
+	s := startTestServer(t, sqlitePath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	p := s.createProject(ctx, t, "retention project")
+	send := func(eventID string) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			fmt.Sprintf("http://%s/api/%s/store/", s.server.Address(), p.PublicID),
+			strings.NewReader(fmt.Sprintf(`{"event_id": %q, "message": "disk full"}`, eventID)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Sentry-Auth", fmt.Sprintf(
+			"Sentry sentry_version=7, sentry_client=sentry.python/2.0.0, sentry_key=%s", p.IngestionAPIKeys[0]))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	do := func(method, path, body string) *http.Response {
+		req, err := http.NewRequestWithContext(ctx, method, s.adminAPIClient.BaseURL()+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", os.Getenv("API_SECRET_KEY_ADMIN")))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+	resolve := func(groupID uint, resolved bool) repository.EventGroup {
+		resp := do(http.MethodPatch, fmt.Sprintf("projects/%d/event_groups/%d", p.ID, groupID),
+			fmt.Sprintf(`{"resolved": %t}`, resolved))
+		group := periscopeHttp.EventGroupResponse{}
+		require.NoError(t, httpclient.DeserializeJSON(resp, &group))
+		return group.EventGroup
+	}
+
+	send("0f8fad5bd9cb469fa16570867728950e")
+	time.Sleep(2 * time.Second)
+	groupID := s.readEvent(ctx, t, p.ID, "0f8fad5bd9cb469fa16570867728950e").EventGroupID
+	require.NotZero(t, groupID)
+
+	group := resolve(groupID, true)
+	assert.NotNil(t, group.ResolvedAt)
+
+	// New events reopen the group
+	send("7c9e6679742540de944be07fc1f90ae7")
+	time.Sleep(2 * time.Second)
+	resp, err := s.adminAPIClient.Get(ctx, fmt.Sprintf("projects/%d/event_groups/%d", p.ID, groupID))
+	require.NoError(t, err)
+	read := periscopeHttp.EventGroupResponse{}
+	require.NoError(t, httpclient.DeserializeJSON(resp, &read))
+	assert.Nil(t, read.EventGroup.ResolvedAt)
+	assert.Equal(t, 2, read.EventGroup.TotalCount)
+
+	resp = do(http.MethodPatch, fmt.Sprintf("projects/%d/event_groups/%d", p.ID, groupID), `{}`)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = do(http.MethodPatch, fmt.Sprintf("projects/%d/event_groups/%d", p.ID, groupID+1), `{"resolved": true}`)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = do(http.MethodPut, fmt.Sprintf("projects/%d/retention", p.ID), `{"event_days": -1}`)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = do(http.MethodPut, fmt.Sprintf("projects/%d/retention", p.ID), `{"resolved_group_days": 1}`)
+	retention := periscopeHttp.ProjectRetentionResponse{}
+	require.NoError(t, httpclient.DeserializeJSON(resp, &retention))
+	assert.Nil(t, retention.Retention.EventDays)
+	require.NotNil(t, retention.Retention.ResolvedGroupDays)
+	assert.Equal(t, periscopeHttp.EffectiveRetention{EventDays: 30, ResolvedGroupDays: 1}, retention.Effective)
+
+	resp, err = s.adminAPIClient.Get(ctx, fmt.Sprintf("projects/%d/retention", p.ID))
+	require.NoError(t, err)
+	retention = periscopeHttp.ProjectRetentionResponse{}
+	require.NoError(t, httpclient.DeserializeJSON(resp, &retention))
+	assert.Equal(t, periscopeHttp.EffectiveRetention{EventDays: 30, ResolvedGroupDays: 1}, retention.Effective)
+
+	// Resolved two days ago, the group and its events expire on the next purge
+	resolve(groupID, true)
+	db, err := gorm.Open(sqlite.Open(sqlitePath+"?_busy_timeout=5000"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Model(&rdbms.EventGroup{}).Where("id = ?", groupID).
+		Update("resolved_at", time.Now().UTC().AddDate(0, 0, -2)).Error)
+	time.Sleep(time.Second)
+
+	resp, err = s.adminAPIClient.Get(ctx, fmt.Sprintf("projects/%d/event_groups/%d", p.ID, groupID))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	var events int64
+	require.NoError(t, db.Model(&rdbms.Event{}).Where("event_group_id = ?", groupID).Count(&events).Error)
+	assert.Zero(t, events)
+
+	resp, err = s.adminAPIClient.Get(ctx, "retention/report")
+	require.NoError(t, err)
+	report := periscopeHttp.RetentionReportResponse{}
+	require.NoError(t, httpclient.DeserializeJSON(resp, &report))
+	require.NotNil(t, report.LastPurge)
+	assert.Empty(t, report.LastPurge.Error)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/georgepsarakis/go-httpclient"
+	"github.com/stretchr/testify/require"
+
+	periscopeHttp "github.com/georgepsarakis/periscope/http"
+	"github.com/georgepsarakis/periscope/repository"
+	"github.com/georgepsarakis/periscope/service"
+)
+
+type testServer struct {
+	server         *periscopeHttp.Server
+	adminAPIClient *httpclient.Client
+}
+
+// newTestServer starts a Periscope server backed by a temporary SQLite database.
+func newTestServer(t *testing.T) testServer {
+	t.Helper()
+	t.Setenv("API_SECRET_KEY_ADMIN",
+		repository.RandomString(repository.CharsetAlphanumeric, 10))
+	return startTestServer(t, newSQLitePath(t))
+}
+
+func newSQLitePath(t *testing.T) string {
+	t.Helper()
+	tempFile, err := os.CreateTemp("", "tmp-*.db")
+	require.NoError(t, err)
+	tempFilePath := tempFile.Name()
+	t.Logf("using temporary file %q for SQLite", tempFilePath)
+	t.Cleanup(func() {
+		os.Remove(tempFilePath) //nolint:errcheck
+	})
+	return tempFilePath
+}
+
+// startTestServer starts a Periscope server using the given SQLite database, which can be shared by
+// multiple servers with different roles.
+func startTestServer(t *testing.T, sqlitePath string) testServer {
+	t.Helper()
+	t.Setenv("SQLITE_PATH", sqlitePath)
+	server, cleanup, _ := service.NewHTTPService(service.Options{OSSignalListenerDisabled: true})
+	go func() {
+		require.NoError(t, server.Run())
+	}()
+	t.Cleanup(func() {
+		cleanup() //nolint:errcheck
+		require.NoError(t, server.Close())
+	})
+
+	time.Sleep(time.Second)
+
+	baseURL := url.URL{
+		Scheme: "http",
+		Path:   "api/admin/",
+		Host:   server.Address(),
+	}
+	adminAPIClient, err := httpclient.New().WithDefaultHeaders(map[string]string{
+		"Content-Type":  "application/json",
+		"Authorization": fmt.Sprintf("Bearer %v", os.Getenv("API_SECRET_KEY_ADMIN")),
+	}).WithBaseURL(baseURL.String())
+	require.NoError(t, err)
+	return testServer{server: server, adminAPIClient: adminAPIClient}
+}
+
+func (s testServer) createProject(ctx context.Context, t *testing.T, name string) periscopeHttp.Project {
+	t.Helper()
+	resp, err := s.adminAPIClient.Post(ctx, "projects", strings.NewReader(fmt.Sprintf(`{"name": %q}`, name)))
+	require.NoError(t, err)
+
+	p := periscopeHttp.ProjectCreateResponse{}
+	require.NoError(t, httpclient.DeserializeJSON(resp, &p))
+	return p.Project
+}
+
+func (s testServer) readEvent(ctx context.Context, t *testing.T, projectID uint, eventID string) repository.Event {
+	t.Helper()
+	resp, err := s.adminAPIClient.Get(ctx, fmt.Sprintf("projects/%d/events/%s", projectID, eventID))
+	require.NoError(t, err)
+	ev := periscopeHttp.EventReadResponse{}
+	require.NoError(t, httpclient.DeserializeJSON(resp, &ev))
+	return ev.Event
+}
+
+func (s testServer) listAlerts(ctx context.Context, t *testing.T, projectID uint) periscopeHttp.AlertListResponse {
+	t.Helper()
+	resp, err := s.adminAPIClient.Get(ctx, fmt.Sprintf("projects/%d/alerts", projectID))
+	require.NoError(t, err)
+	alertList := periscopeHttp.AlertListResponse{}
+	require.NoError(t, httpclient.DeserializeJSON(resp, &alertList))
+	return alertList
+}
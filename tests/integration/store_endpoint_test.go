@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	periscopeHttp "github.com/georgepsarakis/periscope/http"
+)
+
+func TestEventForwarding_LegacyStoreEndpoint(t *testing.T) {
+	s := newTestServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	p := s.createProject(ctx, t, "legacy project")
+
+	event := `{
+		"event_id": "fc6d8c0c43fc4630ad850ee518f1b9d0",
+		"platform": "python",
+		"level": "error",
+		"fingerprint": ["legacy"],
+		"release": "legacy@1.0.0",
+		"dist": "build-17",
+		"environment": "production",
+		"transaction": "/checkout",
+		"user": {"id": 7},
+		"tags": {"region": "eu-west-1"},
+		"exception": [{"type": "ValueError", "value": "invalid literal"}]
+	}`
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	_, err := zw.Write([]byte(event))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	// SDKs retry submissions, the duplicate is acknowledged with the same ID
+	for range 2 {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			fmt.Sprintf("http://%s/api/%s/store/", s.server.Address(), p.PublicID),
+			bytes.NewReader([]byte(base64.StdEncoding.EncodeToString(compressed.Bytes()))))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("X-Sentry-Auth", fmt.Sprintf(
+			"Sentry sentry_version=6, sentry_client=raven-python/6.10.0, sentry_key=%s", p.IngestionAPIKeys[0]))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		storeResp := periscopeHttp.StoreResponse{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&storeResp))
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "fc6d8c0c43fc4630ad850ee518f1b9d0", storeResp.ID)
+	}
+
+	time.Sleep(2 * time.Second)
+	alertList := s.listAlerts(ctx, t, p.ID)
+	require.NotEmpty(t, alertList.Alerts)
+	assert.Equal(t, p.ID, alertList.Alerts[0].ProjectID)
+
+	ev := s.readEvent(ctx, t, p.ID, "fc6d8c0c43fc4630ad850ee518f1b9d0")
+	assert.Equal(t, "invalid literal", ev.Title)
+	assert.Equal(t, "legacy@1.0.0", ev.Release)
+	assert.Equal(t, "build-17", ev.Dist)
+	assert.Equal(t, "raven-python", ev.ClientName)
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal(ev.Payload, &payload))
+	assert.Equal(t, "fc6d8c0c43fc4630ad850ee518f1b9d0", payload["event_id"])
+	assert.Equal(t, "/checkout", payload["transaction"])
+
+	// Events are found by the UUID reported by the SDK
+	ev = s.readEvent(ctx, t, p.ID, "FC6D8C0C-43FC-4630-AD85-0EE518F1B9D0")
+	assert.Equal(t, "fc6d8c0c43fc4630ad850ee518f1b9d0", ev.EventID)
+
+	resp, err := s.adminAPIClient.Get(ctx, fmt.Sprintf("projects/%d/events/%s", p.ID, "0f8fad5b-d9cb-469f-a165-70867728950e"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = s.adminAPIClient.Get(ctx, fmt.Sprintf("projects/%d/events/%s", p.ID, "missing"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}